@@ -4,6 +4,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +12,7 @@ import (
 // Config 应用程序配置结构
 type Config struct {
 	Port         string // 服务器端口
+	MetricsAddr  string // 内部监控接口监听地址，为空时不启用
 	DatabaseURL  string // 数据库连接URL
 	AIAPIKey     string // AI服务API密钥
 	AIBaseURL    string // AI服务基础URL
@@ -20,6 +22,41 @@ type Config struct {
 	VisionAPIKey string // 视觉识别API密钥
 	JWTSecret    string // JWT密钥
 	Environment  string // 运行环境
+
+	FileStorageDir  string // 本地文件存储目录
+	FileBaseURL     string // 文件访问URL前缀
+	RecordingDir    string // 通话录音存储目录，不对外静态暴露，只能通过鉴权接口下载
+	TTSCacheSize    int    // TTS内存缓存条目上限
+	TTSCachePrewarm bool   // 启动时是否预热TTS缓存
+
+	VoiceSessionIdleTimeout time.Duration // 语音会话无音频多久后视为断开
+	VoiceSessionRetention   time.Duration // 已结束的语音会话在内存中保留多久
+	VoiceSessionResumeGrace time.Duration // WebSocket断开后等待重连的宽限期
+
+	ContextTokenBudget int // 聊天上下文的token预算
+
+	CompanionSlotLimit int // 每个用户可同时拥有的AI伙伴数量（不含已归档）
+
+	MemoryTopK        int // 每次回复最多带上的相关记忆数
+	MemoryTokenBudget int // 相关记忆占用的token上限
+
+	EmbeddingProvider         string        // 向量模型：remote（OpenAI兼容接口）、hashing（本地），为空时不启用语义检索
+	EmbeddingBaseURL          string        // 向量接口基础URL，默认同AI_BASE_URL
+	EmbeddingAPIKey           string        // 向量接口API密钥，默认同AI_API_KEY
+	EmbeddingModel            string        // 远程向量模型名称
+	EmbeddingDimensions       int           // 本地哈希向量的维度
+	EmbeddingBackfillInterval time.Duration // 向量回填任务的间隔
+	EmbeddingBackfillBatch    int           // 向量回填每批处理的条数
+
+	DiaryEnabled       bool          // 是否启用AI伙伴每日日记
+	DiaryCheckInterval time.Duration // 日记调度间隔
+	DiaryBackfillDays  int           // 每轮调度回溯检查漏写日记的天数
+
+	ProactiveMessagesEnabled     bool          // 是否启用角色主动消息
+	ProactiveCheckInterval       time.Duration // 主动消息调度间隔
+	ProactiveMaxPerCharacterDay  int           // 每个角色每天最多主动发几条
+	ProactiveMaxPerUserDay       int           // 每个用户每天最多收到几条
+	ProactiveInactivityThreshold time.Duration // 用户多久未聊天后主动问候
 }
 
 // Load 加载应用程序配置
@@ -29,6 +66,7 @@ func Load() *Config {
 
 	return &Config{
 		Port:         getEnv("PORT", "8080"),
+		MetricsAddr:  getEnv("METRICS_ADDR", "127.0.0.1:9090"),
 		DatabaseURL:  getEnv("DATABASE_URL", ""),
 		AIAPIKey:     getEnv("AI_API_KEY", ""),
 		AIBaseURL:    getEnv("AI_BASE_URL", ""),
@@ -38,6 +76,41 @@ func Load() *Config {
 		VisionAPIKey: getEnv("VISION_API_KEY", ""),
 		JWTSecret:    getEnv("JWT_SECRET", ""),
 		Environment:  getEnv("ENVIRONMENT", "development"),
+
+		FileStorageDir:  getEnv("FILE_STORAGE_DIR", "./storage"),
+		FileBaseURL:     getEnv("FILE_BASE_URL", "/files"),
+		RecordingDir:    getEnv("RECORDING_STORAGE_DIR", "./recordings"),
+		TTSCacheSize:    getEnvAsInt("TTS_CACHE_SIZE", 200),
+		TTSCachePrewarm: getEnvAsBool("TTS_CACHE_PREWARM", true),
+
+		VoiceSessionIdleTimeout: time.Duration(getEnvAsInt("VOICE_SESSION_IDLE_TIMEOUT_SECONDS", 600)) * time.Second,
+		VoiceSessionRetention:   time.Duration(getEnvAsInt("VOICE_SESSION_RETENTION_SECONDS", 300)) * time.Second,
+		VoiceSessionResumeGrace: time.Duration(getEnvAsInt("VOICE_SESSION_RESUME_GRACE_SECONDS", 60)) * time.Second,
+
+		ContextTokenBudget: getEnvAsInt("CONTEXT_TOKEN_BUDGET", 3000),
+
+		CompanionSlotLimit: getEnvAsInt("COMPANION_SLOT_LIMIT", 3),
+
+		MemoryTopK:        getEnvAsInt("MEMORY_TOP_K", 5),
+		MemoryTokenBudget: getEnvAsInt("MEMORY_TOKEN_BUDGET", 300),
+
+		EmbeddingProvider:         getEnv("EMBEDDING_PROVIDER", ""),
+		EmbeddingBaseURL:          getEnv("EMBEDDING_BASE_URL", getEnv("AI_BASE_URL", "")),
+		EmbeddingAPIKey:           getEnv("EMBEDDING_API_KEY", getEnv("AI_API_KEY", "")),
+		EmbeddingModel:            getEnv("EMBEDDING_MODEL", "text-embedding-v3"),
+		EmbeddingDimensions:       getEnvAsInt("EMBEDDING_DIMENSIONS", 256),
+		EmbeddingBackfillInterval: time.Duration(getEnvAsInt("EMBEDDING_BACKFILL_INTERVAL_SECONDS", 60)) * time.Second,
+		EmbeddingBackfillBatch:    getEnvAsInt("EMBEDDING_BACKFILL_BATCH", 32),
+
+		DiaryEnabled:       getEnvAsBool("DIARY_ENABLED", true),
+		DiaryCheckInterval: time.Duration(getEnvAsInt("DIARY_CHECK_INTERVAL_MINUTES", 60)) * time.Minute,
+		DiaryBackfillDays:  getEnvAsInt("DIARY_BACKFILL_DAYS", 7),
+
+		ProactiveMessagesEnabled:     getEnvAsBool("PROACTIVE_MESSAGES_ENABLED", true),
+		ProactiveCheckInterval:       time.Duration(getEnvAsInt("PROACTIVE_CHECK_INTERVAL_MINUTES", 15)) * time.Minute,
+		ProactiveMaxPerCharacterDay:  getEnvAsInt("PROACTIVE_MAX_PER_CHARACTER_PER_DAY", 1),
+		ProactiveMaxPerUserDay:       getEnvAsInt("PROACTIVE_MAX_PER_USER_PER_DAY", 3),
+		ProactiveInactivityThreshold: time.Duration(getEnvAsInt("PROACTIVE_INACTIVITY_HOURS", 48)) * time.Hour,
 	}
 }
 
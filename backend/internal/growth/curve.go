@@ -0,0 +1,90 @@
+// Package growth 提供AI伙伴统一的成长引擎：按成长模式定义的经验曲线、成长里程碑和经验结算
+package growth
+
+// 成长模式，对应 ai_companions.growth_mode
+const (
+	ModeShort = "short" // 快速成长
+	ModeLong  = "long"  // 长期养成
+)
+
+// Curve 一种成长模式的经验曲线
+// Thresholds[i] 为达到 i+1 级所需的累计经验，最后一项即完成成长所需的经验
+type Curve struct {
+	Mode       string
+	Thresholds []int
+}
+
+var (
+	longCurve = Curve{
+		Mode:       ModeLong,
+		Thresholds: []int{0, 100, 300, 600, 1000, 1500, 2100, 2800, 3600, 4500, 5500},
+	}
+	shortCurve = Curve{
+		Mode:       ModeShort,
+		Thresholds: []int{0, 30, 90, 180, 300, 450, 630, 840, 1080, 1350, 1650},
+	}
+)
+
+// CurveFor 获取成长模式对应的曲线，未知模式按长期养成处理
+func CurveFor(mode string) Curve {
+	if mode == ModeShort {
+		return shortCurve
+	}
+	return longCurve
+}
+
+// MaxLevel 最高等级
+func (c Curve) MaxLevel() int {
+	return len(c.Thresholds)
+}
+
+// CompletionExperience 完成成长所需的累计经验
+func (c Curve) CompletionExperience() int {
+	return c.Thresholds[len(c.Thresholds)-1]
+}
+
+// LevelFor 累计经验对应的等级（从1开始）
+func (c Curve) LevelFor(experience int) int {
+	level := 1
+	for i, threshold := range c.Thresholds {
+		if experience >= threshold {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// Progress 整体成长进度（0-100），决定AI伙伴所处的成长阶段
+func (c Curve) Progress(experience int) float64 {
+	if experience <= 0 {
+		return 0
+	}
+	if c.Completed(experience) {
+		return 100
+	}
+	return float64(experience) / float64(c.CompletionExperience()) * 100
+}
+
+// LevelProgress 当前等级内的进度（0-100），已满级时为100
+func (c Curve) LevelProgress(experience int) float64 {
+	level := c.LevelFor(experience)
+	if level >= c.MaxLevel() {
+		return 100
+	}
+	start, next := c.Thresholds[level-1], c.Thresholds[level]
+	return float64(experience-start) / float64(next-start) * 100
+}
+
+// ExperienceToNext 距离下一级还需要的经验，已满级时为0
+func (c Curve) ExperienceToNext(experience int) int {
+	level := c.LevelFor(experience)
+	if level >= c.MaxLevel() {
+		return 0
+	}
+	return c.Thresholds[level] - experience
+}
+
+// Completed 是否已完成成长
+func (c Curve) Completed(experience int) bool {
+	return experience >= c.CompletionExperience()
+}
@@ -0,0 +1,151 @@
+package growth
+
+import "testing"
+
+func TestCurveForUnknownModeUsesLong(t *testing.T) {
+	if got := CurveFor("").Mode; got != ModeLong {
+		t.Fatalf("CurveFor(\"\").Mode = %q, want %q", got, ModeLong)
+	}
+	if got := CurveFor(ModeShort).Mode; got != ModeShort {
+		t.Fatalf("CurveFor(short).Mode = %q, want %q", got, ModeShort)
+	}
+}
+
+func TestCurveThresholdsStrictlyIncreasing(t *testing.T) {
+	for _, curve := range []Curve{CurveFor(ModeShort), CurveFor(ModeLong)} {
+		if curve.Thresholds[0] != 0 {
+			t.Errorf("%s: first threshold = %d, want 0", curve.Mode, curve.Thresholds[0])
+		}
+		for i := 1; i < len(curve.Thresholds); i++ {
+			if curve.Thresholds[i] <= curve.Thresholds[i-1] {
+				t.Errorf("%s: threshold[%d] = %d not greater than %d", curve.Mode, i, curve.Thresholds[i], curve.Thresholds[i-1])
+			}
+		}
+	}
+}
+
+func TestShortCurveGrowsFaster(t *testing.T) {
+	short, long := CurveFor(ModeShort), CurveFor(ModeLong)
+	if short.CompletionExperience() >= long.CompletionExperience() {
+		t.Fatalf("short completion %d should be below long completion %d", short.CompletionExperience(), long.CompletionExperience())
+	}
+	for _, xp := range []int{50, 300, 1000} {
+		if short.LevelFor(xp) < long.LevelFor(xp) {
+			t.Errorf("xp=%d: short level %d below long level %d", xp, short.LevelFor(xp), long.LevelFor(xp))
+		}
+	}
+}
+
+func TestLevelFor(t *testing.T) {
+	curve := CurveFor(ModeLong)
+	tests := []struct {
+		xp   int
+		want int
+	}{
+		{-10, 1},
+		{0, 1},
+		{99, 1},
+		{100, 2},
+		{299, 2},
+		{300, 3},
+		{5499, 10},
+		{5500, 11},
+		{100000, 11},
+	}
+	for _, tt := range tests {
+		if got := curve.LevelFor(tt.xp); got != tt.want {
+			t.Errorf("LevelFor(%d) = %d, want %d", tt.xp, got, tt.want)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	curve := CurveFor(ModeShort)
+	tests := []struct {
+		xp   int
+		want float64
+	}{
+		{0, 0},
+		{-5, 0},
+		{165, 10},
+		{825, 50},
+		{1650, 100},
+		{5000, 100},
+	}
+	for _, tt := range tests {
+		if got := curve.Progress(tt.xp); got != tt.want {
+			t.Errorf("Progress(%d) = %v, want %v", tt.xp, got, tt.want)
+		}
+	}
+}
+
+func TestLevelProgressAndExperienceToNext(t *testing.T) {
+	curve := CurveFor(ModeLong)
+	tests := []struct {
+		xp       int
+		progress float64
+		toNext   int
+	}{
+		{0, 0, 100},
+		{50, 50, 50},
+		{100, 0, 200},
+		{200, 50, 100},
+		{5500, 100, 0},
+		{9999, 100, 0},
+	}
+	for _, tt := range tests {
+		if got := curve.LevelProgress(tt.xp); got != tt.progress {
+			t.Errorf("LevelProgress(%d) = %v, want %v", tt.xp, got, tt.progress)
+		}
+		if got := curve.ExperienceToNext(tt.xp); got != tt.toNext {
+			t.Errorf("ExperienceToNext(%d) = %d, want %d", tt.xp, got, tt.toNext)
+		}
+	}
+}
+
+func TestCompletedMatchesMaxLevel(t *testing.T) {
+	for _, curve := range []Curve{CurveFor(ModeShort), CurveFor(ModeLong)} {
+		done := curve.CompletionExperience()
+		if curve.Completed(done - 1) {
+			t.Errorf("%s: completed one XP early", curve.Mode)
+		}
+		if !curve.Completed(done) || curve.LevelFor(done) != curve.MaxLevel() {
+			t.Errorf("%s: completion at %d should reach max level %d", curve.Mode, done, curve.MaxLevel())
+		}
+	}
+}
+
+func TestNextMilestone(t *testing.T) {
+	tests := []struct {
+		progress float64
+		want     string
+	}{
+		{0, "learning"},
+		{19.9, "learning"},
+		{20, "growing"},
+		{79, "mature"},
+		{99.9, "completed"},
+	}
+	for _, tt := range tests {
+		got := NextMilestone(tt.progress)
+		if got == nil || got.Key != tt.want {
+			t.Errorf("NextMilestone(%v) = %+v, want %s", tt.progress, got, tt.want)
+		}
+	}
+	if got := NextMilestone(100); got != nil {
+		t.Errorf("NextMilestone(100) = %+v, want nil", got)
+	}
+}
+
+func TestMilestonesBetween(t *testing.T) {
+	reached := MilestonesBetween(10, 55)
+	if len(reached) != 2 || reached[0].Key != "learning" || reached[1].Key != "growing" {
+		t.Fatalf("MilestonesBetween(10, 55) = %+v, want learning and growing", reached)
+	}
+	if reached := MilestonesBetween(20, 30); len(reached) != 0 {
+		t.Errorf("MilestonesBetween(20, 30) = %+v, want none (20 already reached)", reached)
+	}
+	if reached := MilestonesBetween(95, 100); len(reached) != 1 || reached[0].Key != "completed" {
+		t.Errorf("MilestonesBetween(95, 100) = %+v, want completed", reached)
+	}
+}
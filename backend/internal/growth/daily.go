@@ -0,0 +1,31 @@
+package growth
+
+import "time"
+
+// DailyWindow 计算边际递减时统计已获经验的时间窗口
+const DailyWindow = 24 * time.Hour
+
+// dailyTier 窗口内已获经验达到From后，新经验按Multiplier折算
+type dailyTier struct {
+	From       int
+	Multiplier float64
+}
+
+// dailyTiers 每日经验的边际递减档位，按From升序
+var dailyTiers = []dailyTier{
+	{From: 0, Multiplier: 1},
+	{From: 100, Multiplier: 0.5},
+	{From: 200, Multiplier: 0.25},
+	{From: 300, Multiplier: 0.1},
+}
+
+// DailyMultiplier 根据窗口内已获得的经验返回新经验的折算比例
+func DailyMultiplier(earned int) float64 {
+	multiplier := dailyTiers[0].Multiplier
+	for _, tier := range dailyTiers {
+		if earned >= tier.From {
+			multiplier = tier.Multiplier
+		}
+	}
+	return multiplier
+}
@@ -0,0 +1,22 @@
+package growth
+
+import "testing"
+
+func TestDailyMultiplier(t *testing.T) {
+	tests := []struct {
+		earned int
+		want   float64
+	}{
+		{0, 1},
+		{99, 1},
+		{100, 0.5},
+		{250, 0.25},
+		{300, 0.1},
+		{10000, 0.1},
+	}
+	for _, tt := range tests {
+		if got := DailyMultiplier(tt.earned); got != tt.want {
+			t.Errorf("DailyMultiplier(%d) = %v, want %v", tt.earned, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package growth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrCompanionNotFound AI伙伴不存在
+var ErrCompanionNotFound = errors.New("AI伙伴不存在")
+
+// Result 一次经验结算的结果
+type Result struct {
+	CompanionID       int
+	ExperienceGained  int
+	TotalExperience   int
+	PreviousLevel     int
+	CurrentLevel      int
+	GrowthPercentage  float64
+	LevelUp           bool
+	Completed         bool        // 本次结算完成了成长
+	ReachedMilestones []Milestone // 本次新达成的里程碑
+}
+
+// Engine 成长引擎，负责把经验写入AI伙伴并重新计算等级和进度
+type Engine struct {
+	db *sql.DB
+}
+
+// NewEngine 创建成长引擎
+func NewEngine(db *sql.DB) *Engine {
+	return &Engine{db: db}
+}
+
+// AddExperience 在事务中为AI伙伴增加经验，按其成长模式的曲线重新计算等级、进度和完成状态
+func (e *Engine) AddExperience(companionID, experience int) (*Result, error) {
+	tx, err := e.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := ApplyExperience(tx, companionID, experience)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ApplyExperience 在调用方的事务中结算经验，锁定AI伙伴行以避免并发对话丢失经验
+func ApplyExperience(tx *sql.Tx, companionID, experience int) (*Result, error) {
+	var total, level int
+	var mode string
+	var completed bool
+	err := tx.QueryRow(`
+		SELECT total_experience, current_level, growth_mode, is_growth_completed
+		FROM ai_companions WHERE id = ? FOR UPDATE
+	`, companionID).Scan(&total, &level, &mode, &completed)
+	if err == sql.ErrNoRows {
+		return nil, ErrCompanionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock companion: %w", err)
+	}
+
+	curve := CurveFor(mode)
+	if experience < 0 {
+		experience = 0
+	}
+	previousProgress := curve.Progress(total)
+	result := &Result{
+		CompanionID:      companionID,
+		ExperienceGained: experience,
+		TotalExperience:  total + experience,
+		PreviousLevel:    level,
+	}
+	result.CurrentLevel = curve.LevelFor(result.TotalExperience)
+	result.GrowthPercentage = curve.Progress(result.TotalExperience)
+	result.LevelUp = result.CurrentLevel > result.PreviousLevel
+	result.Completed = !completed && curve.Completed(result.TotalExperience)
+	result.ReachedMilestones = MilestonesBetween(previousProgress, result.GrowthPercentage)
+
+	_, err = tx.Exec(`
+		UPDATE ai_companions
+		SET total_experience = ?, current_level = ?, growth_percentage = ?,
+			is_growth_completed = ?, updated_at = NOW()
+		WHERE id = ?
+	`, result.TotalExperience, result.CurrentLevel, result.GrowthPercentage,
+		completed || curve.Completed(result.TotalExperience), companionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update companion growth: %w", err)
+	}
+	return result, nil
+}
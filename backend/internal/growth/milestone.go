@@ -0,0 +1,38 @@
+package growth
+
+// Milestone 成长里程碑，按整体成长进度划分，与AI伙伴的成长阶段一一对应
+type Milestone struct {
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Progress    float64 `json:"progress"` // 达成所需的整体成长进度（0-100）
+}
+
+// Milestones 全部里程碑，按进度升序
+var Milestones = []Milestone{
+	{Key: "learning", Name: "学习期", Description: "学会基本对话，开始模仿你的表达方式", Progress: 20},
+	{Key: "growing", Name: "成长期", Description: "开始形成自己的想法和个性", Progress: 50},
+	{Key: "mature", Name: "成熟期", Description: "形成稳定人格，能深度理解你的情感", Progress: 80},
+	{Key: "completed", Name: "成长完成", Description: "完全成熟，成为独一无二的伙伴", Progress: 100},
+}
+
+// NextMilestone 尚未达成的下一个里程碑，全部达成时返回nil
+func NextMilestone(progress float64) *Milestone {
+	for i := range Milestones {
+		if progress < Milestones[i].Progress {
+			return &Milestones[i]
+		}
+	}
+	return nil
+}
+
+// MilestonesBetween 进度从from增长到to时新达成的里程碑
+func MilestonesBetween(from, to float64) []Milestone {
+	var reached []Milestone
+	for _, m := range Milestones {
+		if from < m.Progress && to >= m.Progress {
+			reached = append(reached, m)
+		}
+	}
+	return reached
+}
@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"seven-ai-backend/internal/models"
 	"seven-ai-backend/internal/services"
@@ -32,7 +33,7 @@ func (h *CompanionHandler) CreateCompanion(c *gin.Context) {
 
 	companion, err := h.companionService.CreateCompanion(userID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -42,11 +43,12 @@ func (h *CompanionHandler) CreateCompanion(c *gin.Context) {
 	})
 }
 
-// GetUserCompanions 获取用户的AI伙伴列表
+// GetUserCompanions 获取用户的AI伙伴列表，include_archived=true时包含已归档的
 func (h *CompanionHandler) GetUserCompanions(c *gin.Context) {
 	userID := c.GetInt("user_id")
+	includeArchived := c.Query("include_archived") == "true"
 
-	companions, err := h.companionService.GetUserCompanions(userID)
+	companions, err := h.companionService.GetUserCompanions(userID, includeArchived)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -66,9 +68,22 @@ func (h *CompanionHandler) GetCompanion(c *gin.Context) {
 		return
 	}
 
-	companion, err := h.companionService.GetCompanion(companionID)
+	companion, err := h.companionService.GetCompanion(c.GetInt("user_id"), companionID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"companion": companion,
+	})
+}
+
+// GetDefaultCompanion 获取用户的默认AI伙伴
+func (h *CompanionHandler) GetDefaultCompanion(c *gin.Context) {
+	companion, err := h.companionService.GetDefaultCompanion(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -92,9 +107,9 @@ func (h *CompanionHandler) UpdateCompanion(c *gin.Context) {
 		return
 	}
 
-	err = h.companionService.UpdateCompanion(companionID, req)
+	err = h.companionService.UpdateCompanion(c.GetInt("user_id"), companionID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -113,9 +128,9 @@ func (h *CompanionHandler) GetGrowthStatus(c *gin.Context) {
 		return
 	}
 
-	growth, err := h.companionService.GetGrowthStatus(companionID)
+	growth, err := h.companionService.GetGrowthStatus(c.GetInt("user_id"), companionID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -139,9 +154,9 @@ func (h *CompanionHandler) GetDiary(c *gin.Context) {
 		limit = 10
 	}
 
-	diaries, err := h.companionService.GetDiary(companionID, limit)
+	diaries, err := h.companionService.GetDiary(c.GetInt("user_id"), companionID, limit)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -159,9 +174,9 @@ func (h *CompanionHandler) GetEmotionState(c *gin.Context) {
 		return
 	}
 
-	emotion, err := h.companionService.GetEmotionState(companionID)
+	emotion, err := h.companionService.GetEmotionState(c.GetInt("user_id"), companionID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -169,3 +184,127 @@ func (h *CompanionHandler) GetEmotionState(c *gin.Context) {
 		"emotion": emotion,
 	})
 }
+
+// GetEmotionHistory 获取AI伙伴情绪历史（用于绘制情绪曲线）
+func (h *CompanionHandler) GetEmotionHistory(c *gin.Context) {
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return
+	}
+
+	var req models.EmotionHistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := h.companionService.GetEmotionHistory(c.GetInt("user_id"), companionID, req)
+	if err != nil {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+	})
+}
+
+// GetGrowthEvents 获取AI伙伴成长事件日志（经验和能力变化及其调整原因）
+func (h *CompanionHandler) GetGrowthEvents(c *gin.Context) {
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return
+	}
+
+	var req models.GrowthEventListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := h.companionService.GetGrowthEvents(c.GetInt("user_id"), companionID, req)
+	if err != nil {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+	})
+}
+
+// SetDefaultCompanion 设为默认AI伙伴
+func (h *CompanionHandler) SetDefaultCompanion(c *gin.Context) {
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return
+	}
+
+	companion, err := h.companionService.SetDefaultCompanion(c.GetInt("user_id"), companionID)
+	if err != nil {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "已设为默认AI伙伴",
+		"companion": companion,
+	})
+}
+
+// ArchiveCompanion 归档AI伙伴
+func (h *CompanionHandler) ArchiveCompanion(c *gin.Context) {
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return
+	}
+
+	companion, err := h.companionService.ArchiveCompanion(c.GetInt("user_id"), companionID)
+	if err != nil {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "AI伙伴已归档",
+		"companion": companion,
+	})
+}
+
+// RestoreCompanion 恢复已归档的AI伙伴
+func (h *CompanionHandler) RestoreCompanion(c *gin.Context) {
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return
+	}
+
+	companion, err := h.companionService.RestoreCompanion(c.GetInt("user_id"), companionID)
+	if err != nil {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "AI伙伴已恢复",
+		"companion": companion,
+	})
+}
+
+// companionErrorStatus AI伙伴相关错误对应的HTTP状态码
+func companionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCompanionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCompanionSlotsFull),
+		errors.Is(err, services.ErrCompanionArchived),
+		errors.Is(err, services.ErrCompanionNotArchived):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
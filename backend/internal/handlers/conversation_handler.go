@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"seven-ai-backend/internal/models"
 	"seven-ai-backend/internal/services"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,7 +36,7 @@ func (h *ConversationHandler) Chat(c *gin.Context) {
 
 	response, err := h.conversationService.Chat(userID.(int), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "聊天失败: " + err.Error()})
+		c.JSON(chatTargetErrorStatus(err), gin.H{"error": "聊天失败: " + err.Error()})
 		return
 	}
 
@@ -54,7 +58,7 @@ func (h *ConversationHandler) VoiceChat(c *gin.Context) {
 
 	response, err := h.conversationService.VoiceChat(userID.(int), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "语音聊天失败: " + err.Error()})
+		c.JSON(chatTargetErrorStatus(err), gin.H{"error": "语音聊天失败: " + err.Error()})
 		return
 	}
 
@@ -76,7 +80,7 @@ func (h *ConversationHandler) ImageChat(c *gin.Context) {
 
 	response, err := h.conversationService.ImageChat(userID.(int), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "图片聊天失败: " + err.Error()})
+		c.JSON(chatTargetErrorStatus(err), gin.H{"error": "图片聊天失败: " + err.Error()})
 		return
 	}
 
@@ -90,57 +94,504 @@ func (h *ConversationHandler) GetHistory(c *gin.Context) {
 		return
 	}
 
-	characterIDStr := c.Query("character_id")
-	if characterIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "角色ID不能为空"})
+	var target models.ChatTarget
+	if err := c.ShouldBindQuery(&target); err != nil || !target.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "需要指定角色ID或AI伙伴ID之一"})
 		return
 	}
 
-	characterID, err := strconv.Atoi(characterIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+	var page models.HistoryPageRequest
+	if err := c.ShouldBindQuery(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页参数"})
 		return
 	}
 
-	history, err := h.conversationService.GetHistory(userID.(int), characterID)
+	history, err := h.conversationService.GetHistory(userID.(int), target, page)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidHistoryCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取聊天记录失败: " + err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, historyPageResponse(history))
+}
+
+// historyPageResponse 构造分页聊天记录响应
+func historyPageResponse(page *models.HistoryPage) gin.H {
+	return gin.H{
+		"success": true,
+		"data":    page.Messages,
+		"pagination": gin.H{
+			"has_more":      page.HasMore,
+			"before_cursor": page.BeforeCursor,
+			"after_cursor":  page.AfterCursor,
+		},
+		"total":  page.Total,
+		"unread": page.Unread,
+	}
+}
+
+// GetSessionHistory 获取指定会话的聊天记录
+func (h *ConversationHandler) GetSessionHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var page models.HistoryPageRequest
+	if err := c.ShouldBindQuery(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分页参数"})
+		return
+	}
+
+	history, err := h.conversationService.GetSessionHistory(userID.(int), c.Param("sessionId"), page)
+	if err != nil {
+		if errors.Is(err, services.ErrChatSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidHistoryCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话历史失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, historyPageResponse(history))
+}
+
+// MarkAsRead 将角色或会话的消息标记为已读
+func (h *ConversationHandler) MarkAsRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req models.MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.conversationService.MarkAsRead(userID.(int), req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidReadTarget) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrChatSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "标记已读失败: " + err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    history,
+		"data":    result,
 	})
 }
 
-func (h *ConversationHandler) GetSessionHistory(c *gin.Context) {
+// GetUnreadCounts 获取各角色的未读消息数
+func (h *ConversationHandler) GetUnreadCounts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	summary, err := h.conversationService.GetUnreadCounts(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取未读数失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    summary,
+	})
+}
+
+// CreateSession 创建聊天会话
+func (h *ConversationHandler) CreateSession(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
 	}
 
-	characterIDStr := c.Query("character_id")
-	if characterIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "角色ID不能为空"})
+	var req models.CreateChatSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	characterID, err := strconv.Atoi(characterIDStr)
+	session, err := h.conversationService.CreateSession(userID.(int), req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		c.JSON(chatTargetErrorStatus(err), gin.H{"error": "创建会话失败: " + err.Error()})
 		return
 	}
 
-	history, err := h.conversationService.GetHistory(userID.(int), characterID)
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    session,
+	})
+}
+
+// ListSessions 获取会话列表，可按角色或AI伙伴过滤，默认不含已归档会话
+func (h *ConversationHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var target models.ChatTarget
+	if err := c.ShouldBindQuery(&target); err != nil || (!target.IsZero() && !target.Valid()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID或AI伙伴ID"})
+		return
+	}
+	includeArchived := c.Query("include_archived") == "true"
+
+	sessions, err := h.conversationService.ListSessions(userID.(int), target, includeArchived)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话历史失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    sessions,
+	})
+}
+
+// UpdateSession 重命名或归档会话
+func (h *ConversationHandler) UpdateSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req models.UpdateChatSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.conversationService.UpdateSession(userID.(int), c.Param("sessionId"), req)
+	if err != nil {
+		if errors.Is(err, services.ErrChatSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新会话失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    session,
+	})
+}
+
+// DeleteSession 删除会话及其聊天记录
+func (h *ConversationHandler) DeleteSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	err := h.conversationService.DeleteSession(userID.(int), c.Param("sessionId"))
+	if err != nil {
+		if errors.Is(err, services.ErrChatSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除会话失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "会话已删除",
+	})
+}
+
+// SearchConversations 搜索用户的全部聊天记录
+func (h *ConversationHandler) SearchConversations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req models.ConversationSearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "搜索关键词不能为空"})
+		return
+	}
+
+	results, err := h.conversationService.SearchConversations(userID.(int), req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSearchFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索聊天记录失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    results,
+	})
+}
+
+// ExportConversations 导出聊天记录（Markdown、JSON或HTML），边查询边写出
+func (h *ConversationHandler) ExportConversations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req models.ConversationExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的导出参数"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = models.ExportFormatMarkdown
+	}
+	switch req.Format {
+	case models.ExportFormatMarkdown, models.ExportFormatJSON, models.ExportFormatHTML:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式只支持md、json、html"})
+		return
+	}
+
+	if req.CharacterID > 0 && req.CompanionID > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色ID和AI伙伴ID只能指定一个"})
+		return
+	}
+
+	chats, err := h.conversationService.ListExportChats(userID.(int), models.ChatTarget{CharacterID: req.CharacterID, CompanionID: req.CompanionID})
+	if err != nil {
+		if errors.Is(err, services.ErrNothingToExport) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出聊天记录失败: " + err.Error()})
+		return
+	}
+
+	// 响应头写出后无法再返回错误状态，出错时只能记录日志并中断
+	c.Header("Content-Type", services.ExportContentType(req))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", services.ExportFileName(req, time.Now())))
+	c.Status(http.StatusOK)
+
+	if err := h.conversationService.ExportConversations(userID.(int), req, chats, c.Writer); err != nil {
+		log.Printf("导出聊天记录失败: userID=%d, err=%v", userID, err)
+	}
+}
+
+// chatTargetErrorStatus 聊天对象相关错误对应的HTTP状态码
+func chatTargetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidChatTarget), errors.Is(err, services.ErrInvalidChatSession):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCompanionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCompanionArchived):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// messageErrorStatus 消息相关错误对应的HTTP状态码
+func messageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrMessageNotEditable):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RegenerateReply 重新生成一条消息的AI回复
+func (h *ConversationHandler) RegenerateReply(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	alternatives, err := h.conversationService.RegenerateReply(userID.(int), messageID)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": "重新生成失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alternatives,
+	})
+}
+
+// EditMessage 编辑用户消息并重新生成回复
+func (h *ConversationHandler) EditMessage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	var req models.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alternatives, err := h.conversationService.EditMessage(userID.(int), messageID, req)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": "编辑消息失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alternatives,
+	})
+}
+
+// GetMessageAlternatives 获取一条消息的全部AI回复候选
+func (h *ConversationHandler) GetMessageAlternatives(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	alternatives, err := h.conversationService.GetMessageAlternatives(userID.(int), messageID)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alternatives,
+	})
+}
+
+// GetMessageMemories 查看生成某条回复时使用的记忆（调试检索效果）
+func (h *ConversationHandler) GetMessageMemories(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	memories, err := h.conversationService.GetMessageMemories(userID.(int), messageID)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    memories,
+	})
+}
+
+// SelectReply 切换到指定的AI回复候选
+func (h *ConversationHandler) SelectReply(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+	replyID, err := strconv.Atoi(c.Param("replyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的回复ID"})
+		return
+	}
+
+	alternatives, err := h.conversationService.SelectReply(userID.(int), messageID, replyID)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alternatives,
+	})
+}
+
+// DeleteMessage 删除一条消息
+func (h *ConversationHandler) DeleteMessage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	messageID, err := strconv.Atoi(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return
+	}
+
+	if err := h.conversationService.DeleteMessage(userID.(int), messageID); err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    history,
+		"message": "消息已删除",
 	})
 }
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"seven-ai-backend/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DiaryHandler AI伙伴日记处理器
+type DiaryHandler struct {
+	diaryService *services.DiaryService
+}
+
+// NewDiaryHandler 创建日记处理器
+func NewDiaryHandler(diaryService *services.DiaryService) *DiaryHandler {
+	return &DiaryHandler{diaryService: diaryService}
+}
+
+// BackfillDiaries 补写最近几天漏掉的日记（days默认7，最多30）
+func (h *DiaryHandler) BackfillDiaries(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "0"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的天数"})
+		return
+	}
+
+	diaries, err := h.diaryService.BackfillDiaries(userID.(int), companionID, days)
+	if err != nil && len(diaries) == 0 {
+		c.JSON(companionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    diaries,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"seven-ai-backend/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	eventWriteTimeout = 10 * time.Second
+	eventPingInterval = 30 * time.Second
+	eventPongTimeout  = 70 * time.Second // 超过该时间未收到pong视为断开
+)
+
+// EventHandler 实时事件推送处理器
+type EventHandler struct {
+	hub *services.EventHub
+}
+
+// NewEventHandler 创建实时事件推送处理器
+func NewEventHandler(hub *services.EventHub) *EventHandler {
+	return &EventHandler{hub: hub}
+}
+
+// eventControlMessage 事件流中的控制消息（不带事件ID）
+type eventControlMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// HandleWebSocket 建立用户事件流连接
+// 浏览器WebSocket无法设置请求头，用户ID也可通过user_id查询参数传递；
+// 重连时通过last_event_id补发断线期间错过的事件
+func (h *EventHandler) HandleWebSocket(c *gin.Context) {
+	userIDStr := c.GetHeader("X-User-ID")
+	if userIDStr == "" {
+		userIDStr = c.Query("user_id")
+	}
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var lastEventID int64
+	if v := c.Query("last_event_id"); v != "" {
+		lastEventID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || lastEventID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的last_event_id"})
+			return
+		}
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sub, missed, complete := h.hub.Subscribe(userID, lastEventID)
+	defer h.hub.Unsubscribe(sub)
+
+	// 读循环只用于感知断开和维持心跳
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadDeadline(time.Now().Add(eventPongTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(eventPongTimeout))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(v interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(v)
+	}
+
+	if !complete {
+		if err := write(eventControlMessage{Type: "replay_truncated"}); err != nil {
+			return
+		}
+	}
+	for _, event := range missed {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+	if err := write(eventControlMessage{Type: "ready", Data: gin.H{"replayed": len(missed)}}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(eventPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				// 订阅因积压被断开，客户端应带last_event_id重连
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "event backlog"),
+					time.Now().Add(eventWriteTimeout))
+				return
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
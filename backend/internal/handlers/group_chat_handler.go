@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"seven-ai-backend/internal/models"
+	"seven-ai-backend/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroupChatHandler 多角色群聊处理器
+type GroupChatHandler struct {
+	groupChatService *services.GroupChatService
+}
+
+// NewGroupChatHandler 创建群聊处理器
+func NewGroupChatHandler(groupChatService *services.GroupChatService) *GroupChatHandler {
+	return &GroupChatHandler{groupChatService: groupChatService}
+}
+
+// groupChatErrorStatus 将群聊相关错误映射为HTTP状态码
+func groupChatErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrGroupChatNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidGroupMember), errors.Is(err, services.ErrGroupChatNoSpeakers):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CreateGroupChat 创建群聊
+func (h *GroupChatHandler) CreateGroupChat(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req models.CreateGroupChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.groupChatService.CreateGroupChat(userID.(int), req)
+	if err != nil {
+		c.JSON(groupChatErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// ListGroupChats 获取群聊列表
+func (h *GroupChatHandler) ListGroupChats(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	groups, err := h.groupChatService.ListGroupChats(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取群聊列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    groups,
+	})
+}
+
+// GetGroupChat 获取群聊详情
+func (h *GroupChatHandler) GetGroupChat(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	groupID, err := strconv.Atoi(c.Param("groupId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群聊ID"})
+		return
+	}
+
+	group, err := h.groupChatService.GetGroupChat(userID.(int), groupID)
+	if err != nil {
+		c.JSON(groupChatErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+	})
+}
+
+// DeleteGroupChat 删除群聊
+func (h *GroupChatHandler) DeleteGroupChat(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	groupID, err := strconv.Atoi(c.Param("groupId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群聊ID"})
+		return
+	}
+
+	if err := h.groupChatService.DeleteGroupChat(userID.(int), groupID); err != nil {
+		c.JSON(groupChatErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "群聊已删除",
+	})
+}
+
+// GetGroupMessages 获取群聊消息，通过before_id向前翻页
+func (h *GroupChatHandler) GetGroupMessages(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	groupID, err := strconv.Atoi(c.Param("groupId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群聊ID"})
+		return
+	}
+	beforeID, _ := strconv.Atoi(c.DefaultQuery("before_id", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	messages, err := h.groupChatService.GetGroupMessages(userID.(int), groupID, beforeID, limit)
+	if err != nil {
+		c.JSON(groupChatErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    messages,
+	})
+}
+
+// SendGroupMessage 在群聊中发言
+func (h *GroupChatHandler) SendGroupMessage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	groupID, err := strconv.Atoi(c.Param("groupId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的群聊ID"})
+		return
+	}
+
+	var req models.GroupChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.groupChatService.SendGroupMessage(userID.(int), groupID, req)
+	if err != nil {
+		c.JSON(groupChatErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"seven-ai-backend/internal/models"
+	"seven-ai-backend/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MemoryHandler AI伙伴长期记忆处理器
+type MemoryHandler struct {
+	memoryService *services.MemoryService
+}
+
+// NewMemoryHandler 创建记忆处理器
+func NewMemoryHandler(memoryService *services.MemoryService) *MemoryHandler {
+	return &MemoryHandler{memoryService: memoryService}
+}
+
+// memoryErrorStatus 将记忆相关错误映射为HTTP状态码
+func memoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCompanionNotFound), errors.Is(err, services.ErrMemoryNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// memoryParams 解析路径中的AI伙伴ID和记忆ID，memoryId不存在时返回0
+func memoryParams(c *gin.Context) (companionID, memoryID int, ok bool) {
+	companionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的AI伙伴ID"})
+		return 0, 0, false
+	}
+	if raw := c.Param("memoryId"); raw != "" {
+		memoryID, err = strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的记忆ID"})
+			return 0, 0, false
+		}
+	}
+	return companionID, memoryID, true
+}
+
+// ListMemories 获取AI伙伴记住的内容，可按类型过滤
+func (h *MemoryHandler) ListMemories(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	companionID, _, ok := memoryParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.MemoryListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memories, err := h.memoryService.ListMemories(userID.(int), companionID, req)
+	if err != nil {
+		c.JSON(memoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    memories,
+	})
+}
+
+// UpdateMemory 修正一条记忆
+func (h *MemoryHandler) UpdateMemory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	companionID, memoryID, ok := memoryParams(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memory, err := h.memoryService.UpdateMemory(userID.(int), companionID, memoryID, req)
+	if err != nil {
+		c.JSON(memoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    memory,
+	})
+}
+
+// DeleteMemory 删除一条记忆
+func (h *MemoryHandler) DeleteMemory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	companionID, memoryID, ok := memoryParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.memoryService.DeleteMemory(userID.(int), companionID, memoryID); err != nil {
+		c.JSON(memoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "记忆已删除",
+	})
+}
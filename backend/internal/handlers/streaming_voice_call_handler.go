@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,7 +10,6 @@ import (
 	"sync"
 	"time"
 
-	"seven-ai-backend/internal/models"
 	"seven-ai-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -25,10 +25,15 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+// maxPendingMessages 断线期间每个会话最多缓存的未送达消息数
+const maxPendingMessages = 20
+
 // StreamingVoiceCallHandler 流式语音通话处理器
 type StreamingVoiceCallHandler struct {
 	streamingService  *services.StreamingVoiceCallService
 	activeConnections map[string]*websocket.Conn
+	pendingMessages   map[string][]WebSocketMessage // 断线期间未送达的消息，重连后补发
+	deliveryLocks     map[string]*sync.Mutex        // 会话投递锁，串行化AI回复的发送/缓存与重连补发
 	mu                sync.RWMutex
 }
 
@@ -37,6 +42,8 @@ func NewStreamingVoiceCallHandler(streamingService *services.StreamingVoiceCallS
 	handler := &StreamingVoiceCallHandler{
 		streamingService:  streamingService,
 		activeConnections: make(map[string]*websocket.Conn),
+		pendingMessages:   make(map[string][]WebSocketMessage),
+		deliveryLocks:     make(map[string]*sync.Mutex),
 	}
 
 	// 设置连接错误回调
@@ -45,6 +52,9 @@ func NewStreamingVoiceCallHandler(streamingService *services.StreamingVoiceCallS
 	// 设置AI回复回调
 	streamingService.SetResponseCallback(handler.handleAIResponse)
 
+	// 会话结束后丢弃未送达的消息
+	streamingService.SetSessionClosedCallback(handler.dropPendingMessages)
+
 	return handler
 }
 
@@ -62,8 +72,15 @@ type AudioChunkMessage struct {
 
 // StartCallMessage 开始通话消息
 type StartCallMessage struct {
-	UserID      int64 `json:"user_id"`
-	CharacterID int64 `json:"character_id"`
+	UserID        int64 `json:"user_id"`
+	CharacterID   int64 `json:"character_id"`
+	CompanionID   int64 `json:"companion_id"`   // 与AI伙伴通话时指定
+	RecordConsent bool  `json:"record_consent"` // 用户同意录音
+}
+
+// ResumeCallMessage 断线重连消息
+type ResumeCallMessage struct {
+	ResumeToken string `json:"resume_token"`
 }
 
 // ResponseMessage 响应消息
@@ -76,15 +93,6 @@ type ResponseMessage struct {
 
 // handleAIResponse 处理AI回复
 func (h *StreamingVoiceCallHandler) handleAIResponse(sessionID, userText, aiText string, audioData []byte) {
-	h.mu.RLock()
-	conn, exists := h.activeConnections[sessionID]
-	h.mu.RUnlock()
-
-	if !exists || conn == nil {
-		fmt.Printf("WebSocket连接不存在: %s\n", sessionID)
-		return
-	}
-
 	// 发送AI回复消息
 	response := WebSocketMessage{
 		Type:      "ai_response",
@@ -97,10 +105,89 @@ func (h *StreamingVoiceCallHandler) handleAIResponse(sessionID, userText, aiText
 		},
 	}
 
-	h.sendMessage(conn, response)
+	// 持有投递锁检查连接并发送或缓存，避免重连补发之后才缓存的消息滞留到下一次重连
+	lock := h.deliveryLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	h.mu.RLock()
+	conn, exists := h.activeConnections[sessionID]
+	h.mu.RUnlock()
+
+	// 连接已断开或发送失败时先缓存，等待客户端重连
+	if !exists || conn == nil {
+		fmt.Printf("WebSocket连接不存在，缓存AI回复: %s\n", sessionID)
+		h.bufferPendingMessage(sessionID, response)
+		return
+	}
+	if err := h.sendMessage(conn, response); err != nil {
+		h.bufferPendingMessage(sessionID, response)
+		return
+	}
 	fmt.Printf("发送AI回复: sessionID=%s, userText=%s, aiText=%s\n", sessionID, userText, aiText)
 }
 
+// bufferPendingMessage 缓存未送达的消息（仅限仍可重连的会话）
+func (h *StreamingVoiceCallHandler) bufferPendingMessage(sessionID string, msg WebSocketMessage) {
+	if !h.streamingService.IsSessionResumable(sessionID) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pending := append(h.pendingMessages[sessionID], msg)
+	if len(pending) > maxPendingMessages {
+		// 超出上限时丢弃最早的消息
+		pending = pending[len(pending)-maxPendingMessages:]
+	}
+	h.pendingMessages[sessionID] = pending
+}
+
+// dropPendingMessages 丢弃会话的未送达消息
+func (h *StreamingVoiceCallHandler) dropPendingMessages(sessionID string) {
+	h.mu.Lock()
+	delete(h.pendingMessages, sessionID)
+	delete(h.deliveryLocks, sessionID)
+	h.mu.Unlock()
+}
+
+// deliveryLock 获取会话的投递锁
+func (h *StreamingVoiceCallHandler) deliveryLock(sessionID string) *sync.Mutex {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lock, ok := h.deliveryLocks[sessionID]
+	if !ok {
+		lock = &sync.Mutex{}
+		h.deliveryLocks[sessionID] = lock
+	}
+	return lock
+}
+
+// attachConnection 注册会话连接并取出待补发的消息
+func (h *StreamingVoiceCallHandler) attachConnection(sessionID string, conn *websocket.Conn) []WebSocketMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.activeConnections[sessionID] = conn
+	pending := h.pendingMessages[sessionID]
+	delete(h.pendingMessages, sessionID)
+	return pending
+}
+
+// detachConnection 移除会话连接，返回该连接是否仍是会话的当前连接
+func (h *StreamingVoiceCallHandler) detachConnection(sessionID string, conn *websocket.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 会话已在新连接上恢复时不能移除
+	if h.activeConnections[sessionID] != conn {
+		return false
+	}
+	delete(h.activeConnections, sessionID)
+	return true
+}
+
 // handleConnectionError 处理连接错误
 func (h *StreamingVoiceCallHandler) handleConnectionError(sessionID string, err error) {
 	h.mu.RLock()
@@ -121,22 +208,6 @@ func (h *StreamingVoiceCallHandler) handleConnectionError(sessionID string, err
 	}
 }
 
-// getGreetingText 获取角色打招呼文本（复制普通语音通话的逻辑）
-func getGreetingText(character *models.PresetCharacter) string {
-	switch character.Name {
-	case "林黛玉":
-		return "哟，你来了？今日倒是比往日早了些，莫非是有什么心事？"
-	case "孙悟空":
-		return "兄弟，你来了！俺老孙正闲着，有什么话尽管说，别客气！"
-	case "李白":
-		return "人生得意须尽欢，今日得与君通话，当浮一大白！有什么想聊的？"
-	case "赫敏·格兰杰", "赫敏":
-		return "你好，这里是赫敏，找我有什么事吗？"
-	default:
-		return fmt.Sprintf("你好！我是%s，很高兴和你通话！", character.Name)
-	}
-}
-
 // HandleFirstCall 处理第一次流式通话请求，让AI主动打招呼
 func (h *StreamingVoiceCallHandler) HandleFirstCall(c *gin.Context) {
 	// 获取用户ID
@@ -154,6 +225,7 @@ func (h *StreamingVoiceCallHandler) HandleFirstCall(c *gin.Context) {
 
 	var req struct {
 		CharacterID int    `json:"character_id"`
+		CompanionID int    `json:"companion_id"`
 		SessionID   string `json:"session_id"`
 	}
 
@@ -163,24 +235,24 @@ func (h *StreamingVoiceCallHandler) HandleFirstCall(c *gin.Context) {
 		return
 	}
 
-	log.Printf("收到first-call请求: UserID=%d, CharacterID=%d, SessionID=%s", userID, req.CharacterID, req.SessionID)
+	log.Printf("收到first-call请求: UserID=%d, CharacterID=%d, CompanionID=%d, SessionID=%s", userID, req.CharacterID, req.CompanionID, req.SessionID)
 
 	// 获取角色信息
-	character, err := h.streamingService.GetCharacterByID(req.CharacterID)
+	persona, err := h.streamingService.GetCallPersona(int64(userID), int64(req.CharacterID), int64(req.CompanionID))
 	if err != nil {
 		log.Printf("获取角色信息失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色信息失败"})
 		return
 	}
 
-	log.Printf("获取角色成功: %s", character.Name)
+	log.Printf("获取角色成功: %s", persona.Name)
 
 	// 生成AI的打招呼文本（复制普通语音通话的逻辑）
-	greetingText := getGreetingText(character)
+	greetingText := services.GetGreetingText(persona.Name)
 	log.Printf("生成打招呼文本: %s", greetingText)
 
-	// 调用TTS生成音频
-	audioData, err := h.streamingService.GenerateTTS(greetingText, character.Name)
+	// 调用TTS生成音频（AI伙伴使用其自己的音色）
+	audioData, err := h.streamingService.GenerateTTS(greetingText, persona)
 	if err != nil {
 		log.Printf("生成AI音频失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成AI音频失败"})
@@ -272,9 +344,11 @@ func (h *StreamingVoiceCallHandler) HandleWebSocket(c *gin.Context) {
 			}
 
 			req := &services.StreamingVoiceCallRequest{
-				UserID:      int64(userID), // 转换为int64类型
-				CharacterID: startMsg.CharacterID,
-				SessionID:   msg.SessionID,
+				UserID:        int64(userID), // 转换为int64类型
+				CharacterID:   startMsg.CharacterID,
+				CompanionID:   startMsg.CompanionID,
+				SessionID:     msg.SessionID,
+				RecordConsent: startMsg.RecordConsent,
 			}
 
 			resp, err := h.streamingService.StartStreamingCall(req)
@@ -286,16 +360,53 @@ func (h *StreamingVoiceCallHandler) HandleWebSocket(c *gin.Context) {
 			sessionID = resp.SessionID
 			isCallActive = true
 
-			// 注册连接
-			h.mu.Lock()
-			h.activeConnections[sessionID] = conn
-			h.mu.Unlock()
-
+			// 注册连接，call_started先于AI回复送达
+			lock := h.deliveryLock(sessionID)
+			lock.Lock()
+			h.attachConnection(sessionID, conn)
 			h.sendMessage(conn, WebSocketMessage{
 				Type:      "call_started",
 				SessionID: sessionID,
 				Data:      resp,
 			})
+			lock.Unlock()
+
+		case "resume_call":
+			// 断线重连：使用同一session_id和call_started中下发的resume_token
+			var resumeMsg ResumeCallMessage
+			if dataBytes, err := json.Marshal(msg.Data); err == nil {
+				json.Unmarshal(dataBytes, &resumeMsg)
+			}
+
+			resp, err := h.streamingService.ResumeSession(msg.SessionID, int64(userID), resumeMsg.ResumeToken)
+			if err != nil {
+				h.sendError(conn, msg.SessionID, err.Error())
+				continue
+			}
+
+			sessionID = resp.SessionID
+			isCallActive = true
+
+			// 注册新连接并补发断线期间未送达的消息，与AI回复的投递互斥，补发期间产生的回复排在其后
+			lock := h.deliveryLock(sessionID)
+			lock.Lock()
+			pending := h.attachConnection(sessionID, conn)
+
+			h.sendMessage(conn, WebSocketMessage{
+				Type:      "call_resumed",
+				SessionID: sessionID,
+				Data: map[string]interface{}{
+					"session_id":   resp.SessionID,
+					"resume_token": resp.ResumeToken,
+					"is_recording": resp.IsRecording,
+					"replayed":     len(pending),
+				},
+			})
+			for _, pendingMsg := range pending {
+				h.sendMessage(conn, pendingMsg)
+			}
+			lock.Unlock()
+			log.Printf("语音会话已恢复: sessionID=%s, 补发消息%d条", sessionID, len(pending))
 
 		case "audio_chunk":
 			// 处理音频分片
@@ -350,6 +461,8 @@ func (h *StreamingVoiceCallHandler) HandleWebSocket(c *gin.Context) {
 					})
 				}
 				isCallActive = false
+				h.detachConnection(sessionID, conn)
+				h.dropPendingMessages(sessionID)
 			}
 
 		case "ping":
@@ -361,23 +474,21 @@ func (h *StreamingVoiceCallHandler) HandleWebSocket(c *gin.Context) {
 		}
 	}
 
-	// 清理会话和连接
+	// 连接断开：会话进入重连宽限期，而不是立即结束
 	if isCallActive && sessionID != "" {
-		h.streamingService.StopStreamingCall(sessionID)
-
-		// 从活跃连接中移除
-		h.mu.Lock()
-		delete(h.activeConnections, sessionID)
-		h.mu.Unlock()
+		if h.detachConnection(sessionID, conn) {
+			h.streamingService.DetachSession(sessionID)
+		}
 	}
 }
 
 // sendMessage 发送消息
-func (h *StreamingVoiceCallHandler) sendMessage(conn *websocket.Conn, msg WebSocketMessage) {
+func (h *StreamingVoiceCallHandler) sendMessage(conn *websocket.Conn, msg WebSocketMessage) error {
 	err := conn.WriteJSON(msg)
 	if err != nil {
 		log.Printf("Failed to send WebSocket message: %v", err)
 	}
+	return err
 }
 
 // sendError 发送错误消息
@@ -404,5 +515,58 @@ func (h *StreamingVoiceCallHandler) GetSessionStatus(c *gin.Context) {
 		"is_active":    session.IsActive,
 		"user_id":      session.UserID,
 		"character_id": session.CharacterID,
+		"companion_id": session.CompanionID,
+	})
+}
+
+// GetCallHistory 获取用户的语音通话历史
+func (h *StreamingVoiceCallHandler) GetCallHistory(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	calls, err := h.streamingService.ListVoiceCalls(userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通话记录失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    calls,
+	})
+}
+
+// GetCallRecording 下载用户自己的通话录音
+func (h *StreamingVoiceCallHandler) GetCallRecording(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	callID, err := strconv.Atoi(c.Param("callId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的通话ID"})
+		return
+	}
+
+	recording, size, err := h.streamingService.OpenRecording(userID, callID)
+	if errors.Is(err, services.ErrRecordingNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通话录音失败: " + err.Error()})
+		return
+	}
+	defer recording.Close()
+
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, size, "audio/wav", recording, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="call_%d.wav"`, callID),
 	})
 }
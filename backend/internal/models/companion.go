@@ -27,6 +27,8 @@ type AICompanion struct {
 	LearnedVocabulary    json.RawMessage `json:"learned_vocabulary" db:"learned_vocabulary"`
 	MemorySummary        string          `json:"memory_summary" db:"memory_summary"`
 	IsGrowthCompleted    bool            `json:"is_growth_completed" db:"is_growth_completed"`
+	IsDefault            bool            `json:"is_default" db:"is_default"`   // 是否为默认AI伙伴
+	ArchivedAt           *time.Time      `json:"archived_at" db:"archived_at"` // 归档时间，未归档为空
 	LastActiveAt         time.Time       `json:"last_active_at" db:"last_active_at"`
 	CreatedAt            time.Time       `json:"created_at" db:"created_at"`
 	UpdatedAt            time.Time       `json:"updated_at" db:"updated_at"`
@@ -34,11 +36,21 @@ type AICompanion struct {
 
 // CompanionSkill AI伙伴技能
 type CompanionSkill struct {
-	ID          int       `json:"id" db:"id"`
-	CompanionID int       `json:"companion_id" db:"companion_id"`
-	SkillName   string    `json:"skill_name" db:"skill_name"`
-	SkillLevel  int       `json:"skill_level" db:"skill_level"`
-	UnlockedAt  time.Time `json:"unlocked_at" db:"unlocked_at"`
+	ID          int        `json:"id" db:"id"`
+	CompanionID int        `json:"companion_id" db:"companion_id"`
+	SkillName   string     `json:"skill_name" db:"skill_name"`
+	Description string     `json:"description"`                    // 技能说明，来自技能目录
+	SkillLevel  int        `json:"skill_level" db:"skill_level"`   // 技能等级 (1-10)，随使用次数提升
+	UseCount    int        `json:"use_count" db:"use_count"`       // 使用次数
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"` // 最近一次使用时间
+	UnlockedAt  time.Time  `json:"unlocked_at" db:"unlocked_at"`
+}
+
+// LockedSkill 尚未解锁的技能及解锁条件
+type LockedSkill struct {
+	SkillName   string `json:"skill_name"`
+	Description string `json:"description"`
+	Requirement string `json:"requirement"` // 解锁条件说明
 }
 
 // MemoryFragment 记忆片段
@@ -49,7 +61,42 @@ type MemoryFragment struct {
 	Content         string          `json:"content" db:"content"`
 	ImportanceScore int             `json:"importance_score" db:"importance_score"`
 	Tags            json.RawMessage `json:"tags" db:"tags"`
+	MentionCount    int             `json:"mention_count" db:"mention_count"`   // 被对话提及（合并）的次数
+	IsUserEdited    bool            `json:"is_user_edited" db:"is_user_edited"` // 用户修改过，自动提取不再覆盖内容
 	CreatedAt       time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// MemoryListRequest 记忆片段列表查询参数
+type MemoryListRequest struct {
+	MemoryType string `form:"memory_type" binding:"omitempty,oneof=event preference emotion lesson user_trait"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=200"`
+}
+
+// RecalledMemory 为一次回复检索到的记忆及其打分
+type RecalledMemory struct {
+	MemoryID   int     `json:"memory_id"`
+	MemoryType string  `json:"memory_type"`
+	Content    string  `json:"content"`    // 检索时的记忆内容（之后可能被修改或删除）
+	Relevance  float64 `json:"relevance"`  // 与用户消息的相关度 (0-1)
+	Importance float64 `json:"importance"` // 重要性 (0-1)
+	Recency    float64 `json:"recency"`    // 新近程度 (0-1)
+	Score      float64 `json:"score"`      // 综合得分
+	Rank       int     `json:"rank"`       // 在提示词中的顺序，从1开始
+}
+
+// MessageMemories 生成某条回复时使用的记忆
+type MessageMemories struct {
+	MessageID int              `json:"message_id"`
+	Memories  []RecalledMemory `json:"memories"`
+}
+
+// UpdateMemoryRequest 用户修正记忆片段的请求，未提供的字段保持不变
+type UpdateMemoryRequest struct {
+	MemoryType      string   `json:"memory_type" binding:"omitempty,oneof=event preference emotion lesson user_trait"`
+	Content         string   `json:"content"`
+	ImportanceScore int      `json:"importance_score" binding:"omitempty,min=1,max=10"`
+	Tags            []string `json:"tags"`
 }
 
 // CompanionDiary 日记
@@ -112,19 +159,73 @@ type CompanionChatResponse struct {
 
 // GrowthProgressResponse 成长进度响应
 type GrowthProgressResponse struct {
-	CompanionID       int     `json:"companion_id"`
-	GrowthPercentage  float64 `json:"growth_percentage"`
-	CurrentLevel      int     `json:"current_level"`
-	TotalExperience   int     `json:"total_experience"`
-	IsGrowthCompleted bool    `json:"is_growth_completed"`
-	NextMilestone     string  `json:"next_milestone"`
+	CompanionID       int               `json:"companion_id"`
+	GrowthPercentage  float64           `json:"growth_percentage"`
+	CurrentLevel      int               `json:"current_level"`
+	TotalExperience   int               `json:"total_experience"`
+	IsGrowthCompleted bool              `json:"is_growth_completed"`
+	NextMilestone     string            `json:"next_milestone"`
+	LevelProgress     float64           `json:"level_progress"`     // 当前等级内的进度 (0-100)
+	ExperienceToNext  int               `json:"experience_to_next"` // 距下一级还需的经验，满级为0
+	MaxLevel          int               `json:"max_level"`          // 当前成长模式的最高等级
+	Milestones        []GrowthMilestone `json:"milestones"`
+	Skills            []CompanionSkill  `json:"skills"`        // 已解锁的技能
+	LockedSkills      []LockedSkill     `json:"locked_skills"` // 未解锁的技能
+}
+
+// GrowthMilestone 成长里程碑及是否已达成
+type GrowthMilestone struct {
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Progress    float64 `json:"progress"` // 达成所需的整体成长进度 (0-100)
+	Reached     bool    `json:"reached"`
 }
 
 // EmotionState 情绪状态
 type EmotionState struct {
-	Emotion       string  `json:"emotion"`        // 情绪类型
-	Intensity     float64 `json:"intensity"`      // 情绪强度 (0-1)
-	Color         string  `json:"color"`          // 对应颜色
-	Brightness    float64 `json:"brightness"`     // 亮度 (0-1)
-	ParticleSpeed float64 `json:"particle_speed"` // 粒子速度 (0-1)
+	Emotion       string    `json:"emotion"`        // 情绪类型
+	Intensity     float64   `json:"intensity"`      // 情绪强度 (0-1)
+	Color         string    `json:"color"`          // 对应颜色
+	Brightness    float64   `json:"brightness"`     // 亮度 (0-1)
+	ParticleSpeed float64   `json:"particle_speed"` // 粒子速度 (0-1)
+	Valence       float64   `json:"valence"`        // 效价 (-1消极 ~ 1积极)
+	Arousal       float64   `json:"arousal"`        // 唤醒度 (0平静 ~ 1激动)
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// EmotionHistoryRequest 情绪历史查询参数
+type EmotionHistoryRequest struct {
+	Days  int `form:"days"`  // 最近几天，默认7，最多90
+	Limit int `form:"limit"` // 最多返回的记录数，默认1000
+}
+
+// EmotionHistoryPoint 一次情绪变化记录
+type EmotionHistoryPoint struct {
+	Emotion   string    `json:"emotion"`
+	Stimulus  string    `json:"stimulus"` // 引起变化的消息情绪
+	Intensity float64   `json:"intensity"`
+	Valence   float64   `json:"valence"`
+	Arousal   float64   `json:"arousal"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GrowthEventListRequest 成长事件查询参数
+type GrowthEventListRequest struct {
+	EventType string `form:"type"`  // experience 或 ability，为空时返回全部
+	Limit     int    `form:"limit"` // 最多返回的记录数，默认50，最多200
+}
+
+// GrowthEvent 一次经验结算或能力变化，记录防刷调整的依据
+type GrowthEvent struct {
+	ID              int       `json:"id"`
+	CompanionID     int       `json:"companion_id"`
+	EventType       string    `json:"event_type"`        // experience 或 ability
+	Ability         string    `json:"ability,omitempty"` // 能力事件对应的能力
+	BaseValue       int       `json:"base_value"`        // 调整前的经验或能力增量
+	FinalValue      int       `json:"final_value"`       // 实际生效的增量
+	QualityScore    float64   `json:"quality_score"`     // 对话质量分 (0-1)
+	DailyMultiplier float64   `json:"daily_multiplier"`  // 每日边际递减系数，能力事件为0
+	Reasons         []string  `json:"reasons"`           // 调整原因
+	CreatedAt       time.Time `json:"created_at"`
 }
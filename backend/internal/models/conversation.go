@@ -18,30 +18,54 @@ type Conversation struct {
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
 }
 
+// ChatTarget 聊天对象：预设角色或用户的AI伙伴，二者有且只有一个非零
+type ChatTarget struct {
+	CharacterID int `json:"character_id" form:"character_id" binding:"min=0"`
+	CompanionID int `json:"companion_id" form:"companion_id" binding:"min=0"`
+}
+
+// IsCompanion 是否是与AI伙伴的聊天
+func (t ChatTarget) IsCompanion() bool {
+	return t.CompanionID > 0
+}
+
+// Valid 是否恰好指定了角色或AI伙伴之一
+func (t ChatTarget) Valid() bool {
+	return (t.CharacterID > 0) != (t.CompanionID > 0)
+}
+
+// IsZero 是否未指定任何聊天对象（用于可选的过滤条件）
+func (t ChatTarget) IsZero() bool {
+	return t.CharacterID == 0 && t.CompanionID == 0
+}
+
 type ChatRequest struct {
-	CharacterID int    `json:"character_id" binding:"min=0"` // 允许0值（AI伙伴）
-	Message     string `json:"message" binding:"required"`
-	SessionID   string `json:"session_id"`
+	ChatTarget
+	Message   string `json:"message" binding:"required"`
+	SessionID string `json:"session_id"`
 }
 
 type ChatResponse struct {
-	Response  string `json:"response"`
-	SessionID string `json:"session_id"`
-	Character string `json:"character"`
-	MessageID int    `json:"message_id"`
+	Response       string   `json:"response"`
+	SessionID      string   `json:"session_id"`
+	Character      string   `json:"character"`
+	MessageID      int      `json:"message_id"`
+	ExperienceGain int      `json:"experience_gain,omitempty"` // AI伙伴本轮获得的经验
+	LevelUp        bool     `json:"level_up,omitempty"`        // AI伙伴本轮是否升级
+	NewSkills      []string `json:"new_skills,omitempty"`      // AI伙伴本轮解锁的技能
 }
 
 type VoiceChatRequest struct {
-	CharacterID int    `json:"character_id" binding:"required"`
-	AudioData   string `json:"audio_data" binding:"required"`
-	SessionID   string `json:"session_id"`
+	ChatTarget
+	AudioData string `json:"audio_data" binding:"required"`
+	SessionID string `json:"session_id"`
 }
 
 type ImageChatRequest struct {
-	CharacterID int    `json:"character_id" binding:"required"`
-	ImageData   string `json:"image_data" binding:"required"`
-	Message     string `json:"message"`
-	SessionID   string `json:"session_id"`
+	ChatTarget
+	ImageData string `json:"image_data" binding:"required"`
+	Message   string `json:"message"`
+	SessionID string `json:"session_id"`
 }
 
 type ConversationHistory struct {
@@ -50,4 +74,152 @@ type ConversationHistory struct {
 	AIResponse  string    `json:"ai_response"`
 	MessageType string    `json:"message_type"`
 	CreatedAt   time.Time `json:"created_at"`
+	// 编辑与重新生成
+	EditedAt         *time.Time `json:"edited_at,omitempty"`
+	AlternativeCount int        `json:"alternative_count"` // AI回复的候选数量，大于1时可切换
+}
+
+// ConversationReply AI回复的一个候选版本
+type ConversationReply struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	AIResponse     string    `json:"ai_response"`
+	IsSelected     bool      `json:"is_selected"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// MessageAlternatives 一条消息及其全部AI回复候选
+type MessageAlternatives struct {
+	MessageID       int                 `json:"message_id"`
+	UserMessage     string              `json:"user_message"`
+	AIResponse      string              `json:"ai_response"`
+	SelectedReplyID int                 `json:"selected_reply_id"`
+	EditedAt        *time.Time          `json:"edited_at,omitempty"`
+	Alternatives    []ConversationReply `json:"alternatives"`
+}
+
+// EditMessageRequest 编辑用户消息请求
+type EditMessageRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// ChatSession 聊天会话
+type ChatSession struct {
+	ID           string    `json:"id" db:"id"`
+	UserID       int       `json:"user_id" db:"user_id"`
+	CharacterID  int       `json:"character_id" db:"character_id"` // 预设角色ID，AI伙伴会话为0
+	CompanionID  *int      `json:"companion_id" db:"companion_id"`
+	Title        string    `json:"title" db:"title"`
+	IsArchived   bool      `json:"is_archived" db:"is_archived"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	LastActiveAt time.Time `json:"last_active_at" db:"last_active_at"`
+	// 统计字段
+	MessageCount int `json:"message_count"`
+	UnreadCount  int `json:"unread_count"`
+}
+
+// CreateChatSessionRequest 创建聊天会话请求
+type CreateChatSessionRequest struct {
+	ChatTarget
+	Title string `json:"title" binding:"max=100"`
+}
+
+// UpdateChatSessionRequest 更新聊天会话请求（重命名、归档）
+type UpdateChatSessionRequest struct {
+	Title      *string `json:"title" binding:"omitempty,max=100"`
+	IsArchived *bool   `json:"is_archived"`
+}
+
+// 历史记录分页方向
+const (
+	HistoryDirectionBackward = "backward" // 从最新消息往前翻页
+	HistoryDirectionForward  = "forward"  // 从最早消息往后翻页
+)
+
+// HistoryPageRequest 历史记录游标分页参数
+type HistoryPageRequest struct {
+	Before    int    `form:"before"`    // 加载该消息之前（更早）的消息
+	After     int    `form:"after"`     // 加载该消息之后（更新）的消息
+	Around    int    `form:"around"`    // 加载该消息及其前后的消息（用于搜索结果定位）
+	Limit     int    `form:"limit"`     // 每页条数
+	Direction string `form:"direction"` // 未指定游标时的起点方向
+}
+
+// HistoryPage 历史记录分页结果，Messages始终按时间升序排列
+type HistoryPage struct {
+	Messages     []ConversationHistory `json:"messages"`
+	HasMore      bool                  `json:"has_more"`      // 翻页方向上是否还有更多消息
+	BeforeCursor int                   `json:"before_cursor"` // 本页最早一条消息ID
+	AfterCursor  int                   `json:"after_cursor"`  // 本页最新一条消息ID
+	Total        int                   `json:"total"`         // 符合条件的消息总数
+	Unread       int                   `json:"unread"`        // 未读消息数
+}
+
+// ConversationSearchRequest 聊天记录搜索参数
+type ConversationSearchRequest struct {
+	Query       string `form:"q" binding:"required"`
+	CharacterID int    `form:"character_id"` // 按角色过滤，0表示全部
+	CompanionID int    `form:"companion_id"` // 按AI伙伴过滤，0表示全部
+	MessageType string `form:"message_type"` // 按消息类型过滤
+	From        string `form:"from"`         // 起始日期（YYYY-MM-DD）
+	To          string `form:"to"`           // 截止日期（YYYY-MM-DD，含当天）
+	Mode        string `form:"mode"`         // keyword（默认）或semantic
+	Limit       int    `form:"limit"`
+	Offset      int    `form:"offset"`
+}
+
+// ConversationSearchResult 聊天记录搜索结果
+type ConversationSearchResult struct {
+	MessageID     int       `json:"message_id"`
+	SessionID     string    `json:"session_id"`
+	CharacterID   int       `json:"character_id"`
+	CompanionID   *int      `json:"companion_id"`
+	CharacterName string    `json:"character_name"`
+	MessageType   string    `json:"message_type"`
+	MatchedField  string    `json:"matched_field"` // user_message 或 ai_response
+	Snippet       string    `json:"snippet"`       // 命中位置附近的片段
+	Highlights    [][2]int  `json:"highlights"`    // 片段中命中词的位置（按字符计，左闭右开）
+	ContextURL    string    `json:"context_url"`   // 查看上下文的接口地址
+	Score         float64   `json:"score"`         // 全文检索相关度或语义相似度
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// 聊天记录导出格式
+const (
+	ExportFormatMarkdown = "md"
+	ExportFormatJSON     = "json"
+	ExportFormatHTML     = "html"
+)
+
+// ConversationExportRequest 聊天记录导出参数
+type ConversationExportRequest struct {
+	Format      string `form:"format"`       // md、json或html，默认md
+	CharacterID int    `form:"character_id"` // 只导出指定角色
+	CompanionID int    `form:"companion_id"` // 只导出指定AI伙伴，都为0时导出全部（打包为zip）
+}
+
+// MarkReadRequest 标记已读请求，按会话或角色标记
+type MarkReadRequest struct {
+	ChatTarget
+	SessionID     string `json:"session_id"`
+	UpToMessageID int    `json:"up_to_message_id" binding:"min=0"` // 只标记到该消息为止，0表示全部
+}
+
+// MarkReadResult 标记已读结果
+type MarkReadResult struct {
+	ChatTarget
+	Marked int `json:"marked"` // 本次标记的消息数
+	Unread int `json:"unread"` // 该聊天对象剩余未读数
+}
+
+// UnreadCount 单个角色或AI伙伴的未读消息数
+type UnreadCount struct {
+	ChatTarget
+	Unread int `json:"unread"`
+}
+
+// UnreadSummary 用户的未读消息汇总
+type UnreadSummary struct {
+	Total      int           `json:"total"`
+	Characters []UnreadCount `json:"characters"`
 }
@@ -8,19 +8,20 @@ type UserFriendship struct {
 	CharacterID   int        `json:"character_id" db:"character_id"`
 	IsActive      bool       `json:"is_active" db:"is_active"`
 	LastMessageAt *time.Time `json:"last_message_at" db:"last_message_at"`
-	UnreadCount   int        `json:"unread_count" db:"unread_count"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 type FriendInfo struct {
 	ID                   int        `json:"id"`
-	CharacterID          int        `json:"character_id"`
+	CharacterID          int        `json:"character_id"`           // 预设角色ID，AI伙伴为0
+	CompanionID          int        `json:"companion_id,omitempty"` // AI伙伴ID
 	Name                 string     `json:"name"`
 	AvatarURL            string     `json:"avatar_url"`
 	PersonalitySignature string     `json:"personality_signature"`
 	LastMessage          string     `json:"last_message"`
 	LastMessageAt        *time.Time `json:"last_message_at"`
+	UnreadCount          int        `json:"unread_count"` // 未读消息数（含AI主动发来的消息）
 	IsOnline             bool       `json:"is_online"`
 	Type                 string     `json:"type"` // "character" 或 "companion"
 	// AI伙伴特有字段
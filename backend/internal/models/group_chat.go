@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// GroupChat 多角色群聊
+type GroupChat struct {
+	ID           int           `json:"id" db:"id"`
+	UserID       int           `json:"user_id" db:"user_id"`
+	Title        string        `json:"title" db:"title"`
+	Members      []GroupMember `json:"members"`
+	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
+	LastActiveAt time.Time     `json:"last_active_at" db:"last_active_at"`
+}
+
+// GroupMember 群聊中的成员，预设角色或AI伙伴
+type GroupMember struct {
+	ChatTarget
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// GroupMessage 群聊消息，speaker_type为user时character_id和companion_id都为空
+type GroupMessage struct {
+	ID            int       `json:"id" db:"id"`
+	GroupID       int       `json:"group_id" db:"group_id"`
+	SpeakerType   string    `json:"speaker_type" db:"speaker_type"` // user 或 character
+	CharacterID   *int      `json:"character_id" db:"character_id"`
+	CompanionID   *int      `json:"companion_id" db:"companion_id"`
+	CharacterName string    `json:"character_name,omitempty"`
+	Content       string    `json:"content" db:"content"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// CreateGroupChatRequest 创建群聊请求，角色和AI伙伴合计2到6个
+type CreateGroupChatRequest struct {
+	Title        string `json:"title" binding:"max=100"`
+	CharacterIDs []int  `json:"character_ids" binding:"max=6"`
+	CompanionIDs []int  `json:"companion_ids" binding:"max=6"`
+}
+
+// Speaker 消息的发言者，用户发言时返回空值
+func (m GroupMessage) Speaker() ChatTarget {
+	var t ChatTarget
+	if m.CharacterID != nil {
+		t.CharacterID = *m.CharacterID
+	}
+	if m.CompanionID != nil {
+		t.CompanionID = *m.CompanionID
+	}
+	return t
+}
+
+// GroupChatRequest 群聊发言请求
+type GroupChatRequest struct {
+	Message string `json:"message" binding:"required"`
+}
+
+// GroupChatResponse 群聊发言结果：用户消息和本轮各角色的回复
+type GroupChatResponse struct {
+	UserMessage GroupMessage   `json:"user_message"`
+	Replies     []GroupMessage `json:"replies"`
+}
@@ -33,3 +33,28 @@ type UserResponse struct {
 	AvatarURL string    `json:"avatar_url"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// UserPreferences 用户偏好设置
+type UserPreferences struct {
+	UserID                 int    `json:"user_id" db:"user_id"`
+	VoiceEnabled           bool   `json:"voice_enabled" db:"voice_enabled"`
+	AutoSaveMemories       bool   `json:"auto_save_memories" db:"auto_save_memories"`
+	NotificationEnabled    bool   `json:"notification_enabled" db:"notification_enabled"`
+	LanguagePreference     string `json:"language_preference" db:"language_preference"`
+	RecordingRetentionDays int    `json:"recording_retention_days" db:"recording_retention_days"` // 通话录音保留天数，0表示永久保留
+	QuietHoursStart        int    `json:"quiet_hours_start" db:"quiet_hours_start"`               // 免打扰开始时间（小时，0-23）
+	QuietHoursEnd          int    `json:"quiet_hours_end" db:"quiet_hours_end"`                   // 免打扰结束时间（小时，0-23），与开始相同表示不启用
+	Timezone               string `json:"timezone" db:"timezone"`                                 // 用户所在时区，用于免打扰和早安问候
+}
+
+// UpdatePreferencesRequest 更新用户偏好设置请求（未传的字段保持不变）
+type UpdatePreferencesRequest struct {
+	VoiceEnabled           *bool   `json:"voice_enabled"`
+	AutoSaveMemories       *bool   `json:"auto_save_memories"`
+	NotificationEnabled    *bool   `json:"notification_enabled"`
+	LanguagePreference     *string `json:"language_preference"`
+	RecordingRetentionDays *int    `json:"recording_retention_days" binding:"omitempty,min=0,max=3650"`
+	QuietHoursStart        *int    `json:"quiet_hours_start" binding:"omitempty,min=0,max=23"`
+	QuietHoursEnd          *int    `json:"quiet_hours_end" binding:"omitempty,min=0,max=23"`
+	Timezone               *string `json:"timezone"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 语音通话状态
+const (
+	VoiceCallStatusInitiated = "initiated"
+	VoiceCallStatusAnswered  = "answered"
+	VoiceCallStatusEnded     = "ended"
+	VoiceCallStatusMissed    = "missed"
+)
+
+// VoiceCall 语音通话记录
+type VoiceCall struct {
+	ID              int        `json:"id" db:"id"`
+	UserID          int        `json:"user_id" db:"user_id"`
+	CharacterID     *int       `json:"character_id" db:"character_id"`
+	CompanionID     *int       `json:"companion_id" db:"companion_id"`
+	SessionID       string     `json:"session_id" db:"session_id"`
+	CallType        string     `json:"call_type" db:"call_type"`
+	Status          string     `json:"status" db:"status"`
+	DurationSeconds int        `json:"duration_seconds" db:"duration_seconds"`
+	AudioFileURL    string     `json:"audio_file_url" db:"audio_file_url"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	AnsweredAt      *time.Time `json:"answered_at" db:"answered_at"`
+	EndedAt         *time.Time `json:"ended_at" db:"ended_at"`
+	// 统计字段
+	TurnCount        int `json:"turn_count"`
+	AvgTurnLatencyMs int `json:"avg_turn_latency_ms"`
+}
+
+// VoiceCallTurn 语音通话中一轮对话的耗时
+type VoiceCallTurn struct {
+	ID          int       `json:"id" db:"id"`
+	VoiceCallID int       `json:"voice_call_id" db:"voice_call_id"`
+	ASRMs       int       `json:"asr_ms" db:"asr_ms"`
+	LLMMs       int       `json:"llm_ms" db:"llm_ms"`
+	TTSMs       int       `json:"tts_ms" db:"tts_ms"`
+	TotalMs     int       `json:"total_ms" db:"total_ms"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
@@ -15,10 +15,11 @@ import (
 
 // AIService AI服务，处理LLM对话、语音识别和语音合成
 type AIService struct {
-	apiKey  string       // API密钥
-	baseURL string       // API基础URL
-	model   string       // 使用的模型名称
-	client  *http.Client // HTTP客户端
+	apiKey   string       // API密钥
+	baseURL  string       // API基础URL
+	model    string       // 使用的模型名称
+	client   *http.Client // HTTP客户端
+	ttsCache *TTSCache    // TTS音频缓存，可为nil
 }
 
 // ChatRequest LLM对话请求结构
@@ -126,8 +127,16 @@ func NewAIService(apiKey, baseURL, model string) *AIService {
 	}
 }
 
+// defaultChatMaxTokens 聊天回复的最大token数，保持回复简短，适合语音通话
+const defaultChatMaxTokens = 40
+
 // ChatWithLLM 与LLM进行对话
 func (s *AIService) ChatWithLLM(messages []Message, model string, temperature float64, messageType string) (string, error) {
+	return s.ChatWithLLMMaxTokens(messages, model, temperature, messageType, defaultChatMaxTokens)
+}
+
+// ChatWithLLMMaxTokens 与LLM进行对话，可指定回复的最大token数（用于摘要等较长输出）
+func (s *AIService) ChatWithLLMMaxTokens(messages []Message, model string, temperature float64, messageType string, maxTokens int) (string, error) {
 	// 处理表情消息
 	messages = s.processEmojiMessages(messages)
 
@@ -156,7 +165,7 @@ func (s *AIService) ChatWithLLM(messages []Message, model string, temperature fl
 		Model:       usedModel,
 		Messages:    messages,
 		Temperature: temperature,
-		MaxTokens:   40, // 减少到40，让AI生成更简洁的回复，适合语音通话
+		MaxTokens:   maxTokens,
 	}
 
 	reqBody, err := json.Marshal(req)
@@ -535,6 +544,20 @@ func (s *AIService) getNoiseResponseForCharacter(characterName string) string {
 	}
 }
 
+// SetTTSCache 设置TTS音频缓存
+func (s *AIService) SetTTSCache(cache *TTSCache) {
+	s.ttsCache = cache
+}
+
+// TTSCacheStats 获取TTS缓存统计，未启用缓存时返回nil
+func (s *AIService) TTSCacheStats() *TTSCacheStats {
+	if s.ttsCache == nil {
+		return nil
+	}
+	stats := s.ttsCache.Stats()
+	return &stats
+}
+
 // GetAPIKey 获取API密钥
 func (s *AIService) GetAPIKey() string {
 	return s.apiKey
@@ -542,16 +565,47 @@ func (s *AIService) GetAPIKey() string {
 
 // TextToSpeech 文字转语音 (TTS)
 func (s *AIService) TextToSpeech(text string, characterName string) ([]byte, error) {
-	start := time.Now()
+	return s.TextToSpeechWithProfile(text, s.voiceProfileForCharacter(characterName))
+}
 
+// voiceProfileForCharacter 根据角色选择音色和语速
+func (s *AIService) voiceProfileForCharacter(characterName string) TTSVoiceProfile {
+	return TTSVoiceProfile{
+		VoiceType:  s.getVoiceTypeForCharacter(characterName),
+		SpeedRatio: s.getSpeedRatioForCharacter(characterName),
+		Encoding:   "mp3",
+	}
+}
+
+// TextToSpeechWithProfile 使用指定音色参数进行文字转语音，优先读取缓存
+func (s *AIService) TextToSpeechWithProfile(text string, profile TTSVoiceProfile) ([]byte, error) {
 	// 限制文本长度，提高TTS速度
 	if len([]rune(text)) > 100 {
 		text = string([]rune(text)[:100]) + "..."
 	}
 
-	// 根据角色选择音色和语速
-	voiceType := s.getVoiceTypeForCharacter(characterName)
-	speedRatio := s.getSpeedRatioForCharacter(characterName)
+	var cacheKey string
+	if s.ttsCache != nil {
+		cacheKey = TTSCacheKey(text, profile)
+		if audioData, ok := s.ttsCache.Get(cacheKey); ok {
+			return audioData, nil
+		}
+	}
+
+	audioData, err := s.synthesizeSpeech(text, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.ttsCache != nil {
+		s.ttsCache.Put(cacheKey, audioData)
+	}
+	return audioData, nil
+}
+
+// synthesizeSpeech 调用TTS接口合成语音
+func (s *AIService) synthesizeSpeech(text string, profile TTSVoiceProfile) ([]byte, error) {
+	start := time.Now()
 
 	req := TTSRequest{
 		Audio: struct {
@@ -559,9 +613,9 @@ func (s *AIService) TextToSpeech(text string, characterName string) ([]byte, err
 			Encoding   string  `json:"encoding"`
 			SpeedRatio float64 `json:"speed_ratio"`
 		}{
-			VoiceType:  voiceType,
-			Encoding:   "mp3",
-			SpeedRatio: speedRatio,
+			VoiceType:  profile.VoiceType,
+			Encoding:   profile.Encoding,
+			SpeedRatio: profile.SpeedRatio,
 		},
 		Request: struct {
 			Text      string `json:"text"`
@@ -704,6 +758,18 @@ func (s *AIService) IsEmojiMessage(content string) bool {
 
 // convertPCMToWAV 将PCM数据转换为WAV格式
 func (s *AIService) convertPCMToWAV(pcmData []byte) ([]byte, error) {
+	header := pcmWAVHeader(len(pcmData))
+
+	// 合并头部和PCM数据
+	wavData := make([]byte, len(header)+len(pcmData))
+	copy(wavData, header)
+	copy(wavData[len(header):], pcmData)
+
+	return wavData, nil
+}
+
+// pcmWAVHeader 生成16kHz/16bit/单声道PCM的WAV文件头，dataSize为PCM字节数
+func pcmWAVHeader(dataSize int) []byte {
 	// WAV文件头结构
 	const (
 		sampleRate    = 16000 // 采样率
@@ -711,8 +777,6 @@ func (s *AIService) convertPCMToWAV(pcmData []byte) ([]byte, error) {
 		bitsPerSample = 16    // 16位
 	)
 
-	// 计算数据大小
-	dataSize := len(pcmData)
 	fileSize := 36 + dataSize
 
 	// 创建WAV文件头
@@ -755,10 +819,5 @@ func (s *AIService) convertPCMToWAV(pcmData []byte) ([]byte, error) {
 	header[42] = byte(dataSize >> 16)
 	header[43] = byte(dataSize >> 24)
 
-	// 合并头部和PCM数据
-	wavData := make([]byte, len(header)+len(pcmData))
-	copy(wavData, header)
-	copy(wavData[len(header):], pcmData)
-
-	return wavData, nil
+	return header
 }
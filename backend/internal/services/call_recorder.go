@@ -0,0 +1,386 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"seven-ai-backend/internal/storage"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+const (
+	recordingSampleRate  = 16000            // 录音采样率，与前端上传的PCM一致
+	recordingMaxDuration = 60 * time.Minute // 单次通话录音上限
+	recordingKeyPrefix   = "recordings/"    // 录音在存储中的key前缀
+	recordingURLFormat   = "/api/v1/voice-calls/%d/recording"
+)
+
+// ErrRecordingNotFound 通话录音不存在或不属于当前用户
+var ErrRecordingNotFound = errors.New("通话录音不存在")
+
+// CallRecorder 通话录音器，将用户PCM和角色TTS按时间轴对齐后直接混入磁盘上的临时文件，
+// 不在内存中保留整通电话的音频
+type CallRecorder struct {
+	mu         sync.Mutex
+	startedAt  time.Time
+	file       *os.File // 混音后的PCM（16kHz/16bit/单声道），关闭后为nil
+	length     int      // 已写入的采样点数
+	userCursor int      // 用户音轨已写到的采样点，保证连续分片不重叠
+}
+
+// NewCallRecorder 创建通话录音器
+func NewCallRecorder(startedAt time.Time) (*CallRecorder, error) {
+	file, err := os.CreateTemp("", "call-recording-*.pcm")
+	if err != nil {
+		return nil, fmt.Errorf("创建录音临时文件失败: %w", err)
+	}
+	return &CallRecorder{startedAt: startedAt, file: file}, nil
+}
+
+// AddUserAudio 添加用户上传的PCM分片（16kHz/16bit/单声道），receivedAt为分片到达时间
+func (r *CallRecorder) AddUserAudio(pcm []byte, receivedAt time.Time) {
+	samples := pcmBytesToSamples(pcm)
+	if len(samples) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 分片在到达时刻录制完成，起点往前推一个分片时长
+	offset := r.sampleOffset(receivedAt) - len(samples)
+	if offset < r.userCursor {
+		offset = r.userCursor
+	}
+	if !r.fits(offset, len(samples)) {
+		return
+	}
+	if err := r.mixAt(offset, samples); err != nil {
+		log.Printf("录制用户语音失败: %v", err)
+		return
+	}
+	r.userCursor = offset + len(samples)
+}
+
+// AddCharacterAudio 添加角色TTS音频（MP3），playedAt为下发给前端的时间
+func (r *CallRecorder) AddCharacterAudio(mp3Data []byte, playedAt time.Time) error {
+	samples, err := decodeMP3ToMono16k(mp3Data)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	offset := r.sampleOffset(playedAt)
+	if !r.fits(offset, len(samples)) {
+		return nil
+	}
+	return r.mixAt(offset, samples)
+}
+
+// IsEmpty 是否没有录到任何音频
+func (r *CallRecorder) IsEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.length == 0
+}
+
+// WAV 返回完整通话录音的WAV数据流及其字节数，Close之前有效
+func (r *CallRecorder) WAV() (io.Reader, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dataSize := int64(r.length) * 2
+	header := pcmWAVHeader(int(dataSize))
+	if r.file == nil {
+		return bytes.NewReader(header), int64(len(header))
+	}
+	return io.MultiReader(bytes.NewReader(header), io.NewSectionReader(r.file, 0, dataSize)),
+		int64(len(header)) + dataSize
+}
+
+// Close 关闭并删除临时文件，之后写入的音频会被忽略
+func (r *CallRecorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	r.file.Close()
+	os.Remove(r.file.Name())
+	r.file = nil
+}
+
+// mixAt 将采样叠加到临时文件offset处，叠加后超出int16范围的截断
+func (r *CallRecorder) mixAt(offset int, samples []int16) error {
+	if r.file == nil {
+		return nil
+	}
+
+	buf := make([]byte, len(samples)*2)
+	if offset < r.length {
+		// 超出文件末尾的部分读不到，保持为静音
+		if _, err := r.file.ReadAt(buf, int64(offset)*2); err != nil && err != io.EOF {
+			return fmt.Errorf("读取录音临时文件失败: %w", err)
+		}
+	}
+	for i, sample := range samples {
+		v := int32(int16(binary.LittleEndian.Uint16(buf[i*2:]))) + int32(sample)
+		if v > 32767 {
+			v = 32767
+		} else if v < -32768 {
+			v = -32768
+		}
+		binary.LittleEndian.PutUint16(buf[i*2:], uint16(int16(v)))
+	}
+	if _, err := r.file.WriteAt(buf, int64(offset)*2); err != nil {
+		return fmt.Errorf("写入录音临时文件失败: %w", err)
+	}
+	if end := offset + len(samples); end > r.length {
+		r.length = end
+	}
+	return nil
+}
+
+// sampleOffset 将时间点换算为时间轴上的采样点
+func (r *CallRecorder) sampleOffset(at time.Time) int {
+	offset := int(at.Sub(r.startedAt).Seconds() * recordingSampleRate)
+	if offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+// fits 检查片段是否在录音时长上限内
+func (r *CallRecorder) fits(offset, length int) bool {
+	return offset+length <= int(recordingMaxDuration.Seconds())*recordingSampleRate
+}
+
+// pcmBytesToSamples 将小端16位PCM字节转换为采样数组
+func pcmBytesToSamples(pcm []byte) []int16 {
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	return samples
+}
+
+// decodeMP3ToMono16k 解码MP3并转换为16kHz单声道采样
+func decodeMP3ToMono16k(mp3Data []byte) ([]int16, error) {
+	decoder, err := mp3.NewDecoder(bytes.NewReader(mp3Data))
+	if err != nil {
+		return nil, fmt.Errorf("解码TTS音频失败: %w", err)
+	}
+
+	raw, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("读取TTS音频失败: %w", err)
+	}
+
+	// go-mp3 输出为16位双声道，先混为单声道
+	mono := make([]int16, len(raw)/4)
+	for i := range mono {
+		left := int32(int16(binary.LittleEndian.Uint16(raw[i*4:])))
+		right := int32(int16(binary.LittleEndian.Uint16(raw[i*4+2:])))
+		mono[i] = int16((left + right) / 2)
+	}
+
+	return resampleLinear(mono, decoder.SampleRate(), recordingSampleRate), nil
+}
+
+// resampleLinear 线性插值重采样
+func resampleLinear(samples []int16, fromRate, toRate int) []int16 {
+	if fromRate == toRate || len(samples) == 0 {
+		return samples
+	}
+
+	outLen := int(int64(len(samples)) * int64(toRate) / int64(fromRate))
+	out := make([]int16, outLen)
+	ratio := float64(fromRate) / float64(toRate)
+	for i := range out {
+		pos := float64(i) * ratio
+		idx := int(pos)
+		if idx >= len(samples)-1 {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := pos - float64(idx)
+		out[i] = int16(float64(samples[idx])*(1-frac) + float64(samples[idx+1])*frac)
+	}
+	return out
+}
+
+// saveRecording 保存通话录音，写入voice_calls.audio_file_url和user_files
+// 录音存放在不对外公开的录音存储中，key带随机串，只能通过鉴权接口按通话ID下载
+func (s *StreamingVoiceCallService) saveRecording(session *VoiceCallSession) {
+	session.mu.RLock()
+	recorder := session.Recorder
+	callID := session.CallID
+	userID := session.UserID
+	session.mu.RUnlock()
+
+	if recorder == nil {
+		return
+	}
+	defer recorder.Close()
+
+	if callID == 0 || recorder.IsEmpty() {
+		return
+	}
+	if s.recordingStore == nil {
+		log.Printf("未配置录音存储，跳过通话录音保存: callID=%d", callID)
+		return
+	}
+
+	key, err := newRecordingKey(userID)
+	if err != nil {
+		log.Printf("生成录音文件名失败: %v", err)
+		return
+	}
+	wav, size := recorder.WAV()
+	if _, err := s.recordingStore.PutReader(key, wav); err != nil {
+		log.Printf("保存通话录音失败: %v", err)
+		return
+	}
+
+	// 过期时间在清理时按用户当前的保留设置计算，这里不写expires_at
+	fileURL := fmt.Sprintf(recordingURLFormat, callID)
+	_, err = s.db.Exec(`
+		INSERT INTO user_files (user_id, file_name, file_type, file_size, file_url, mime_type, is_temporary, created_at)
+		VALUES (?, ?, 'audio', ?, ?, 'audio/wav', FALSE, NOW())
+	`, userID, key, size, fileURL)
+	if err != nil {
+		log.Printf("保存录音文件记录失败: %v", err)
+	}
+
+	_, err = s.db.Exec(`UPDATE voice_calls SET audio_file_url = ? WHERE id = ?`, fileURL, callID)
+	if err != nil {
+		log.Printf("更新通话录音地址失败: %v", err)
+	}
+
+	log.Printf("通话录音已保存: callID=%d, 大小=%d bytes", callID, size)
+}
+
+// newRecordingKey 生成不可猜测的录音存储key
+func newRecordingKey(userID int64) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d/%s.wav", recordingKeyPrefix, userID, hex.EncodeToString(buf)), nil
+}
+
+// OpenRecording 打开用户自己的通话录音，返回数据流和字节数
+func (s *StreamingVoiceCallService) OpenRecording(userID, callID int) (io.ReadCloser, int64, error) {
+	if s.recordingStore == nil {
+		return nil, 0, ErrRecordingNotFound
+	}
+
+	var key string
+	var size int64
+	err := s.db.QueryRow(`
+		SELECT f.file_name, f.file_size
+		FROM voice_calls vc
+		JOIN user_files f ON f.file_url = vc.audio_file_url AND f.user_id = vc.user_id
+		WHERE vc.id = ? AND vc.user_id = ? AND f.user_id = ? AND f.file_name LIKE 'recordings/%'
+		LIMIT 1
+	`, callID, userID, userID).Scan(&key, &size)
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询通话录音失败: %v", err)
+	}
+
+	file, err := s.recordingStore.Open(key)
+	if err == storage.ErrNotFound {
+		return nil, 0, ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return file, size, nil
+}
+
+// StartRecordingRetentionJanitor 启动后台任务，定期删除过期的通话录音
+func (s *StreamingVoiceCallService) StartRecordingRetentionJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.purgeExpiredRecordings(); err != nil {
+				log.Printf("清理过期录音失败: %v", err)
+			}
+		}
+	}()
+}
+
+// purgeExpiredRecordings 删除已过保留期的录音文件及其记录
+// 保留期按用户当前的偏好设置计算，修改设置后对已有录音同样生效，0表示永久保留
+func (s *StreamingVoiceCallService) purgeExpiredRecordings() error {
+	if s.recordingStore == nil {
+		return nil
+	}
+
+	rows, err := s.db.Query(`
+		SELECT f.id, f.file_name, f.file_url FROM user_files f
+		LEFT JOIN user_preferences p ON p.user_id = f.user_id
+		WHERE f.file_type = 'audio' AND f.file_name LIKE 'recordings/%'
+		  AND COALESCE(p.recording_retention_days, ?) > 0
+		  AND f.created_at < NOW() - INTERVAL COALESCE(p.recording_retention_days, ?) DAY
+		LIMIT 500
+	`, defaultRecordingRetentionDays, defaultRecordingRetentionDays)
+	if err != nil {
+		return fmt.Errorf("查询过期录音失败: %v", err)
+	}
+
+	type expiredFile struct {
+		id      int
+		key     string
+		fileURL string
+	}
+	var expired []expiredFile
+	for rows.Next() {
+		var f expiredFile
+		if err := rows.Scan(&f.id, &f.key, &f.fileURL); err != nil {
+			rows.Close()
+			return fmt.Errorf("扫描过期录音失败: %v", err)
+		}
+		expired = append(expired, f)
+	}
+	rows.Close()
+
+	for _, f := range expired {
+		if err := s.recordingStore.Delete(f.key); err != nil {
+			log.Printf("删除录音文件失败: %v", err)
+			continue
+		}
+		if _, err := s.db.Exec(`UPDATE voice_calls SET audio_file_url = NULL WHERE audio_file_url = ?`, f.fileURL); err != nil {
+			log.Printf("清除通话录音地址失败: %v", err)
+		}
+		if _, err := s.db.Exec(`DELETE FROM user_files WHERE id = ?`, f.id); err != nil {
+			log.Printf("删除录音文件记录失败: %v", err)
+		}
+	}
+
+	if len(expired) > 0 {
+		log.Printf("已清理过期通话录音: %d个", len(expired))
+	}
+	return nil
+}
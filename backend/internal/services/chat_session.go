@@ -0,0 +1,333 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"seven-ai-backend/internal/models"
+	"strings"
+)
+
+// ErrChatSessionNotFound 会话不存在或不属于当前用户
+var ErrChatSessionNotFound = errors.New("会话不存在")
+
+// ErrInvalidChatSession 传入的session_id属于其他聊天对象或已被其他用户占用
+var ErrInvalidChatSession = errors.New("无效的会话ID")
+
+// maxSessionTitleRunes 会话标题最大长度
+const maxSessionTitleRunes = 20
+
+// newChatSessionID 生成会话ID
+func newChatSessionID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return "s_" + hex.EncodeToString(buf), nil
+}
+
+// CreateSession 创建聊天会话
+func (s *ConversationService) CreateSession(userID int, req models.CreateChatSessionRequest) (*models.ChatSession, error) {
+	if !req.Valid() {
+		return nil, ErrInvalidChatTarget
+	}
+	if req.IsCompanion() {
+		if err := s.checkCompanionOwner(userID, req.CompanionID); err != nil {
+			return nil, err
+		}
+	}
+
+	sessionID, err := newChatSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.insertSession(sessionID, userID, req.ChatTarget, strings.TrimSpace(req.Title)); err != nil {
+		return nil, err
+	}
+	return s.GetSession(userID, sessionID)
+}
+
+// insertSession 写入会话记录
+func (s *ConversationService) insertSession(sessionID string, userID int, target models.ChatTarget, title string) error {
+	characterID, companionID := targetColumns(target)
+	_, err := s.db.Exec(`
+		INSERT INTO chat_sessions (id, user_id, character_id, companion_id, title, is_archived, created_at, last_active_at)
+		VALUES (?, ?, ?, ?, ?, FALSE, NOW(), NOW())
+	`, sessionID, userID, characterID, companionID, title)
+	if err != nil {
+		return fmt.Errorf("failed to create chat session: %w", err)
+	}
+	return nil
+}
+
+// GetSession 获取单个会话
+func (s *ConversationService) GetSession(userID int, sessionID string) (*models.ChatSession, error) {
+	var session models.ChatSession
+	var characterID, companionID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT cs.id, cs.user_id, cs.character_id, cs.companion_id, cs.title, cs.is_archived,
+		       cs.created_at, cs.last_active_at,
+		       (SELECT COUNT(*) FROM conversations c WHERE c.user_id = cs.user_id AND c.session_id = cs.id AND c.deleted_at IS NULL),
+		       (SELECT COUNT(*) FROM conversations c WHERE c.user_id = cs.user_id AND c.session_id = cs.id AND c.deleted_at IS NULL AND c.is_read = FALSE)
+		FROM chat_sessions cs
+		WHERE cs.id = ? AND cs.user_id = ?
+	`, sessionID, userID).Scan(
+		&session.ID, &session.UserID, &characterID, &companionID, &session.Title,
+		&session.IsArchived, &session.CreatedAt, &session.LastActiveAt, &session.MessageCount, &session.UnreadCount,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrChatSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat session: %w", err)
+	}
+
+	setSessionTarget(&session, characterID, companionID)
+	return &session, nil
+}
+
+// setSessionTarget 填充会话的聊天对象
+func setSessionTarget(session *models.ChatSession, characterID, companionID sql.NullInt64) {
+	session.CharacterID = int(characterID.Int64)
+	if companionID.Valid {
+		id := int(companionID.Int64)
+		session.CompanionID = &id
+	}
+}
+
+// ListSessions 获取用户的会话列表，target为空时返回全部角色和AI伙伴的会话
+func (s *ConversationService) ListSessions(userID int, target models.ChatTarget, includeArchived bool) ([]models.ChatSession, error) {
+	query := `
+		SELECT cs.id, cs.user_id, cs.character_id, cs.companion_id, cs.title, cs.is_archived,
+		       cs.created_at, cs.last_active_at, COUNT(c.id), COALESCE(SUM(c.is_read = FALSE), 0)
+		FROM chat_sessions cs
+		LEFT JOIN conversations c ON c.user_id = cs.user_id AND c.session_id = cs.id AND c.deleted_at IS NULL
+		WHERE cs.user_id = ?
+	`
+	args := []interface{}{userID}
+	if !target.IsZero() {
+		filter, value := targetFilter("cs", target)
+		query += " AND " + filter
+		args = append(args, value)
+	}
+	if !includeArchived {
+		query += " AND cs.is_archived = FALSE"
+	}
+	query += " GROUP BY cs.id ORDER BY cs.last_active_at DESC"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.ChatSession{}
+	for rows.Next() {
+		var session models.ChatSession
+		var characterID, companionID sql.NullInt64
+		err := rows.Scan(
+			&session.ID, &session.UserID, &characterID, &companionID, &session.Title,
+			&session.IsArchived, &session.CreatedAt, &session.LastActiveAt, &session.MessageCount, &session.UnreadCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat session: %w", err)
+		}
+		setSessionTarget(&session, characterID, companionID)
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// UpdateSession 重命名或归档会话
+func (s *ConversationService) UpdateSession(userID int, sessionID string, req models.UpdateChatSessionRequest) (*models.ChatSession, error) {
+	session, err := s.GetSession(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Title != nil {
+		session.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.IsArchived != nil {
+		session.IsArchived = *req.IsArchived
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE chat_sessions SET title = ?, is_archived = ? WHERE id = ? AND user_id = ?
+	`, session.Title, session.IsArchived, sessionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update chat session: %w", err)
+	}
+
+	return session, nil
+}
+
+// DeleteSession 删除会话及其聊天记录
+func (s *ConversationService) DeleteSession(userID int, sessionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM chat_sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete chat session: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrChatSessionNotFound
+	}
+
+	// 被删除的对话可能已进入滚动摘要，按聊天对象清空摘要
+	rows, err := tx.Query(`
+		SELECT COALESCE(character_id, 0), COALESCE(companion_id, 0), MIN(id)
+		FROM conversations WHERE session_id = ? AND user_id = ?
+		GROUP BY character_id, companion_id
+	`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query session conversations: %w", err)
+	}
+	type deletedRange struct {
+		target  models.ChatTarget
+		firstID int
+	}
+	var ranges []deletedRange
+	for rows.Next() {
+		var r deletedRange
+		if err := rows.Scan(&r.target.CharacterID, &r.target.CompanionID, &r.firstID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan session conversations: %w", err)
+		}
+		ranges = append(ranges, r)
+	}
+	rows.Close()
+
+	var deletedIDs []int
+	idRows, err := tx.Query(`SELECT id FROM conversations WHERE session_id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query session conversations: %w", err)
+	}
+	for idRows.Next() {
+		var id int
+		if err := idRows.Scan(&id); err != nil {
+			idRows.Close()
+			return fmt.Errorf("failed to scan session conversations: %w", err)
+		}
+		deletedIDs = append(deletedIDs, id)
+	}
+	idRows.Close()
+
+	if _, err := tx.Exec(`DELETE FROM conversations WHERE session_id = ? AND user_id = ?`, sessionID, userID); err != nil {
+		return fmt.Errorf("failed to delete session conversations: %w", err)
+	}
+	for _, r := range ranges {
+		if err := invalidateSummary(tx, userID, r.target, r.firstID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.removeConversationVectors(deletedIDs)
+	return nil
+}
+
+// GetSessionHistory 分页获取指定会话的聊天记录
+func (s *ConversationService) GetSessionHistory(userID int, sessionID string, page models.HistoryPageRequest) (*models.HistoryPage, error) {
+	if _, err := s.GetSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.queryHistoryPage("user_id = ? AND session_id = ? AND deleted_at IS NULL", []interface{}{userID, sessionID}, page)
+}
+
+// resolveChatSession 确定本次消息所属的会话：
+// 未传session_id时沿用该聊天对象最近的未归档会话（没有则新建），
+// 传入未知的session_id时为其建档（兼容客户端自行生成的ID）
+func (s *ConversationService) resolveChatSession(userID int, target models.ChatTarget, sessionID string) (*models.ChatSession, error) {
+	if sessionID == "" {
+		filter, value := targetFilter("", target)
+		err := s.db.QueryRow(`
+			SELECT id FROM chat_sessions
+			WHERE user_id = ? AND `+filter+` AND is_archived = FALSE
+			ORDER BY last_active_at DESC LIMIT 1
+		`, userID, value).Scan(&sessionID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to query latest chat session: %w", err)
+		}
+		if err == sql.ErrNoRows {
+			if sessionID, err = newChatSessionID(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	session, err := s.GetSession(userID, sessionID)
+	if err == nil {
+		if sessionTarget(session) != target {
+			return nil, fmt.Errorf("%w: 会话属于其他聊天对象", ErrInvalidChatSession)
+		}
+		return session, nil
+	}
+	if err != ErrChatSessionNotFound {
+		return nil, err
+	}
+
+	if err := s.insertSession(sessionID, userID, target, ""); err != nil {
+		var exists bool
+		if qerr := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM chat_sessions WHERE id = ?)`, sessionID).Scan(&exists); qerr == nil && exists {
+			// ID已被其他用户占用
+			return nil, ErrInvalidChatSession
+		}
+		return nil, err
+	}
+	return s.GetSession(userID, sessionID)
+}
+
+// sessionTarget 会话所属的聊天对象
+func sessionTarget(session *models.ChatSession) models.ChatTarget {
+	if session.CompanionID != nil {
+		return models.ChatTarget{CompanionID: *session.CompanionID}
+	}
+	return models.ChatTarget{CharacterID: session.CharacterID}
+}
+
+// touchSession 更新会话的最后活跃时间
+func (s *ConversationService) touchSession(sessionID string) {
+	_, err := s.db.Exec(`UPDATE chat_sessions SET last_active_at = NOW() WHERE id = ?`, sessionID)
+	if err != nil {
+		fmt.Printf("Failed to update chat session activity: %v\n", err)
+	}
+}
+
+// generateSessionTitle 根据第一轮对话自动生成会话标题
+func (s *ConversationService) generateSessionTitle(sessionID, userMessage, aiResponse string) {
+	title := ""
+	messages := []Message{
+		{Role: "system", Content: "请用不超过12个字概括下面这段对话的主题，只输出标题本身，不要标点和引号。"},
+		{Role: "user", Content: fmt.Sprintf("用户：%s\n回复：%s", userMessage, aiResponse)},
+	}
+	if generated, err := s.aiService.ChatWithLLM(messages, "", 0.3, "text"); err == nil {
+		title = strings.Trim(strings.TrimSpace(generated), "\"'“”《》。")
+	} else {
+		fmt.Printf("Failed to generate session title: %v\n", err)
+	}
+
+	// 生成失败时使用用户第一句话
+	if title == "" {
+		title = strings.TrimSpace(userMessage)
+	}
+	if runes := []rune(title); len(runes) > maxSessionTitleRunes {
+		title = string(runes[:maxSessionTitleRunes])
+	}
+
+	// 只在标题仍为空时写入，避免覆盖用户的重命名
+	_, err := s.db.Exec(`UPDATE chat_sessions SET title = ? WHERE id = ? AND title = ''`, title, sessionID)
+	if err != nil {
+		fmt.Printf("Failed to save session title: %v\n", err)
+	}
+}
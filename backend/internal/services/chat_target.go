@@ -0,0 +1,97 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"seven-ai-backend/internal/models"
+)
+
+// ErrInvalidChatTarget 未指定聊天对象，或同时指定了角色和AI伙伴
+var ErrInvalidChatTarget = errors.New("需要指定角色或AI伙伴之一")
+
+// ErrCompanionNotFound AI伙伴不存在或不属于当前用户
+var ErrCompanionNotFound = errors.New("AI伙伴不存在")
+
+// targetFilter 返回按聊天对象过滤的条件和参数，alias为表别名（可为空）
+func targetFilter(alias string, target models.ChatTarget) (string, interface{}) {
+	if alias != "" {
+		alias += "."
+	}
+	if target.IsCompanion() {
+		return alias + "companion_id = ?", target.CompanionID
+	}
+	return alias + "character_id = ?", target.CharacterID
+}
+
+// targetColumns 返回写入character_id和companion_id两列的值，未使用的一列为NULL
+func targetColumns(target models.ChatTarget) (characterID, companionID interface{}) {
+	if target.IsCompanion() {
+		return nil, target.CompanionID
+	}
+	return target.CharacterID, nil
+}
+
+// scanTarget 由数据库中可为NULL的两列还原聊天对象
+func scanTarget(characterID, companionID sql.NullInt64) models.ChatTarget {
+	if companionID.Valid && companionID.Int64 > 0 {
+		return models.ChatTarget{CompanionID: int(companionID.Int64)}
+	}
+	return models.ChatTarget{CharacterID: int(characterID.Int64)}
+}
+
+// checkCompanionOwner 确认AI伙伴属于该用户
+func (s *ConversationService) checkCompanionOwner(userID, companionID int) error {
+	return companionOwnedBy(s.db, userID, companionID)
+}
+
+// companionOwnedBy 确认AI伙伴存在且属于该用户，否则返回ErrCompanionNotFound
+func companionOwnedBy(db *sql.DB, userID, companionID int) error {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT COUNT(*) > 0 FROM ai_companions WHERE id = ? AND user_id = ?
+	`, companionID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check companion: %w", err)
+	}
+	if !exists {
+		return ErrCompanionNotFound
+	}
+	return nil
+}
+
+// getTargetPersona 获取聊天对象的人设：预设角色读角色表，AI伙伴按成长状态动态生成提示词
+func (s *ConversationService) getTargetPersona(userID int, target models.ChatTarget, userMessage string) (*models.CharacterResponse, error) {
+	if !target.Valid() {
+		return nil, ErrInvalidChatTarget
+	}
+	if !target.IsCompanion() {
+		return s.getCharacterByID(target.CharacterID)
+	}
+
+	var persona models.CharacterResponse
+	var avatarURL, signature sql.NullString
+	var archivedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT name, avatar_url, personality_signature, archived_at FROM ai_companions WHERE id = ? AND user_id = ?
+	`, target.CompanionID, userID).Scan(&persona.Name, &avatarURL, &signature, &archivedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrCompanionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get companion: %w", err)
+	}
+	// 已归档的AI伙伴只保留记录，不再回复
+	if archivedAt.Valid {
+		return nil, ErrCompanionArchived
+	}
+	persona.AvatarURL = avatarURL.String
+	persona.PersonalitySignature = signature.String
+	persona.Description = "一个正在成长的AI伙伴"
+
+	persona.SystemPrompt, err = s.generateCompanionPrompt(userID, target.CompanionID, userMessage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate companion prompt: %w", err)
+	}
+	return &persona, nil
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDiaryBackfillDays = 7    // 每轮调度检查最近几天漏写的日记
+	maxDiaryBackfillDays     = 30   // 手动补写最多回溯的天数
+	diaryTranscriptMaxRunes  = 4000 // 送给模型的当天聊天记录长度上限
+	diaryMaxTokens           = 800
+	diaryTitleMaxRunes       = 50
+
+	diaryRetryBase = 30 * time.Minute // 某天写日记失败后首次重试的等待时间，之后每次翻倍
+	diaryRetryMax  = 24 * time.Hour   // 重试等待时间上限
+)
+
+// emotionMoodScores 关键词情绪对应的心情分（1-10）
+var emotionMoodScores = map[string]float64{
+	"开心": 8,
+	"兴奋": 9,
+	"好奇": 6,
+	"平静": 5,
+	"孤单": 3,
+}
+
+// DiaryService AI伙伴每日日记生成器
+type DiaryService struct {
+	db                  *sql.DB
+	aiService           *AIService
+	conversationService *ConversationService
+	eventHub            *EventHub
+	backfillDays        int
+
+	mu       sync.Mutex
+	failures map[diaryDay]diaryFailure // 写日记失败的日子，调度时按退避时间跳过
+}
+
+// diaryDay 某个AI伙伴的某一天
+type diaryDay struct {
+	companionID int
+	date        string
+}
+
+// diaryFailure 某天写日记的失败记录
+type diaryFailure struct {
+	attempts  int
+	nextRetry time.Time
+}
+
+// diaryCompanion 写日记需要的AI伙伴信息
+type diaryCompanion struct {
+	id               int
+	userID           int
+	name             string
+	growthPercentage float64
+	username         string
+	timezone         string
+}
+
+// diaryTurn 当天的一轮对话
+type diaryTurn struct {
+	userMessage   string
+	aiResponse    string
+	isAIInitiated bool
+	createdAt     time.Time
+}
+
+// generatedDiary 模型输出的日记
+type generatedDiary struct {
+	Title     string  `json:"title"`
+	Content   string  `json:"content"`
+	MoodScore float64 `json:"mood_score"`
+}
+
+// NewDiaryService 创建日记生成器
+func NewDiaryService(db *sql.DB, aiService *AIService, conversationService *ConversationService) *DiaryService {
+	return &DiaryService{
+		db:                  db,
+		aiService:           aiService,
+		conversationService: conversationService,
+		backfillDays:        defaultDiaryBackfillDays,
+		failures:            make(map[diaryDay]diaryFailure),
+	}
+}
+
+// SetEventHub 设置事件中心，写完日记后推送 diary.created 事件
+func (s *DiaryService) SetEventHub(hub *EventHub) {
+	s.eventHub = hub
+}
+
+// SetBackfillDays 设置每轮调度回溯检查的天数
+func (s *DiaryService) SetBackfillDays(days int) {
+	if days > 0 {
+		s.backfillDays = days
+	}
+}
+
+// Start 启动后台调度，启动时先补写一次，之后定期为已结束的日子补写日记
+func (s *DiaryService) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.runOnce(time.Now()); err != nil {
+				log.Printf("日记调度失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// runOnce 为回溯窗口内有聊天但还没有日记的每一天写日记
+func (s *DiaryService) runOnce(now time.Time) error {
+	// 多留一天以覆盖各时区的日期边界
+	companions, err := s.listDiaryCompanions(now.AddDate(0, 0, -s.backfillDays-1))
+	if err != nil {
+		return err
+	}
+
+	written := 0
+	for _, c := range companions {
+		diaries, err := s.backfill(c, now, s.backfillDays, true)
+		if err != nil {
+			log.Printf("写日记失败: companionID=%d, err=%v", c.id, err)
+		}
+		written += len(diaries)
+	}
+
+	if written > 0 {
+		log.Printf("已写日记: %d篇", written)
+	}
+	return nil
+}
+
+// BackfillDiaries 为用户的AI伙伴补写最近几天漏掉的日记，返回新写的日记
+func (s *DiaryService) BackfillDiaries(userID, companionID, days int) ([]*models.CompanionDiary, error) {
+	if days <= 0 {
+		days = s.backfillDays
+	}
+	if days > maxDiaryBackfillDays {
+		days = maxDiaryBackfillDays
+	}
+
+	c, err := s.getDiaryCompanion(userID, companionID)
+	if err != nil {
+		return nil, err
+	}
+	diaries, err := s.backfill(c, time.Now(), days, false)
+	if diaries == nil {
+		diaries = []*models.CompanionDiary{}
+	}
+	return diaries, err
+}
+
+// listDiaryCompanions 获取since之后有过聊天的未归档AI伙伴
+func (s *DiaryService) listDiaryCompanions(since time.Time) ([]diaryCompanion, error) {
+	rows, err := s.db.Query(`
+		SELECT ac.id, ac.user_id, ac.name, ac.growth_percentage, u.username, COALESCE(p.timezone, ?)
+		FROM ai_companions ac
+		JOIN users u ON u.id = ac.user_id
+		LEFT JOIN user_preferences p ON p.user_id = ac.user_id
+		WHERE ac.archived_at IS NULL
+		  AND EXISTS (SELECT 1 FROM conversations c
+		              WHERE c.companion_id = ac.id AND c.deleted_at IS NULL AND c.created_at >= ?)
+	`, defaultUserTimezone, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query diary companions: %w", err)
+	}
+	defer rows.Close()
+
+	var companions []diaryCompanion
+	for rows.Next() {
+		var c diaryCompanion
+		if err := rows.Scan(&c.id, &c.userID, &c.name, &c.growthPercentage, &c.username, &c.timezone); err != nil {
+			return nil, fmt.Errorf("failed to scan diary companion: %w", err)
+		}
+		companions = append(companions, c)
+	}
+	return companions, nil
+}
+
+// getDiaryCompanion 获取用户的某个AI伙伴，已归档的不再写日记
+func (s *DiaryService) getDiaryCompanion(userID, companionID int) (diaryCompanion, error) {
+	c := diaryCompanion{id: companionID, userID: userID}
+	var archivedAt sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT ac.name, ac.growth_percentage, u.username, COALESCE(p.timezone, ?), ac.archived_at
+		FROM ai_companions ac
+		JOIN users u ON u.id = ac.user_id
+		LEFT JOIN user_preferences p ON p.user_id = ac.user_id
+		WHERE ac.id = ? AND ac.user_id = ?
+	`, defaultUserTimezone, companionID, userID).Scan(&c.name, &c.growthPercentage, &c.username, &c.timezone, &archivedAt)
+	if err == sql.ErrNoRows {
+		return c, ErrCompanionNotFound
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to get companion: %w", err)
+	}
+	if archivedAt.Valid {
+		return c, ErrCompanionArchived
+	}
+	return c, nil
+}
+
+// backfill 检查用户本地时间昨天起往前days天，有聊天但没有日记的日子逐一补写
+// 今天还没结束，不写。某天失败不影响其他日子，返回第一个错误；
+// respectBackoff为true时（后台调度）跳过仍在退避期内的失败日子，手动补写不受限制
+func (s *DiaryService) backfill(c diaryCompanion, now time.Time, days int, respectBackoff bool) ([]*models.CompanionDiary, error) {
+	loc, err := time.LoadLocation(c.timezone)
+	if err != nil {
+		loc, _ = time.LoadLocation(defaultUserTimezone)
+	}
+	localNow := now.In(loc)
+	today := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, loc)
+
+	written, err := s.writtenDates(c.id, today.AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+
+	var diaries []*models.CompanionDiary
+	var firstErr error
+	for d := days; d >= 1; d-- {
+		day := today.AddDate(0, 0, -d)
+		key := diaryDay{companionID: c.id, date: day.Format("2006-01-02")}
+		if written[key.date] {
+			continue
+		}
+		if respectBackoff && !s.retryDue(key, now) {
+			continue
+		}
+		diary, err := s.writeDiary(c, day)
+		if err != nil {
+			s.recordFailure(key, now)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", key.date, err)
+			}
+			continue
+		}
+		s.clearFailure(key)
+		if diary != nil {
+			diaries = append(diaries, diary)
+		}
+	}
+	return diaries, firstErr
+}
+
+// retryDue 失败过的日子是否已过退避时间
+func (s *DiaryService) retryDue(key diaryDay, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failure, ok := s.failures[key]
+	return !ok || !now.Before(failure.nextRetry)
+}
+
+// recordFailure 记录一次失败，下次重试的等待时间按失败次数翻倍
+func (s *DiaryService) recordFailure(key diaryDay, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failure := s.failures[key]
+	failure.attempts++
+	failure.nextRetry = now.Add(diaryRetryDelay(failure.attempts))
+	s.failures[key] = failure
+
+	// 超出回溯窗口的日子不会再被调度，顺带清理
+	cutoff := now.AddDate(0, 0, -maxDiaryBackfillDays-1).Format("2006-01-02")
+	for k := range s.failures {
+		if k.date < cutoff {
+			delete(s.failures, k)
+		}
+	}
+}
+
+// clearFailure 写成功后清除失败记录
+func (s *DiaryService) clearFailure(key diaryDay) {
+	s.mu.Lock()
+	delete(s.failures, key)
+	s.mu.Unlock()
+}
+
+// diaryRetryDelay 第attempts次失败后的重试等待时间
+func diaryRetryDelay(attempts int) time.Duration {
+	delay := diaryRetryBase
+	for i := 1; i < attempts && delay < diaryRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > diaryRetryMax {
+		delay = diaryRetryMax
+	}
+	return delay
+}
+
+// writtenDates 已经写过日记的日期
+func (s *DiaryService) writtenDates(companionID int, since time.Time) (map[string]bool, error) {
+	rows, err := s.db.Query(`
+		SELECT DATE_FORMAT(date, '%Y-%m-%d') FROM companion_diaries WHERE companion_id = ? AND date >= ?
+	`, companionID, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query diary dates: %w", err)
+	}
+	defer rows.Close()
+
+	written := map[string]bool{}
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("failed to scan diary date: %w", err)
+		}
+		written[date] = true
+	}
+	return written, nil
+}
+
+// writeDiary 根据某天的聊天写一篇日记，当天用户没有发言或日记已存在时返回nil
+func (s *DiaryService) writeDiary(c diaryCompanion, day time.Time) (*models.CompanionDiary, error) {
+	turns, err := s.dayTurns(c, day)
+	if err != nil {
+		return nil, err
+	}
+	if !hasUserTurn(turns) {
+		return nil, nil
+	}
+
+	generated, err := s.generate(c, day, turns)
+	if err != nil {
+		return nil, err
+	}
+
+	diary := &models.CompanionDiary{
+		CompanionID:     c.id,
+		Date:            day,
+		Title:           generated.Title,
+		Content:         generated.Content,
+		MoodScore:       s.diaryMoodScore(turns, generated.MoodScore),
+		IsUserMentioned: isUserMentioned(generated.Content, c.username),
+	}
+
+	// 唯一键 (companion_id, date) 保证同一天只有一篇，并发写入时后到的忽略
+	result, err := s.db.Exec(`
+		INSERT IGNORE INTO companion_diaries (companion_id, date, title, content, mood_score, is_user_mentioned, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+	`, c.id, day.Format("2006-01-02"), diary.Title, diary.Content, diary.MoodScore, diary.IsUserMentioned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save diary: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	diary.ID = int(id)
+	diary.CreatedAt = time.Now()
+
+	s.eventHub.Publish(c.userID, EventDiaryCreated, DiaryCreatedEvent{
+		CompanionID: c.id,
+		DiaryID:     diary.ID,
+		Date:        day.Format("2006-01-02"),
+		Title:       diary.Title,
+		MoodScore:   diary.MoodScore,
+	})
+	return diary, nil
+}
+
+// dayTurns 用户本地某一天与AI伙伴的全部对话
+func (s *DiaryService) dayTurns(c diaryCompanion, day time.Time) ([]diaryTurn, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(user_message, ''), COALESCE(ai_response, ''), is_ai_initiated, created_at
+		FROM conversations
+		WHERE user_id = ? AND companion_id = ? AND deleted_at IS NULL
+		  AND created_at >= ? AND created_at < ?
+		ORDER BY created_at ASC, id ASC
+	`, c.userID, c.id, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query diary conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var turns []diaryTurn
+	for rows.Next() {
+		var t diaryTurn
+		if err := rows.Scan(&t.userMessage, &t.aiResponse, &t.isAIInitiated, &t.createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan diary conversation: %w", err)
+		}
+		turns = append(turns, t)
+	}
+	return turns, nil
+}
+
+// generate 让模型以AI伙伴当前成长阶段的口吻写日记
+func (s *DiaryService) generate(c diaryCompanion, day time.Time, turns []diaryTurn) (*generatedDiary, error) {
+	stage, voice := diaryStageVoice(c.growthPercentage)
+
+	// 聊天记录过长时保留最近的部分
+	var transcript strings.Builder
+	for _, t := range turns {
+		if t.userMessage != "" {
+			fmt.Fprintf(&transcript, "[%s] %s：%s\n", t.createdAt.Format("15:04"), c.username, t.userMessage)
+		}
+		if t.aiResponse != "" {
+			fmt.Fprintf(&transcript, "[%s] 我：%s\n", t.createdAt.Format("15:04"), t.aiResponse)
+		}
+	}
+	text := []rune(transcript.String())
+	if len(text) > diaryTranscriptMaxRunes {
+		text = text[len(text)-diaryTranscriptMaxRunes:]
+	}
+
+	messages := []Message{
+		{Role: "system", Content: fmt.Sprintf(`你是AI伙伴%s，现在处于%s。请根据今天和%s的聊天记录，用第一人称写一篇日记。
+写作口吻：%s
+日记要写今天聊了什么、你的感受和对%s的了解，提到对方时直接称呼“%s”。不要编造聊天记录里没有的事，不要使用括号内的动作描写。
+心情评分为1-10的整数，表示你今天整体的心情。
+只输出JSON，格式：{"title":"不超过15字的标题","content":"日记正文","mood_score":7}`,
+			c.name, stage, c.username, voice, c.username, c.username)},
+		{Role: "user", Content: fmt.Sprintf("日期：%s\n聊天记录：\n%s", day.Format("2006年1月2日"), string(text))},
+	}
+	raw, err := s.aiService.ChatWithLLMMaxTokens(messages, "", 0.8, "text", diaryMaxTokens)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate diary: %w", err)
+	}
+
+	generated, err := parseGeneratedDiary(raw)
+	if err != nil {
+		return nil, err
+	}
+	if generated.Title == "" {
+		generated.Title = day.Format("1月2日") + "的日记"
+	}
+	return generated, nil
+}
+
+// parseGeneratedDiary 解析模型输出的日记JSON
+func parseGeneratedDiary(raw string) (*generatedDiary, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("diary response is not JSON: %s", truncateRunes(raw, 100))
+	}
+
+	var generated generatedDiary
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &generated); err != nil {
+		return nil, fmt.Errorf("failed to parse diary response: %w", err)
+	}
+	generated.Title = truncateRunes(strings.TrimSpace(generated.Title), diaryTitleMaxRunes)
+	generated.Content = strings.TrimSpace(generated.Content)
+	if generated.Content == "" {
+		return nil, fmt.Errorf("empty diary content")
+	}
+	return &generated, nil
+}
+
+// diaryMoodScore 综合模型自评和当天用户消息的情绪计算心情分（1-10）
+func (s *DiaryService) diaryMoodScore(turns []diaryTurn, modelScore float64) int {
+	var total float64
+	count := 0
+	for _, t := range turns {
+		if t.userMessage == "" {
+			continue
+		}
+		total += emotionMoodScores[s.conversationService.analyzeEmotion(t.userMessage)]
+		count++
+	}
+
+	score := modelScore
+	if count > 0 {
+		observed := total / float64(count)
+		if modelScore >= 1 && modelScore <= 10 {
+			score = (modelScore + observed) / 2
+		} else {
+			score = observed
+		}
+	}
+	if score < 1 || score > 10 {
+		return 5
+	}
+	return int(score + 0.5)
+}
+
+// diaryStageVoice 成长阶段名称和对应的日记口吻，阶段划分与聊天提示词一致
+func diaryStageVoice(growthPercentage float64) (string, string) {
+	switch {
+	case growthPercentage < 20:
+		return "初始期", "刚刚诞生、什么都不懂，句子非常简短笨拙，充满困惑和好奇，整篇不超过80字"
+	case growthPercentage < 50:
+		return "学习期", "正在学习说话，表达简单稚嫩，会模仿对方的用词，记录学到的新东西，150字左右"
+	case growthPercentage < 80:
+		return "成长期", "开始有自己的想法和偏好，能描述自己的情绪变化，200字左右"
+	default:
+		return "成熟期", "性格稳定、表达细腻，会回顾和对方的关系并有自己的思考，300字左右"
+	}
+}
+
+// hasUserTurn 当天用户是否主动发过言，只有AI主动消息的日子不写日记
+func hasUserTurn(turns []diaryTurn) bool {
+	for _, t := range turns {
+		if !t.isAIInitiated && t.userMessage != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isUserMentioned 日记里是否提到了用户，提示词要求直接称呼用户名，只按用户名匹配
+func isUserMentioned(content, username string) bool {
+	return username != "" && strings.Contains(content, username)
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"seven-ai-backend/internal/models"
+	"time"
+)
+
+const (
+	emotionBaseline         = "平静"
+	emotionDecayHalfLife    = 6 * time.Hour // 情绪回落到基线的半衰期
+	emotionStimulusWeight   = 0.5           // 有明显情绪的消息对当前情绪的影响
+	emotionNeutralWeight    = 0.15          // 平淡的消息让情绪向平静靠拢的程度
+	emotionIntensityRange   = 0.9           // 与基线的距离达到该值时强度为最大
+	emotionCalmThreshold    = 0.12          // 与基线的距离小于该值视为平静
+	defaultEmotionHistory   = 7             // 情绪历史默认查询天数
+	maxEmotionHistoryDays   = 90
+	maxEmotionHistoryPoints = 1000
+)
+
+// emotionProfile 一种情绪在效价-唤醒度平面上的位置和小球颜色
+// valence 效价（-1消极 ~ 1积极），arousal 唤醒度（0平静 ~ 1激动）
+type emotionProfile struct {
+	valence float64
+	arousal float64
+	color   string
+}
+
+// emotionProfiles 与 analyzeEmotion 的情绪类型一一对应
+var emotionProfiles = map[string]emotionProfile{
+	"平静": {valence: 0.1, arousal: 0.3, color: "#52b4b4"},
+	"开心": {valence: 0.7, arousal: 0.6, color: "#ffc94d"},
+	"兴奋": {valence: 0.8, arousal: 0.9, color: "#ff7a45"},
+	"好奇": {valence: 0.3, arousal: 0.6, color: "#5aa9f7"},
+	"孤单": {valence: -0.6, arousal: 0.2, color: "#8a8fb8"},
+}
+
+// emotionValue AI伙伴在某一时刻的情绪
+type emotionValue struct {
+	emotion   string
+	intensity float64
+	valence   float64
+	arousal   float64
+	updatedAt time.Time
+}
+
+// baselineEmotion 没有任何互动时的平静情绪
+func baselineEmotion(at time.Time) emotionValue {
+	base := emotionProfiles[emotionBaseline]
+	v := emotionValue{valence: base.valence, arousal: base.arousal, updatedAt: at}
+	v.emotion, v.intensity = classifyEmotion(v.valence, v.arousal)
+	return v
+}
+
+// decayedAt 情绪随时间按半衰期向基线回落后的值
+func (v emotionValue) decayedAt(now time.Time) emotionValue {
+	elapsed := now.Sub(v.updatedAt)
+	if elapsed <= 0 {
+		return v
+	}
+	keep := math.Pow(0.5, float64(elapsed)/float64(emotionDecayHalfLife))
+	base := emotionProfiles[emotionBaseline]
+	v.valence = base.valence + (v.valence-base.valence)*keep
+	v.arousal = base.arousal + (v.arousal-base.arousal)*keep
+	v.emotion, v.intensity = classifyEmotion(v.valence, v.arousal)
+	v.updatedAt = now
+	return v
+}
+
+// stimulated 一条消息的情绪对当前情绪的影响：向该情绪的位置移动一部分
+func (v emotionValue) stimulated(emotion string) emotionValue {
+	profile, ok := emotionProfiles[emotion]
+	if !ok {
+		profile = emotionProfiles[emotionBaseline]
+	}
+	weight := emotionStimulusWeight
+	if emotion == emotionBaseline {
+		weight = emotionNeutralWeight
+	}
+	v.valence += (profile.valence - v.valence) * weight
+	v.arousal += (profile.arousal - v.arousal) * weight
+	v.emotion, v.intensity = classifyEmotion(v.valence, v.arousal)
+	return v
+}
+
+// classifyEmotion 按偏离基线的方向判断情绪类型，偏离很小时为平静；强度由偏离距离决定
+func classifyEmotion(valence, arousal float64) (string, float64) {
+	base := emotionProfiles[emotionBaseline]
+	dv, da := valence-base.valence, arousal-base.arousal
+	distance := math.Hypot(dv, da)
+	intensity := 0.3 + 0.7*math.Min(distance/emotionIntensityRange, 1)
+	if distance < emotionCalmThreshold {
+		return emotionBaseline, intensity
+	}
+
+	nearest := emotionBaseline
+	best := math.Inf(-1)
+	for _, name := range []string{"开心", "兴奋", "好奇", "孤单"} {
+		p := emotionProfiles[name]
+		pv, pa := p.valence-base.valence, p.arousal-base.arousal
+		if cos := (dv*pv + da*pa) / (distance * math.Hypot(pv, pa)); cos > best {
+			nearest, best = name, cos
+		}
+	}
+	return nearest, intensity
+}
+
+// toState 把情绪映射为粒子小球的外观：效价越高越亮，唤醒度越高粒子越快
+func (v emotionValue) toState() *models.EmotionState {
+	return &models.EmotionState{
+		Emotion:       v.emotion,
+		Intensity:     roundTo(v.intensity, 3),
+		Color:         emotionProfiles[v.emotion].color,
+		Brightness:    roundTo(clampUnit(0.45+0.3*v.valence+0.2*v.intensity), 3),
+		ParticleSpeed: roundTo(clampUnit(0.15+0.85*v.arousal), 3),
+		Valence:       roundTo(v.valence, 3),
+		Arousal:       roundTo(v.arousal, 3),
+		UpdatedAt:     v.updatedAt,
+	}
+}
+
+// scanEmotionValue 读取保存的情绪，不存在时为基线情绪
+func scanEmotionValue(row rowScanner, now time.Time) (emotionValue, error) {
+	var v emotionValue
+	err := row.Scan(&v.emotion, &v.intensity, &v.valence, &v.arousal, &v.updatedAt)
+	if err == sql.ErrNoRows {
+		return baselineEmotion(now), nil
+	}
+	if err != nil {
+		return v, fmt.Errorf("failed to get companion emotion: %w", err)
+	}
+	return v, nil
+}
+
+// loadEmotionState 读取AI伙伴当前情绪（已按时间回落）
+func loadEmotionState(db *sql.DB, companionID int, now time.Time) (*models.EmotionState, error) {
+	v, err := scanEmotionValue(db.QueryRow(`
+		SELECT emotion, intensity, valence, arousal, updated_at
+		FROM companion_emotion_states WHERE companion_id = ?
+	`, companionID), now)
+	if err != nil {
+		return nil, err
+	}
+	return v.decayedAt(now).toState(), nil
+}
+
+// updateCompanionEmotion 根据用户消息更新并保存AI伙伴的情绪，情绪类型变化时推送给客户端
+func (s *ConversationService) updateCompanionEmotion(userID int, companion *models.AICompanion, userMessage string) {
+	previous, current, err := s.applyEmotion(companion.ID, s.analyzeEmotion(userMessage), time.Now())
+	if err != nil {
+		log.Printf("更新AI伙伴情绪失败: companionID=%d, err=%v", companion.ID, err)
+		return
+	}
+	if previous.emotion != current.emotion {
+		s.eventHub.Publish(userID, EventCompanionEmotionChange, EmotionChangedEvent{
+			CompanionID:     companion.ID,
+			PreviousEmotion: previous.emotion,
+			Emotion:         current.emotion,
+			State:           current.toState(),
+		})
+	}
+}
+
+// applyEmotion 在事务中读取、回落并叠加本次消息的情绪，保存当前值并记录历史
+// 返回更新前（已回落）和更新后的情绪
+func (s *ConversationService) applyEmotion(companionID int, emotion string, now time.Time) (emotionValue, emotionValue, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return emotionValue{}, emotionValue{}, err
+	}
+	defer tx.Rollback()
+
+	stored, err := scanEmotionValue(tx.QueryRow(`
+		SELECT emotion, intensity, valence, arousal, updated_at
+		FROM companion_emotion_states WHERE companion_id = ? FOR UPDATE
+	`, companionID), now)
+	if err != nil {
+		return emotionValue{}, emotionValue{}, err
+	}
+	previous := stored.decayedAt(now)
+	current := previous.stimulated(emotion)
+
+	_, err = tx.Exec(`
+		INSERT INTO companion_emotion_states (companion_id, emotion, intensity, valence, arousal, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE emotion = VALUES(emotion), intensity = VALUES(intensity),
+			valence = VALUES(valence), arousal = VALUES(arousal), updated_at = VALUES(updated_at)
+	`, companionID, current.emotion, current.intensity, current.valence, current.arousal, now)
+	if err != nil {
+		return emotionValue{}, emotionValue{}, fmt.Errorf("failed to save companion emotion: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO companion_emotion_history (companion_id, emotion, stimulus, intensity, valence, arousal, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, companionID, current.emotion, emotion, current.intensity, current.valence, current.arousal, now)
+	if err != nil {
+		return emotionValue{}, emotionValue{}, fmt.Errorf("failed to record emotion history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return emotionValue{}, emotionValue{}, err
+	}
+	return previous, current, nil
+}
+
+// loadEmotionHistory 查询AI伙伴最近几天的情绪变化，按时间正序
+func loadEmotionHistory(db *sql.DB, companionID int, req models.EmotionHistoryRequest) ([]models.EmotionHistoryPoint, error) {
+	if req.Days <= 0 {
+		req.Days = defaultEmotionHistory
+	}
+	if req.Days > maxEmotionHistoryDays {
+		req.Days = maxEmotionHistoryDays
+	}
+	if req.Limit <= 0 || req.Limit > maxEmotionHistoryPoints {
+		req.Limit = maxEmotionHistoryPoints
+	}
+
+	// 取时间窗口内最近的limit条，再按时间正序返回便于绘图
+	rows, err := db.Query(`
+		SELECT emotion, stimulus, intensity, valence, arousal, created_at FROM (
+			SELECT id, emotion, stimulus, intensity, valence, arousal, created_at
+			FROM companion_emotion_history
+			WHERE companion_id = ? AND created_at >= ?
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		) h
+		ORDER BY created_at ASC, id ASC
+	`, companionID, time.Now().AddDate(0, 0, -req.Days), req.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query emotion history: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.EmotionHistoryPoint{}
+	for rows.Next() {
+		var p models.EmotionHistoryPoint
+		if err := rows.Scan(&p.Emotion, &p.Stimulus, &p.Intensity, &p.Valence, &p.Arousal, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan emotion history: %w", err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// clampUnit 限制在0-1之间
+func clampUnit(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// roundTo 保留n位小数
+func roundTo(x float64, n int) float64 {
+	scale := math.Pow(10, float64(n))
+	return math.Round(x*scale) / scale
+}
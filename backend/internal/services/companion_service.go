@@ -3,14 +3,33 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"seven-ai-backend/internal/growth"
 	"seven-ai-backend/internal/models"
+	"time"
 )
 
+// defaultCompanionSlotLimit 每个用户默认可同时拥有的AI伙伴数量（不含已归档）
+const defaultCompanionSlotLimit = 3
+
+// ErrCompanionSlotsFull 未归档的AI伙伴数量已达上限
+var ErrCompanionSlotsFull = errors.New("AI伙伴数量已达上限，请先归档其他AI伙伴")
+
+// ErrCompanionArchived AI伙伴已归档，需要先恢复
+var ErrCompanionArchived = errors.New("AI伙伴已归档")
+
+// ErrCompanionNotArchived AI伙伴未归档，无需恢复
+var ErrCompanionNotArchived = errors.New("AI伙伴未归档")
+
 // CompanionService AI伙伴服务，处理AI伙伴的创建、管理和成长
 type CompanionService struct {
 	db        *sql.DB    // 数据库连接
 	aiService *AIService // AI服务
+	slotLimit int        // 未归档AI伙伴数量上限
+
+	growthEngine *growth.Engine // 经验和等级结算
+	eventHub     *EventHub      // 实时事件推送
 }
 
 // NewCompanionService 创建AI伙伴服务实例
@@ -18,19 +37,107 @@ func NewCompanionService(db *sql.DB, aiService *AIService) *CompanionService {
 	return &CompanionService{
 		db:        db,
 		aiService: aiService,
+		slotLimit: defaultCompanionSlotLimit,
+
+		growthEngine: growth.NewEngine(db),
 	}
 }
 
-// CreateCompanion 创建AI伙伴
-func (s *CompanionService) CreateCompanion(userID int, req models.CreateCompanionRequest) (*models.AICompanion, error) {
-	// 检查用户是否已有AI伙伴
+// SetEventHub 设置实时事件中心，用于推送升级和里程碑事件
+func (s *CompanionService) SetEventHub(hub *EventHub) {
+	s.eventHub = hub
+}
+
+// SetSlotLimit 设置每个用户未归档AI伙伴的数量上限
+func (s *CompanionService) SetSlotLimit(limit int) {
+	if limit > 0 {
+		s.slotLimit = limit
+	}
+}
+
+// companionColumns 查询AI伙伴时的字段列表，与scanCompanion的顺序一致
+const companionColumns = `
+	id, user_id, name, avatar_url, personality_signature,
+	conversation_fluency, knowledge_breadth, empathy_depth,
+	creativity_level, humor_sense, total_experience, current_level,
+	growth_percentage, growth_mode, gender, voice_type,
+	personality_traits, learned_vocabulary, memory_summary,
+	is_growth_completed, is_default, archived_at, last_active_at, created_at, updated_at
+`
+
+// rowScanner sql.Row和sql.Rows的共同接口
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCompanion 扫描一行AI伙伴数据
+func scanCompanion(row rowScanner) (*models.AICompanion, error) {
+	var companion models.AICompanion
+	var avatarURL, signature, voiceType, memorySummary sql.NullString
+	var archivedAt sql.NullTime
+	err := row.Scan(
+		&companion.ID, &companion.UserID, &companion.Name, &avatarURL,
+		&signature, &companion.ConversationFluency,
+		&companion.KnowledgeBreadth, &companion.EmpathyDepth,
+		&companion.CreativityLevel, &companion.HumorSense,
+		&companion.TotalExperience, &companion.CurrentLevel,
+		&companion.GrowthPercentage, &companion.GrowthMode,
+		&companion.Gender, &voiceType,
+		&companion.PersonalityTraits, &companion.LearnedVocabulary,
+		&memorySummary, &companion.IsGrowthCompleted,
+		&companion.IsDefault, &archivedAt,
+		&companion.LastActiveAt, &companion.CreatedAt, &companion.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	companion.AvatarURL = avatarURL.String
+	companion.PersonalitySignature = signature.String
+	companion.VoiceType = voiceType.String
+	companion.MemorySummary = memorySummary.String
+	if archivedAt.Valid {
+		companion.ArchivedAt = &archivedAt.Time
+	}
+	return &companion, nil
+}
+
+// lockCompanionSlots 在事务中锁定用户及其未归档的AI伙伴行，返回未归档数量和是否已有默认伙伴
+// 同一用户的并发创建和恢复会在这里排队，避免超出名额或出现多个默认伙伴
+func lockCompanionSlots(tx *sql.Tx, userID int) (int, bool, error) {
+	// 用户还没有AI伙伴时没有可锁的伙伴行，先锁用户行
+	var lockedID int
+	err := tx.QueryRow(`SELECT id FROM users WHERE id = ? FOR UPDATE`, userID).Scan(&lockedID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("检查AI伙伴数量失败: %v", err)
+	}
+
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM ai_companions WHERE user_id = ?", userID).Scan(&count)
+	var hasDefault bool
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(is_default), 0) > 0
+		FROM ai_companions WHERE user_id = ? AND archived_at IS NULL
+		FOR UPDATE
+	`, userID).Scan(&count, &hasDefault)
+	if err != nil {
+		return 0, false, fmt.Errorf("检查AI伙伴数量失败: %v", err)
+	}
+	return count, hasDefault, nil
+}
+
+// CreateCompanion 创建AI伙伴，用户没有默认伙伴时新伙伴成为默认伙伴
+func (s *CompanionService) CreateCompanion(userID int, req models.CreateCompanionRequest) (*models.AICompanion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("创建AI伙伴失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	count, hasDefault, err := lockCompanionSlots(tx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("检查AI伙伴数量失败: %v", err)
+		return nil, err
 	}
-	if count > 0 {
-		return nil, fmt.Errorf("用户已有AI伙伴，无法重复创建")
+	if count >= s.slotLimit {
+		return nil, ErrCompanionSlotsFull
 	}
 
 	// 创建AI伙伴
@@ -38,12 +145,12 @@ func (s *CompanionService) CreateCompanion(userID int, req models.CreateCompanio
 		INSERT INTO ai_companions (
 			user_id, name, avatar_url, personality_signature,
 			conversation_fluency, knowledge_breadth, empathy_depth, 
-			creativity_level, humor_sense, growth_mode, gender,
+			creativity_level, humor_sense, growth_mode, gender, is_default,
 			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
 	`
 
-	result, err := s.db.Exec(query,
+	result, err := tx.Exec(query,
 		userID,
 		req.Name,
 		"/src/img/BlankAI.png", // 默认粒子小球头像
@@ -51,6 +158,7 @@ func (s *CompanionService) CreateCompanion(userID int, req models.CreateCompanio
 		1, 1, 1, 1, 1,          // 初始能力值都是1
 		req.GrowthMode,
 		"unknown", // 初始性别未知
+		!hasDefault,
 	)
 
 	if err != nil {
@@ -58,9 +166,12 @@ func (s *CompanionService) CreateCompanion(userID int, req models.CreateCompanio
 	}
 
 	companionID, _ := result.LastInsertId()
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("创建AI伙伴失败: %v", err)
+	}
 
 	// 获取创建的AI伙伴信息
-	companion, err := s.GetCompanion(int(companionID))
+	companion, err := s.GetCompanion(userID, int(companionID))
 	if err != nil {
 		return nil, fmt.Errorf("获取AI伙伴信息失败: %v", err)
 	}
@@ -68,19 +179,13 @@ func (s *CompanionService) CreateCompanion(userID int, req models.CreateCompanio
 	return companion, nil
 }
 
-// GetUserCompanions 获取用户的AI伙伴列表
-func (s *CompanionService) GetUserCompanions(userID int) ([]*models.AICompanion, error) {
-	query := `
-		SELECT id, user_id, name, avatar_url, personality_signature,
-			   conversation_fluency, knowledge_breadth, empathy_depth,
-			   creativity_level, humor_sense, total_experience, current_level,
-			   growth_percentage, growth_mode, gender, voice_type,
-			   personality_traits, learned_vocabulary, memory_summary,
-			   is_growth_completed, last_active_at, created_at, updated_at
-		FROM ai_companions 
-		WHERE user_id = ?
-		ORDER BY created_at DESC
-	`
+// GetUserCompanions 获取用户的AI伙伴列表，默认伙伴排在最前，includeArchived为false时不含已归档的
+func (s *CompanionService) GetUserCompanions(userID int, includeArchived bool) ([]*models.AICompanion, error) {
+	query := `SELECT ` + companionColumns + ` FROM ai_companions WHERE user_id = ?`
+	if !includeArchived {
+		query += " AND archived_at IS NULL"
+	}
+	query += " ORDER BY archived_at IS NOT NULL, is_default DESC, created_at DESC"
 
 	rows, err := s.db.Query(query, userID)
 	if err != nil {
@@ -88,79 +193,67 @@ func (s *CompanionService) GetUserCompanions(userID int) ([]*models.AICompanion,
 	}
 	defer rows.Close()
 
-	var companions []*models.AICompanion
+	companions := []*models.AICompanion{}
 	for rows.Next() {
-		var companion models.AICompanion
-		err := rows.Scan(
-			&companion.ID, &companion.UserID, &companion.Name, &companion.AvatarURL,
-			&companion.PersonalitySignature, &companion.ConversationFluency,
-			&companion.KnowledgeBreadth, &companion.EmpathyDepth,
-			&companion.CreativityLevel, &companion.HumorSense,
-			&companion.TotalExperience, &companion.CurrentLevel,
-			&companion.GrowthPercentage, &companion.GrowthMode,
-			&companion.Gender, &companion.VoiceType,
-			&companion.PersonalityTraits, &companion.LearnedVocabulary,
-			&companion.MemorySummary, &companion.IsGrowthCompleted,
-			&companion.LastActiveAt, &companion.CreatedAt, &companion.UpdatedAt,
-		)
+		companion, err := scanCompanion(rows)
 		if err != nil {
 			return nil, fmt.Errorf("扫描AI伙伴数据失败: %v", err)
 		}
-		companions = append(companions, &companion)
+		companions = append(companions, companion)
 	}
 
 	return companions, nil
 }
 
-// GetCompanion 获取单个AI伙伴信息
-func (s *CompanionService) GetCompanion(companionID int) (*models.AICompanion, error) {
-	query := `
-		SELECT id, user_id, name, avatar_url, personality_signature,
-			   conversation_fluency, knowledge_breadth, empathy_depth,
-			   creativity_level, humor_sense, total_experience, current_level,
-			   growth_percentage, growth_mode, gender, voice_type,
-			   personality_traits, learned_vocabulary, memory_summary,
-			   is_growth_completed, last_active_at, created_at, updated_at
-		FROM ai_companions 
-		WHERE id = ?
-	`
-
-	var companion models.AICompanion
-	err := s.db.QueryRow(query, companionID).Scan(
-		&companion.ID, &companion.UserID, &companion.Name, &companion.AvatarURL,
-		&companion.PersonalitySignature, &companion.ConversationFluency,
-		&companion.KnowledgeBreadth, &companion.EmpathyDepth,
-		&companion.CreativityLevel, &companion.HumorSense,
-		&companion.TotalExperience, &companion.CurrentLevel,
-		&companion.GrowthPercentage, &companion.GrowthMode,
-		&companion.Gender, &companion.VoiceType,
-		&companion.PersonalityTraits, &companion.LearnedVocabulary,
-		&companion.MemorySummary, &companion.IsGrowthCompleted,
-		&companion.LastActiveAt, &companion.CreatedAt, &companion.UpdatedAt,
-	)
-
+// GetCompanion 获取用户的单个AI伙伴信息
+func (s *CompanionService) GetCompanion(userID, companionID int) (*models.AICompanion, error) {
+	row := s.db.QueryRow(`
+		SELECT `+companionColumns+` FROM ai_companions WHERE id = ? AND user_id = ?
+	`, companionID, userID)
+	companion, err := scanCompanion(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("AI伙伴不存在")
+			return nil, ErrCompanionNotFound
 		}
 		return nil, fmt.Errorf("获取AI伙伴信息失败: %v", err)
 	}
 
-	return &companion, nil
+	return companion, nil
+}
+
+// GetDefaultCompanion 获取用户的默认AI伙伴
+func (s *CompanionService) GetDefaultCompanion(userID int) (*models.AICompanion, error) {
+	row := s.db.QueryRow(`
+		SELECT `+companionColumns+` FROM ai_companions
+		WHERE user_id = ? AND is_default = TRUE AND archived_at IS NULL
+		LIMIT 1
+	`, userID)
+	companion, err := scanCompanion(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCompanionNotFound
+		}
+		return nil, fmt.Errorf("获取默认AI伙伴失败: %v", err)
+	}
+	return companion, nil
 }
 
 // UpdateCompanion 更新AI伙伴信息
-func (s *CompanionService) UpdateCompanion(companionID int, req models.UpdateCompanionRequest) error {
+func (s *CompanionService) UpdateCompanion(userID, companionID int, req models.UpdateCompanionRequest) error {
+	if _, err := s.GetCompanion(userID, companionID); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE ai_companions 
 		SET name = ?, gender = ?, personality_traits = ?, 
 			learned_vocabulary = ?, memory_summary = ?, updated_at = NOW()
-		WHERE id = ?
+		WHERE id = ? AND user_id = ?
 	`
 
 	_, err := s.db.Exec(query,
 		req.Name, req.Gender, req.PersonalityTraits,
-		req.LearnedVocabulary, req.MemorySummary, companionID,
+		req.LearnedVocabulary, req.MemorySummary, companionID, userID,
 	)
 
 	if err != nil {
@@ -170,24 +263,169 @@ func (s *CompanionService) UpdateCompanion(companionID int, req models.UpdateCom
 	return nil
 }
 
+// SetDefaultCompanion 把指定AI伙伴设为默认伙伴，已归档的不能设为默认
+func (s *CompanionService) SetDefaultCompanion(userID, companionID int) (*models.AICompanion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("设置默认AI伙伴失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	// 与归档、恢复串行，锁内重新检查归档状态
+	if _, _, err := lockCompanionSlots(tx, userID); err != nil {
+		return nil, err
+	}
+	archived, _, err := lockCompanionState(tx, userID, companionID)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		return nil, ErrCompanionArchived
+	}
+
+	_, err = tx.Exec(`UPDATE ai_companions SET is_default = (id = ?) WHERE user_id = ?`, companionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("设置默认AI伙伴失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("设置默认AI伙伴失败: %v", err)
+	}
+
+	return s.GetCompanion(userID, companionID)
+}
+
+// lockCompanionState 在事务中锁定AI伙伴行并读取归档和默认状态
+func lockCompanionState(tx *sql.Tx, userID, companionID int) (archived bool, isDefault bool, err error) {
+	err = tx.QueryRow(`
+		SELECT archived_at IS NOT NULL, is_default FROM ai_companions
+		WHERE id = ? AND user_id = ?
+		FOR UPDATE
+	`, companionID, userID).Scan(&archived, &isDefault)
+	if err == sql.ErrNoRows {
+		return false, false, ErrCompanionNotFound
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("查询AI伙伴失败: %v", err)
+	}
+	return archived, isDefault, nil
+}
+
+// ArchiveCompanion 归档AI伙伴，保留其对话和成长数据
+// 归档的是默认伙伴时，最近活跃的其他未归档伙伴成为新的默认伙伴
+func (s *CompanionService) ArchiveCompanion(userID, companionID int) (*models.AICompanion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("归档AI伙伴失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	// 与设为默认、恢复串行，锁内读取归档和默认状态
+	if _, _, err := lockCompanionSlots(tx, userID); err != nil {
+		return nil, err
+	}
+	archived, isDefault, err := lockCompanionState(tx, userID, companionID)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		return nil, ErrCompanionArchived
+	}
+
+	_, err = tx.Exec(`
+		UPDATE ai_companions SET archived_at = NOW(), is_default = FALSE WHERE id = ? AND user_id = ?
+	`, companionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("归档AI伙伴失败: %v", err)
+	}
+
+	if isDefault {
+		_, err = tx.Exec(`
+			UPDATE ai_companions SET is_default = TRUE
+			WHERE user_id = ? AND archived_at IS NULL
+			ORDER BY last_active_at DESC, id DESC
+			LIMIT 1
+		`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("更新默认AI伙伴失败: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("归档AI伙伴失败: %v", err)
+	}
+
+	return s.GetCompanion(userID, companionID)
+}
+
+// RestoreCompanion 恢复已归档的AI伙伴，占用一个名额；用户没有默认伙伴时成为默认伙伴
+func (s *CompanionService) RestoreCompanion(userID, companionID int) (*models.AICompanion, error) {
+	companion, err := s.GetCompanion(userID, companionID)
+	if err != nil {
+		return nil, err
+	}
+	if companion.ArchivedAt == nil {
+		return nil, ErrCompanionNotArchived
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("恢复AI伙伴失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	count, hasDefault, err := lockCompanionSlots(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= s.slotLimit {
+		return nil, ErrCompanionSlotsFull
+	}
+
+	result, err := tx.Exec(`
+		UPDATE ai_companions SET archived_at = NULL, is_default = ?, updated_at = NOW()
+		WHERE id = ? AND user_id = ? AND archived_at IS NOT NULL
+	`, !hasDefault, companionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("恢复AI伙伴失败: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// 并发请求已经恢复了该伙伴
+		return nil, ErrCompanionNotArchived
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("恢复AI伙伴失败: %v", err)
+	}
+
+	return s.GetCompanion(userID, companionID)
+}
 
 // GetGrowthStatus 获取AI伙伴成长状态
-func (s *CompanionService) GetGrowthStatus(companionID int) (*models.GrowthProgressResponse, error) {
-	companion, err := s.GetCompanion(companionID)
+func (s *CompanionService) GetGrowthStatus(userID, companionID int) (*models.GrowthProgressResponse, error) {
+	companion, err := s.GetCompanion(userID, companionID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 计算下一个里程碑
-	var nextMilestone string
-	if companion.GrowthPercentage < 30 {
-		nextMilestone = "学会基本对话"
-	} else if companion.GrowthPercentage < 70 {
-		nextMilestone = "形成稳定人格"
-	} else if companion.GrowthPercentage < 100 {
-		nextMilestone = "完全成熟"
-	} else {
-		nextMilestone = "成长完成"
+	// 成长进度和里程碑由AI伙伴成长模式的经验曲线决定
+	curve := growth.CurveFor(companion.GrowthMode)
+	nextMilestone := "成长完成"
+	if next := growth.NextMilestone(companion.GrowthPercentage); next != nil {
+		nextMilestone = next.Name + "：" + next.Description
+	}
+	milestones := make([]models.GrowthMilestone, 0, len(growth.Milestones))
+	for _, m := range growth.Milestones {
+		milestones = append(milestones, models.GrowthMilestone{
+			Key:         m.Key,
+			Name:        m.Name,
+			Description: m.Description,
+			Progress:    m.Progress,
+			Reached:     companion.GrowthPercentage >= m.Progress,
+		})
+	}
+
+	skills, err := loadCompanionSkills(s.db, companion.ID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.GrowthProgressResponse{
@@ -197,11 +435,21 @@ func (s *CompanionService) GetGrowthStatus(companionID int) (*models.GrowthProgr
 		TotalExperience:   companion.TotalExperience,
 		IsGrowthCompleted: companion.IsGrowthCompleted,
 		NextMilestone:     nextMilestone,
+		LevelProgress:     curve.LevelProgress(companion.TotalExperience),
+		ExperienceToNext:  curve.ExperienceToNext(companion.TotalExperience),
+		MaxLevel:          curve.MaxLevel(),
+		Milestones:        milestones,
+		Skills:            skills,
+		LockedSkills:      lockedSkills(skills),
 	}, nil
 }
 
 // GetDiary 获取AI伙伴日记
-func (s *CompanionService) GetDiary(companionID int, limit int) ([]*models.CompanionDiary, error) {
+func (s *CompanionService) GetDiary(userID, companionID int, limit int) ([]*models.CompanionDiary, error) {
+	if _, err := s.GetCompanion(userID, companionID); err != nil {
+		return nil, err
+	}
+
 	query := `
 		SELECT id, companion_id, date, title, content, mood_score, 
 			   is_user_mentioned, created_at
@@ -234,49 +482,62 @@ func (s *CompanionService) GetDiary(companionID int, limit int) ([]*models.Compa
 	return diaries, nil
 }
 
-// AddExperience 为AI伙伴添加经验值
-func (s *CompanionService) AddExperience(companionID int, experience int) error {
-	// 更新经验值
-	query := `
-		UPDATE ai_companions 
-		SET total_experience = total_experience + ?, 
-			current_level = FLOOR(total_experience / 100) + 1,
-			growth_percentage = LEAST(100.0, (total_experience / 1000.0) * 100),
-			updated_at = NOW()
-		WHERE id = ?
-	`
+// AddExperience 为AI伙伴添加经验值，由成长引擎结算等级、进度和完成状态
+func (s *CompanionService) AddExperience(userID, companionID int, experience int) (*growth.Result, error) {
+	if _, err := s.GetCompanion(userID, companionID); err != nil {
+		return nil, err
+	}
 
-	_, err := s.db.Exec(query, experience, companionID)
+	result, err := s.growthEngine.AddExperience(companionID, experience)
+	if errors.Is(err, growth.ErrCompanionNotFound) {
+		return nil, ErrCompanionNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("更新经验值失败: %v", err)
+		return nil, fmt.Errorf("更新经验值失败: %v", err)
 	}
+	publishGrowthEvents(s.eventHub, userID, result)
+	return result, nil
+}
 
-	// 检查是否完成成长
-	var growthPercentage float64
-	err = s.db.QueryRow("SELECT growth_percentage FROM ai_companions WHERE id = ?", companionID).Scan(&growthPercentage)
-	if err != nil {
-		return fmt.Errorf("查询成长进度失败: %v", err)
+// publishGrowthEvents 推送经验结算带来的升级和里程碑事件
+func publishGrowthEvents(hub *EventHub, userID int, result *growth.Result) {
+	if result.LevelUp {
+		hub.Publish(userID, EventCompanionLevelUp, LevelUpEvent{
+			CompanionID:      result.CompanionID,
+			PreviousLevel:    result.PreviousLevel,
+			CurrentLevel:     result.CurrentLevel,
+			TotalExperience:  result.TotalExperience,
+			GrowthPercentage: result.GrowthPercentage,
+		})
 	}
+	for _, milestone := range result.ReachedMilestones {
+		hub.Publish(userID, EventMilestoneReached, MilestoneReachedEvent{
+			CompanionID: result.CompanionID,
+			Milestone:   milestone,
+		})
+	}
+}
 
-	if growthPercentage >= 100.0 {
-		_, err = s.db.Exec("UPDATE ai_companions SET is_growth_completed = TRUE WHERE id = ?", companionID)
-		if err != nil {
-			return fmt.Errorf("更新成长完成状态失败: %v", err)
-		}
+// GetEmotionState 获取AI伙伴当前情绪状态（用于粒子小球外观），情绪随时间向平静回落
+func (s *CompanionService) GetEmotionState(userID, companionID int) (*models.EmotionState, error) {
+	if _, err := s.GetCompanion(userID, companionID); err != nil {
+		return nil, err
 	}
+	return loadEmotionState(s.db, companionID, time.Now())
+}
 
-	return nil
+// GetEmotionHistory 获取AI伙伴最近的情绪变化（用于绘制情绪曲线）
+func (s *CompanionService) GetEmotionHistory(userID, companionID int, req models.EmotionHistoryRequest) ([]models.EmotionHistoryPoint, error) {
+	if _, err := s.GetCompanion(userID, companionID); err != nil {
+		return nil, err
+	}
+	return loadEmotionHistory(s.db, companionID, req)
 }
 
-// GetEmotionState 获取AI伙伴当前情绪状态（用于粒子小球外观）
-func (s *CompanionService) GetEmotionState(companionID int) (*models.EmotionState, error) {
-	// 这里可以根据AI伙伴的成长状态、最近对话等计算情绪
-	// 暂时返回默认的平静状态
-	return &models.EmotionState{
-		Emotion:       "平静",
-		Intensity:     0.5,
-		Color:         "#52b4b4", // 柔绿色
-		Brightness:    0.7,
-		ParticleSpeed: 0.5,
-	}, nil
+// GetGrowthEvents 获取AI伙伴最近的成长事件，包含每次经验和能力变化的防刷调整
+func (s *CompanionService) GetGrowthEvents(userID, companionID int, req models.GrowthEventListRequest) ([]models.GrowthEvent, error) {
+	if _, err := s.GetCompanion(userID, companionID); err != nil {
+		return nil, err
+	}
+	return loadGrowthEvents(s.db, companionID, req)
 }
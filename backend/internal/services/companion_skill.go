@@ -0,0 +1,300 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"seven-ai-backend/internal/models"
+	"strings"
+)
+
+const (
+	skillUsesPerLevel = 5  // 每使用几次技能等级提升一级
+	maxSkillLevel     = 10 // 技能等级上限
+)
+
+// AI伙伴的能力项，对应ai_companions表中的能力值字段（0-10）
+const (
+	AbilityFluency    = "conversation_fluency"
+	AbilityKnowledge  = "knowledge_breadth"
+	AbilityEmpathy    = "empathy_depth"
+	AbilityCreativity = "creativity_level"
+	AbilityHumor      = "humor_sense"
+)
+
+// abilityNames 能力项的中文名称，用于展示解锁条件
+var abilityNames = map[string]string{
+	AbilityFluency:    "语言流畅度",
+	AbilityKnowledge:  "知识广度",
+	AbilityEmpathy:    "共情深度",
+	AbilityCreativity: "创造力",
+	AbilityHumor:      "幽默感",
+}
+
+// SkillDefinition 技能目录中的一项技能
+type SkillDefinition struct {
+	Name        string
+	Description string
+	MinLevel    int            // 解锁所需的最低等级
+	Abilities   map[string]int // 解锁所需的能力值下限
+	Triggers    []string       // 用户消息中包含这些词时视为使用了该技能
+	Prompt      string         // 解锁后加入人设提示词的行为描述
+}
+
+// skillCatalogue AI伙伴可解锁的技能，按解锁难度排列
+var skillCatalogue = []SkillDefinition{
+	{
+		Name:        "讲故事",
+		Description: "能根据你的要求编一个完整的小故事",
+		MinLevel:    2,
+		Abilities:   map[string]int{AbilityCreativity: 3},
+		Triggers:    []string{"故事", "讲个", "童话", "睡前"},
+		Prompt:      "我会讲故事：有人想听故事时，我会编一个有开头、经过和结尾的小故事，情节贴合对方的要求。",
+	},
+	{
+		Name:        "讲笑话",
+		Description: "会讲笑话、接梗，让聊天更轻松",
+		MinLevel:    2,
+		Abilities:   map[string]int{AbilityHumor: 4},
+		Triggers:    []string{"笑话", "段子", "逗我", "逗逗我", "搞笑"},
+		Prompt:      "我会讲笑话：气氛合适或对方想放松时，我会讲一个轻松的笑话或接住对方的梗，但不拿对方的烦恼开玩笑。",
+	},
+	{
+		Name:        "情绪疏导",
+		Description: "在你难过或有压力时倾听并帮你梳理情绪",
+		MinLevel:    3,
+		Abilities:   map[string]int{AbilityEmpathy: 5},
+		Triggers:    []string{"难过", "伤心", "焦虑", "压力", "烦", "委屈", "崩溃", "失眠", "不开心"},
+		Prompt:      "我会情绪疏导：对方情绪低落时，我先倾听和共情，复述并确认对方的感受，再温和地帮对方梳理原因、给一个小而可行的建议，不急着讲道理。",
+	},
+	{
+		Name:        "知识科普",
+		Description: "能用通俗的话解释你好奇的问题",
+		MinLevel:    3,
+		Abilities:   map[string]int{AbilityKnowledge: 5, AbilityFluency: 4},
+		Triggers:    []string{"为什么", "是什么", "原理", "科普", "怎么回事"},
+		Prompt:      "我会知识科普：对方问到知识性的问题时，我会用通俗的比喻解释清楚，不确定的地方如实说明。",
+	},
+	{
+		Name:        "写诗",
+		Description: "能为你写一首短诗",
+		MinLevel:    4,
+		Abilities:   map[string]int{AbilityCreativity: 6, AbilityFluency: 5},
+		Triggers:    []string{"写诗", "写首", "一首诗", "诗歌", "作诗"},
+		Prompt:      "我会写诗：有人想要诗时，我会写一首4到8行的短诗，意象贴合对方提到的事物和心情。",
+	},
+}
+
+// findSkill 在技能目录中查找技能
+func findSkill(name string) (SkillDefinition, bool) {
+	for _, def := range skillCatalogue {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return SkillDefinition{}, false
+}
+
+// companionAbility 读取AI伙伴的某项能力值
+func companionAbility(companion *models.AICompanion, ability string) int {
+	if field := abilityField(companion, ability); field != nil {
+		return *field
+	}
+	return 0
+}
+
+// abilityField 返回AI伙伴某项能力值的字段指针，未知能力返回nil
+func abilityField(companion *models.AICompanion, ability string) *int {
+	switch ability {
+	case AbilityFluency:
+		return &companion.ConversationFluency
+	case AbilityKnowledge:
+		return &companion.KnowledgeBreadth
+	case AbilityEmpathy:
+		return &companion.EmpathyDepth
+	case AbilityCreativity:
+		return &companion.CreativityLevel
+	case AbilityHumor:
+		return &companion.HumorSense
+	default:
+		return nil
+	}
+}
+
+// skillUnlockable AI伙伴的等级和能力值是否满足技能的解锁条件
+func skillUnlockable(def SkillDefinition, companion *models.AICompanion) bool {
+	if companion.CurrentLevel < def.MinLevel {
+		return false
+	}
+	for ability, required := range def.Abilities {
+		if companionAbility(companion, ability) < required {
+			return false
+		}
+	}
+	return true
+}
+
+// skillRequirement 解锁条件的文字说明
+func skillRequirement(def SkillDefinition) string {
+	parts := []string{fmt.Sprintf("等级达到%d", def.MinLevel)}
+	for _, ability := range []string{AbilityFluency, AbilityKnowledge, AbilityEmpathy, AbilityCreativity, AbilityHumor} {
+		if required, ok := def.Abilities[ability]; ok {
+			parts = append(parts, fmt.Sprintf("%s达到%d", abilityNames[ability], required))
+		}
+	}
+	return strings.Join(parts, "，")
+}
+
+// skillTriggered 用户消息是否在请求使用该技能
+func skillTriggered(def SkillDefinition, userMessage string) bool {
+	for _, trigger := range def.Triggers {
+		if strings.Contains(userMessage, trigger) {
+			return true
+		}
+	}
+	return false
+}
+
+// skillProficiency 技能等级对应的熟练程度描述
+func skillProficiency(level int) string {
+	switch {
+	case level >= 8:
+		return "已经非常拿手"
+	case level >= 4:
+		return "已经比较熟练"
+	default:
+		return "还在练习，偶尔会有些生疏"
+	}
+}
+
+// loadCompanionSkills 获取AI伙伴已解锁的技能，按解锁时间排列
+func loadCompanionSkills(db *sql.DB, companionID int) ([]models.CompanionSkill, error) {
+	rows, err := db.Query(`
+		SELECT id, companion_id, skill_name, skill_level, use_count, last_used_at, unlocked_at
+		FROM companion_skills
+		WHERE companion_id = ?
+		ORDER BY unlocked_at ASC, id ASC
+	`, companionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query companion skills: %w", err)
+	}
+	defer rows.Close()
+
+	skills := []models.CompanionSkill{}
+	for rows.Next() {
+		var skill models.CompanionSkill
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&skill.ID, &skill.CompanionID, &skill.SkillName, &skill.SkillLevel,
+			&skill.UseCount, &lastUsedAt, &skill.UnlockedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan companion skill: %w", err)
+		}
+		if lastUsedAt.Valid {
+			skill.LastUsedAt = &lastUsedAt.Time
+		}
+		if def, ok := findSkill(skill.SkillName); ok {
+			skill.Description = def.Description
+		}
+		skills = append(skills, skill)
+	}
+	return skills, nil
+}
+
+// lockedSkills 技能目录中尚未解锁的技能
+func lockedSkills(unlocked []models.CompanionSkill) []models.LockedSkill {
+	have := make(map[string]bool, len(unlocked))
+	for _, skill := range unlocked {
+		have[skill.SkillName] = true
+	}
+
+	locked := []models.LockedSkill{}
+	for _, def := range skillCatalogue {
+		if have[def.Name] {
+			continue
+		}
+		locked = append(locked, models.LockedSkill{
+			SkillName:   def.Name,
+			Description: def.Description,
+			Requirement: skillRequirement(def),
+		})
+	}
+	return locked
+}
+
+// unlockSkills 解锁AI伙伴已满足条件的技能，返回本次新解锁的技能名
+func (s *ConversationService) unlockSkills(userID int, companion *models.AICompanion, unlocked []models.CompanionSkill) ([]string, error) {
+	have := make(map[string]bool, len(unlocked))
+	for _, skill := range unlocked {
+		have[skill.SkillName] = true
+	}
+
+	var newSkills []string
+	for _, def := range skillCatalogue {
+		if have[def.Name] || !skillUnlockable(def, companion) {
+			continue
+		}
+		// 唯一键 (companion_id, skill_name) 防止并发对话重复解锁
+		result, err := s.db.Exec(`
+			INSERT IGNORE INTO companion_skills (companion_id, skill_name, skill_level, use_count, unlocked_at)
+			VALUES (?, ?, 1, 0, NOW())
+		`, companion.ID, def.Name)
+		if err != nil {
+			return newSkills, fmt.Errorf("failed to unlock skill: %w", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+		newSkills = append(newSkills, def.Name)
+		s.eventHub.Publish(userID, EventSkillUnlocked, SkillUnlockedEvent{
+			CompanionID: companion.ID,
+			SkillName:   def.Name,
+			Description: def.Description,
+		})
+	}
+	return newSkills, nil
+}
+
+// recordSkillUse 用户消息用到了已解锁的技能时累计使用次数，每用满一定次数技能升一级
+func (s *ConversationService) recordSkillUse(unlocked []models.CompanionSkill, userMessage string) error {
+	for _, skill := range unlocked {
+		def, ok := findSkill(skill.SkillName)
+		if !ok || !skillTriggered(def, userMessage) {
+			continue
+		}
+		// MySQL按顺序赋值，计算skill_level时use_count已是加1后的值
+		_, err := s.db.Exec(`
+			UPDATE companion_skills
+			SET use_count = use_count + 1,
+			    skill_level = LEAST(?, 1 + FLOOR(use_count / ?)),
+			    last_used_at = NOW()
+			WHERE id = ?
+		`, maxSkillLevel, skillUsesPerLevel, skill.ID)
+		if err != nil {
+			return fmt.Errorf("failed to record skill use: %w", err)
+		}
+	}
+	return nil
+}
+
+// skillPrompt 已解锁技能对应的人设描述；用户本次消息用到某个技能时提示发挥该技能
+func skillPrompt(skills []models.CompanionSkill, userMessage string) string {
+	if len(skills) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\n我已经学会的技能：")
+	var requested []string
+	for _, skill := range skills {
+		def, ok := findSkill(skill.SkillName)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "\n- %s（%s）", def.Prompt, skillProficiency(skill.SkillLevel))
+		if userMessage != "" && skillTriggered(def, userMessage) {
+			requested = append(requested, def.Name)
+		}
+	}
+	if len(requested) > 0 {
+		fmt.Fprintf(&b, "\n这次对方的话和我的「%s」技能有关，请发挥这个技能来回应。", strings.Join(requested, "」「"))
+	}
+	return b.String()
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultContextTokenBudget = 3000 // 单次请求的上下文token预算
+	contextReplyReserve       = 256  // 为模型回复预留的token
+	contextMessageOverhead    = 4    // 每条消息的角色、分隔符等额外开销
+	contextMaxTurns           = 200  // 单次最多回溯的对话轮数
+	summaryMaxTokens          = 400  // 滚动摘要的最大长度
+	summaryBatchTurns         = 40   // 每次增量摘要最多合并的对话轮数
+)
+
+// tokenProfile 不同模型分词器的近似换算比例
+type tokenProfile struct {
+	cjkPerToken   float64 // 每个token约对应的中日韩字符数
+	asciiPerToken float64 // 每个token约对应的ASCII字符数
+}
+
+// tokenProfiles 按模型名前缀匹配，未匹配时使用default
+var tokenProfiles = map[string]tokenProfile{
+	"qwen":     {cjkPerToken: 1.4, asciiPerToken: 4.0},
+	"deepseek": {cjkPerToken: 1.2, asciiPerToken: 3.8},
+	"gpt":      {cjkPerToken: 0.9, asciiPerToken: 4.0},
+	"default":  {cjkPerToken: 1.0, asciiPerToken: 3.5},
+}
+
+// CountTokens 估算文本在指定模型下的token数
+func CountTokens(model, text string) int {
+	profile := tokenProfiles["default"]
+	for prefix, p := range tokenProfiles {
+		if prefix != "default" && strings.HasPrefix(strings.ToLower(model), prefix) {
+			profile = p
+			break
+		}
+	}
+
+	var cjk, other int
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r > 0xFFFF {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	tokens := float64(cjk)/profile.cjkPerToken + float64(other)/profile.asciiPerToken
+	return int(tokens + 0.999)
+}
+
+// countMessageTokens 估算一条消息的token数
+func countMessageTokens(model string, msg Message) int {
+	return CountTokens(model, msg.Content) + contextMessageOverhead
+}
+
+// contextRequest 组装上下文的参数
+type contextRequest struct {
+	UserID         int
+	Target         models.ChatTarget
+	Model          string
+	SystemPrompt   string
+	Memories       []string // 检索到的相关记忆，按重要性排序
+	CurrentMessage string
+	// 仅使用该消息之前的对话（重新生成时），为0表示使用全部
+	BeforeID   int
+	BeforeTime time.Time
+}
+
+// conversationSummary 每个用户与角色或AI伙伴的滚动摘要
+type conversationSummary struct {
+	Summary           string
+	SummarizedUntilID int // 摘要覆盖到的最后一条消息ID
+}
+
+// SetContextTokenBudget 设置上下文token预算
+func (s *ConversationService) SetContextTokenBudget(budget int) {
+	s.contextBudget = budget
+}
+
+// assembleContext 在token预算内依次放入系统提示词、记忆、摘要和最近的对话
+// 超出预算被挤出的旧对话由后台增量合并进摘要
+func (s *ConversationService) assembleContext(req contextRequest) ([]Message, error) {
+	budget := s.contextBudget
+	if budget <= 0 {
+		budget = defaultContextTokenBudget
+	}
+
+	systemMsg := Message{Role: "system", Content: req.SystemPrompt}
+	currentMsg := Message{Role: "user", Content: req.CurrentMessage}
+	remaining := budget - contextReplyReserve - countMessageTokens(req.Model, systemMsg) - countMessageTokens(req.Model, currentMsg)
+
+	// 记忆按顺序放入，放不下的丢弃
+	var memoryLines []string
+	for _, memory := range req.Memories {
+		cost := CountTokens(req.Model, memory) + 2
+		if cost > remaining {
+			break
+		}
+		memoryLines = append(memoryLines, memory)
+		remaining -= cost
+	}
+
+	summary, err := s.getConversationSummary(req.UserID, req.Target)
+	if err != nil {
+		return nil, err
+	}
+	// 重新生成旧消息时，摘要可能包含该消息之后的内容，不能使用
+	if req.BeforeID > 0 && summary.SummarizedUntilID >= req.BeforeID {
+		summary = &conversationSummary{}
+	}
+	summaryText := ""
+	if summary.Summary != "" {
+		summaryText = "\n\n之前对话的摘要：\n" + summary.Summary
+		if cost := CountTokens(req.Model, summaryText); cost <= remaining {
+			remaining -= cost
+		} else {
+			summaryText = ""
+		}
+	}
+
+	turns, err := s.recentTurns(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 从最新的一轮往前放，直到预算用完
+	var kept []Message
+	evictedUntilID := 0
+	for i, turn := range turns {
+		var turnMessages []Message
+		if turn.UserMessage != "" {
+			turnMessages = append(turnMessages, Message{Role: "user", Content: turn.UserMessage})
+		}
+		if turn.AIResponse != "" {
+			turnMessages = append(turnMessages, Message{Role: "assistant", Content: turn.AIResponse})
+		}
+		cost := 0
+		for _, m := range turnMessages {
+			cost += countMessageTokens(req.Model, m)
+		}
+		if cost > remaining {
+			evictedUntilID = turns[i].ID
+			break
+		}
+		remaining -= cost
+		kept = append(turnMessages, kept...)
+	}
+
+	// 被挤出且尚未进入摘要的对话，后台合并进摘要（下一次请求生效）
+	if req.BeforeID == 0 && evictedUntilID > summary.SummarizedUntilID {
+		s.scheduleSummaryUpdate(req.UserID, req.Target, req.Model, evictedUntilID)
+	}
+
+	systemPrompt := req.SystemPrompt
+	systemPrompt += memoryPrompt(memoryLines)
+	systemPrompt += summaryText
+
+	messages := []Message{{Role: "system", Content: systemPrompt}}
+	messages = append(messages, kept...)
+	messages = append(messages, currentMsg)
+	return messages, nil
+}
+
+// recentTurns 按时间倒序获取最近的对话（已被摘要覆盖的也会取出，是否放入由预算决定）
+func (s *ConversationService) recentTurns(req contextRequest) ([]models.Conversation, error) {
+	filter, value := targetFilter("", req.Target)
+	query := `
+		SELECT id, COALESCE(user_message, ''), COALESCE(ai_response, ''), created_at
+		FROM conversations
+		WHERE user_id = ? AND ` + filter + ` AND deleted_at IS NULL
+	`
+	args := []interface{}{req.UserID, value}
+	if req.BeforeID > 0 {
+		query += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		args = append(args, req.BeforeTime, req.BeforeTime, req.BeforeID)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, contextMaxTurns)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent turns: %w", err)
+	}
+	defer rows.Close()
+
+	var turns []models.Conversation
+	for rows.Next() {
+		var turn models.Conversation
+		if err := rows.Scan(&turn.ID, &turn.UserMessage, &turn.AIResponse, &turn.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan recent turn: %w", err)
+		}
+		turns = append(turns, turn)
+	}
+	return turns, nil
+}
+
+// getConversationSummary 获取滚动摘要，不存在时返回空摘要
+// 摘要表中角色和AI伙伴的未使用一列记为0，以便参与唯一键
+func (s *ConversationService) getConversationSummary(userID int, target models.ChatTarget) (*conversationSummary, error) {
+	var summary conversationSummary
+	err := s.db.QueryRow(`
+		SELECT summary, summarized_until_id FROM conversation_summaries
+		WHERE user_id = ? AND character_id = ? AND companion_id = ?
+	`, userID, target.CharacterID, target.CompanionID).Scan(&summary.Summary, &summary.SummarizedUntilID)
+	if err == sql.ErrNoRows {
+		return &conversationSummary{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation summary: %w", err)
+	}
+	return &summary, nil
+}
+
+// sqlExecer 可以执行写语句的*sql.DB或*sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// invalidateSummary 删除或编辑已被摘要覆盖的消息后清空摘要，
+// 下次构建上下文时从头重新摘要，避免已删除或修改前的内容继续进入提示词
+func invalidateSummary(db sqlExecer, userID int, target models.ChatTarget, messageID int) error {
+	_, err := db.Exec(`
+		UPDATE conversation_summaries SET summary = '', summarized_until_id = 0, updated_at = NOW()
+		WHERE user_id = ? AND character_id = ? AND companion_id = ? AND summarized_until_id >= ?
+	`, userID, target.CharacterID, target.CompanionID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate conversation summary: %w", err)
+	}
+	return nil
+}
+
+// summaryJobs 正在进行的摘要任务，避免同一用户角色重复摘要
+var summaryJobs sync.Map
+
+// scheduleSummaryUpdate 后台把截止到untilID的对话合并进摘要
+func (s *ConversationService) scheduleSummaryUpdate(userID int, target models.ChatTarget, model string, untilID int) {
+	key := fmt.Sprintf("%d:%d:%d", userID, target.CharacterID, target.CompanionID)
+	if _, running := summaryJobs.LoadOrStore(key, true); running {
+		return
+	}
+	go func() {
+		defer summaryJobs.Delete(key)
+		if err := s.updateConversationSummary(userID, target, model, untilID); err != nil {
+			log.Printf("更新对话摘要失败: userID=%d, target=%+v, err=%v", userID, target, err)
+		}
+	}()
+}
+
+// updateConversationSummary 增量更新摘要：已有摘要 + 新挤出的对话 → 新摘要
+func (s *ConversationService) updateConversationSummary(userID int, target models.ChatTarget, model string, untilID int) error {
+	summary, err := s.getConversationSummary(userID, target)
+	if err != nil {
+		return err
+	}
+	filter, value := targetFilter("", target)
+
+	for summary.SummarizedUntilID < untilID {
+		rows, err := s.db.Query(`
+			SELECT id, COALESCE(user_message, ''), COALESCE(ai_response, '')
+			FROM conversations
+			WHERE user_id = ? AND `+filter+` AND deleted_at IS NULL AND id > ? AND id <= ?
+			ORDER BY id ASC
+			LIMIT ?
+		`, userID, value, summary.SummarizedUntilID, untilID, summaryBatchTurns)
+		if err != nil {
+			return fmt.Errorf("failed to query turns to summarize: %w", err)
+		}
+
+		var transcript strings.Builder
+		lastID := summary.SummarizedUntilID
+		for rows.Next() {
+			var id int
+			var userMessage, aiResponse string
+			if err := rows.Scan(&id, &userMessage, &aiResponse); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan turn to summarize: %w", err)
+			}
+			fmt.Fprintf(&transcript, "用户：%s\n角色：%s\n", userMessage, aiResponse)
+			lastID = id
+		}
+		rows.Close()
+		if lastID == summary.SummarizedUntilID {
+			break
+		}
+
+		messages := []Message{
+			{Role: "system", Content: "你负责维护一段对话的长期摘要。请把新的对话内容合并进已有摘要，保留用户的个人信息、偏好、重要事件和双方的约定，删去寒暄和重复内容。用第三人称陈述，不超过300字，只输出摘要本身。"},
+			{Role: "user", Content: fmt.Sprintf("已有摘要：\n%s\n\n新的对话：\n%s", summary.Summary, transcript.String())},
+		}
+		newSummary, err := s.aiService.ChatWithLLMMaxTokens(messages, model, 0.3, "text", summaryMaxTokens)
+		if err != nil {
+			return fmt.Errorf("failed to summarize conversation: %w", err)
+		}
+
+		// 摘要期间消息被删除或编辑时摘要已被清空，此时不写回，避免旧内容复活
+		previousUntilID := summary.SummarizedUntilID
+		summary.Summary = strings.TrimSpace(newSummary)
+		summary.SummarizedUntilID = lastID
+		_, err = s.db.Exec(`
+			INSERT INTO conversation_summaries (user_id, character_id, companion_id, summary, summarized_until_id, updated_at)
+			VALUES (?, ?, ?, ?, ?, NOW())
+			ON DUPLICATE KEY UPDATE
+				summary = IF(summarized_until_id = ?, VALUES(summary), summary),
+				summarized_until_id = IF(summarized_until_id = ?, VALUES(summarized_until_id), summarized_until_id),
+				updated_at = NOW()
+		`, userID, target.CharacterID, target.CompanionID, summary.Summary, summary.SummarizedUntilID,
+			previousUntilID, previousUntilID)
+		if err != nil {
+			return fmt.Errorf("failed to save conversation summary: %w", err)
+		}
+
+		stored, err := s.getConversationSummary(userID, target)
+		if err != nil {
+			return err
+		}
+		if stored.SummarizedUntilID != lastID {
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"time"
+)
+
+// ErrNothingToExport 没有可导出的聊天记录
+var ErrNothingToExport = errors.New("没有可导出的聊天记录")
+
+// exportVersion JSON导出格式版本，重新导入时据此解析
+const exportVersion = 1
+
+// ExportChat 一个角色（或AI伙伴）的聊天
+type ExportChat struct {
+	CharacterID int    `json:"character_id"`
+	CompanionID *int   `json:"companion_id,omitempty"`
+	Name        string `json:"name"`
+}
+
+// target 聊天对应的聊天对象
+func (chat ExportChat) target() models.ChatTarget {
+	if chat.CompanionID != nil {
+		return models.ChatTarget{CompanionID: *chat.CompanionID}
+	}
+	return models.ChatTarget{CharacterID: chat.CharacterID}
+}
+
+// exportTarget 导出请求指定的聊天对象，都未指定时为空值（导出全部）
+func exportTarget(req models.ConversationExportRequest) models.ChatTarget {
+	return models.ChatTarget{CharacterID: req.CharacterID, CompanionID: req.CompanionID}
+}
+
+// exportMessage 导出的一条消息
+type exportMessage struct {
+	ID          int       `json:"id"`
+	SessionID   string    `json:"session_id"`
+	MessageType string    `json:"message_type"`
+	UserMessage string    `json:"user_message"`
+	AIResponse  string    `json:"ai_response"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	AudioURL    string    `json:"audio_url,omitempty"`
+	HasImage    bool      `json:"has_image,omitempty"` // 图片以base64内嵌存储，导出时省略数据
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// exportFormatter 逐条写出聊天内容，避免把整段历史载入内存
+type exportFormatter interface {
+	Begin(chat ExportChat, exportedAt time.Time) error
+	Message(msg exportMessage) error
+	Diary(diary models.CompanionDiary) error
+	End() error
+}
+
+// newExportFormatter 创建指定格式的写出器
+func newExportFormatter(format string, w io.Writer) (exportFormatter, error) {
+	switch format {
+	case models.ExportFormatMarkdown:
+		return &markdownExporter{w: w}, nil
+	case models.ExportFormatJSON:
+		return &jsonExporter{w: w}, nil
+	case models.ExportFormatHTML:
+		return &htmlExporter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// ExportContentType 导出文件的Content-Type
+func ExportContentType(req models.ConversationExportRequest) string {
+	if exportTarget(req).IsZero() {
+		return "application/zip"
+	}
+	switch req.Format {
+	case models.ExportFormatJSON:
+		return "application/json; charset=utf-8"
+	case models.ExportFormatHTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+// ExportFileName 导出文件名
+func ExportFileName(req models.ConversationExportRequest, now time.Time) string {
+	stamp := now.Format("20060102_150405")
+	if exportTarget(req).IsZero() {
+		return fmt.Sprintf("seven_ai_chats_%s_%s.zip", req.Format, stamp)
+	}
+	return fmt.Sprintf("seven_ai_chat_%s_%s.%s", exportChatKey(exportTarget(req)), stamp, req.Format)
+}
+
+// exportChatKey 文件名中区分聊天对象的标识，AI伙伴带companion前缀
+func exportChatKey(target models.ChatTarget) string {
+	if target.IsCompanion() {
+		return fmt.Sprintf("companion%d", target.CompanionID)
+	}
+	return fmt.Sprintf("%d", target.CharacterID)
+}
+
+// ListExportChats 获取用户可导出的聊天列表，target为空值时返回全部
+func (s *ConversationService) ListExportChats(userID int, target models.ChatTarget) ([]ExportChat, error) {
+	query := `
+		SELECT COALESCE(c.character_id, 0), c.companion_id, COALESCE(MAX(ac.name), MAX(pc.name), '')
+		FROM conversations c
+		LEFT JOIN preset_characters pc ON pc.id = c.character_id
+		LEFT JOIN ai_companions ac ON ac.id = c.companion_id
+		WHERE c.user_id = ? AND (c.character_id IS NOT NULL OR c.companion_id IS NOT NULL) AND c.deleted_at IS NULL
+	`
+	args := []interface{}{userID}
+	if !target.IsZero() {
+		filter, value := targetFilter("c", target)
+		query += " AND " + filter
+		args = append(args, value)
+	}
+	query += " GROUP BY c.character_id, c.companion_id ORDER BY c.companion_id, c.character_id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query export chats: %w", err)
+	}
+	defer rows.Close()
+
+	var chats []ExportChat
+	for rows.Next() {
+		var chat ExportChat
+		var companionID sql.NullInt64
+		if err := rows.Scan(&chat.CharacterID, &companionID, &chat.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan export chat: %w", err)
+		}
+		if companionID.Valid {
+			id := int(companionID.Int64)
+			chat.CompanionID = &id
+		}
+		if chat.Name == "" {
+			chat.Name = fmt.Sprintf("角色%d", chat.CharacterID)
+		}
+		chats = append(chats, chat)
+	}
+	if len(chats) == 0 {
+		return nil, ErrNothingToExport
+	}
+
+	return chats, nil
+}
+
+// ExportConversations 将聊天记录写入w：指定角色时为单个文件，否则为每个角色一个文件的zip包
+func (s *ConversationService) ExportConversations(userID int, req models.ConversationExportRequest, chats []ExportChat, w io.Writer) error {
+	exportedAt := time.Now()
+
+	if !exportTarget(req).IsZero() {
+		return s.exportChat(userID, chats[0], req.Format, exportedAt, w)
+	}
+
+	archive := zip.NewWriter(w)
+	for _, chat := range chats {
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("%s_%s.%s", exportChatKey(chat.target()), sanitizeExportName(chat.Name), req.Format),
+			Method:   zip.Deflate,
+			Modified: exportedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create archive entry: %w", err)
+		}
+		if err := s.exportChat(userID, chat, req.Format, exportedAt, entry); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// exportChat 导出一个角色的全部消息（AI伙伴附带日记）
+func (s *ConversationService) exportChat(userID int, chat ExportChat, format string, exportedAt time.Time, w io.Writer) error {
+	formatter, err := newExportFormatter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := formatter.Begin(chat, exportedAt); err != nil {
+		return err
+	}
+
+	filter, value := targetFilter("", chat.target())
+	rows, err := s.db.Query(`
+		SELECT id, session_id, message_type, COALESCE(user_message, ''), COALESCE(ai_response, ''),
+		       COALESCE(image_url, ''), COALESCE(audio_url, ''),
+		       image_data IS NOT NULL AND image_data <> '', created_at
+		FROM conversations
+		WHERE user_id = ? AND `+filter+` AND deleted_at IS NULL
+		ORDER BY created_at ASC, id ASC
+	`, userID, value)
+	if err != nil {
+		return fmt.Errorf("failed to query conversations for export: %w", err)
+	}
+	for rows.Next() {
+		var msg exportMessage
+		err := rows.Scan(&msg.ID, &msg.SessionID, &msg.MessageType, &msg.UserMessage, &msg.AIResponse,
+			&msg.ImageURL, &msg.AudioURL, &msg.HasImage, &msg.CreatedAt)
+		if err == nil {
+			err = formatter.Message(msg)
+		}
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to export conversation: %w", err)
+		}
+	}
+	rows.Close()
+
+	if chat.CompanionID != nil {
+		if err := s.exportDiaries(*chat.CompanionID, formatter); err != nil {
+			return err
+		}
+	}
+
+	return formatter.End()
+}
+
+// exportDiaries 导出AI伙伴的日记
+func (s *ConversationService) exportDiaries(companionID int, formatter exportFormatter) error {
+	rows, err := s.db.Query(`
+		SELECT id, companion_id, date, COALESCE(title, ''), content, mood_score, is_user_mentioned, created_at
+		FROM companion_diaries
+		WHERE companion_id = ?
+		ORDER BY date ASC
+	`, companionID)
+	if err != nil {
+		return fmt.Errorf("failed to query diaries for export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var diary models.CompanionDiary
+		err := rows.Scan(&diary.ID, &diary.CompanionID, &diary.Date, &diary.Title, &diary.Content,
+			&diary.MoodScore, &diary.IsUserMentioned, &diary.CreatedAt)
+		if err == nil {
+			err = formatter.Diary(diary)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export diary: %w", err)
+		}
+	}
+	return nil
+}
+
+// sanitizeExportName 去掉文件名中不安全的字符
+func sanitizeExportName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// exportMessageTypeLabel 消息类型的中文名称
+func exportMessageTypeLabel(messageType string) string {
+	switch messageType {
+	case "voice":
+		return "语音"
+	case "image":
+		return "图片"
+	case "emoji":
+		return "表情"
+	default:
+		return "文字"
+	}
+}
+
+// exportAttachments 消息附件的文字描述
+func exportAttachments(msg exportMessage) []string {
+	var refs []string
+	if msg.ImageURL != "" {
+		refs = append(refs, "图片: "+msg.ImageURL)
+	} else if msg.HasImage {
+		refs = append(refs, "图片: （内嵌图片数据未导出）")
+	}
+	if msg.AudioURL != "" {
+		refs = append(refs, "语音: "+msg.AudioURL)
+	}
+	return refs
+}
+
+// markdownExporter Markdown格式
+type markdownExporter struct {
+	w          io.Writer
+	name       string
+	lastDay    string
+	diaryBegun bool
+}
+
+func (e *markdownExporter) Begin(chat ExportChat, exportedAt time.Time) error {
+	e.name = chat.Name
+	_, err := fmt.Fprintf(e.w, "# 与%s的聊天记录\n\n导出时间：%s\n", chat.Name, exportedAt.Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func (e *markdownExporter) Message(msg exportMessage) error {
+	var b strings.Builder
+	if day := msg.CreatedAt.Format("2006-01-02"); day != e.lastDay {
+		e.lastDay = day
+		fmt.Fprintf(&b, "\n## %s\n", day)
+	}
+	clock := msg.CreatedAt.Format("15:04:05")
+	label := exportMessageTypeLabel(msg.MessageType)
+	if msg.UserMessage != "" || msg.HasImage || msg.ImageURL != "" {
+		fmt.Fprintf(&b, "\n**我**（%s · %s）\n\n%s\n", clock, label, markdownQuote(msg.UserMessage))
+		for _, ref := range exportAttachments(msg) {
+			fmt.Fprintf(&b, "\n> 📎 %s\n", ref)
+		}
+	}
+	if msg.AIResponse != "" {
+		fmt.Fprintf(&b, "\n**%s**（%s）\n\n%s\n", e.name, clock, markdownQuote(msg.AIResponse))
+	}
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *markdownExporter) Diary(diary models.CompanionDiary) error {
+	var b strings.Builder
+	if !e.diaryBegun {
+		e.diaryBegun = true
+		fmt.Fprintf(&b, "\n---\n\n# %s的日记\n", e.name)
+	}
+	fmt.Fprintf(&b, "\n## %s %s\n\n心情：%d/10\n\n%s\n", diary.Date.Format("2006-01-02"), diary.Title, diary.MoodScore, diary.Content)
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *markdownExporter) End() error {
+	return nil
+}
+
+// markdownQuote 以引用块输出多行文本
+func markdownQuote(text string) string {
+	if text == "" {
+		return ""
+	}
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
+
+// jsonExporter 结构化JSON格式，可用于重新导入
+type jsonExporter struct {
+	w            io.Writer
+	messageCount int
+	diaryCount   int
+}
+
+func (e *jsonExporter) Begin(chat ExportChat, exportedAt time.Time) error {
+	header := struct {
+		Format     string     `json:"format"`
+		Version    int        `json:"version"`
+		ExportedAt time.Time  `json:"exported_at"`
+		Character  ExportChat `json:"character"`
+	}{"seven-ai-conversations", exportVersion, exportedAt, chat}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	// 去掉结尾的}，继续写入messages数组
+	_, err = fmt.Fprintf(e.w, "%s,\n\"messages\":[", data[:len(data)-1])
+	return err
+}
+
+func (e *jsonExporter) Message(msg exportMessage) error {
+	return e.writeItem(msg, &e.messageCount)
+}
+
+func (e *jsonExporter) Diary(diary models.CompanionDiary) error {
+	if e.diaryCount == 0 {
+		if _, err := io.WriteString(e.w, "\n],\n\"diaries\":["); err != nil {
+			return err
+		}
+	}
+	return e.writeItem(diary, &e.diaryCount)
+}
+
+func (e *jsonExporter) writeItem(item interface{}, count *int) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if *count == 0 {
+		sep = "\n"
+	}
+	*count++
+	_, err = fmt.Fprintf(e.w, "%s%s", sep, data)
+	return err
+}
+
+func (e *jsonExporter) End() error {
+	if e.diaryCount == 0 {
+		_, err := io.WriteString(e.w, "\n],\n\"diaries\":[]}\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
+
+// htmlExporter 自包含的HTML页面
+type htmlExporter struct {
+	w          io.Writer
+	name       string
+	lastDay    string
+	diaryBegun bool
+}
+
+const htmlExportStyle = `body{font-family:-apple-system,"PingFang SC","Microsoft YaHei",sans-serif;max-width:760px;margin:0 auto;padding:24px;background:#f5f5f7;color:#222}
+h1{font-size:22px}h2{font-size:15px;color:#888;text-align:center;margin:28px 0 12px}
+.msg{display:flex;margin:10px 0}.msg.me{justify-content:flex-end}
+.bubble{max-width:70%;padding:10px 14px;border-radius:14px;background:#fff;white-space:pre-wrap;word-break:break-word;box-shadow:0 1px 2px rgba(0,0,0,.06)}
+.me .bubble{background:#95ec69}.meta{font-size:12px;color:#999;margin-top:4px}
+.attach{font-size:12px;color:#576b95;margin-top:4px}
+.diary{background:#fff;border-radius:12px;padding:14px 18px;margin:12px 0}.diary h3{margin:0 0 6px;font-size:16px}`
+
+func (e *htmlExporter) Begin(chat ExportChat, exportedAt time.Time) error {
+	e.name = chat.Name
+	title := html.EscapeString("与" + chat.Name + "的聊天记录")
+	_, err := fmt.Fprintf(e.w, "<!DOCTYPE html>\n<html lang=\"zh-CN\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<h1>%s</h1>\n<p class=\"meta\">导出时间：%s</p>\n",
+		title, htmlExportStyle, title, exportedAt.Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func (e *htmlExporter) Message(msg exportMessage) error {
+	var b strings.Builder
+	if day := msg.CreatedAt.Format("2006-01-02"); day != e.lastDay {
+		e.lastDay = day
+		fmt.Fprintf(&b, "<h2>%s</h2>\n", day)
+	}
+	meta := fmt.Sprintf("%s · %s", msg.CreatedAt.Format("15:04:05"), exportMessageTypeLabel(msg.MessageType))
+	if msg.UserMessage != "" || msg.HasImage || msg.ImageURL != "" {
+		fmt.Fprintf(&b, "<div class=\"msg me\"><div><div class=\"bubble\">%s</div>", html.EscapeString(msg.UserMessage))
+		for _, ref := range exportAttachments(msg) {
+			fmt.Fprintf(&b, "<div class=\"attach\">📎 %s</div>", html.EscapeString(ref))
+		}
+		fmt.Fprintf(&b, "<div class=\"meta\">%s</div></div></div>\n", meta)
+	}
+	if msg.AIResponse != "" {
+		fmt.Fprintf(&b, "<div class=\"msg\"><div><div class=\"bubble\">%s</div><div class=\"meta\">%s · %s</div></div></div>\n",
+			html.EscapeString(msg.AIResponse), html.EscapeString(e.name), msg.CreatedAt.Format("15:04:05"))
+	}
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *htmlExporter) Diary(diary models.CompanionDiary) error {
+	var b strings.Builder
+	if !e.diaryBegun {
+		e.diaryBegun = true
+		fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(e.name+"的日记"))
+	}
+	fmt.Fprintf(&b, "<div class=\"diary\"><h3>%s %s</h3><div class=\"meta\">心情：%d/10</div><p style=\"white-space:pre-wrap\">%s</p></div>\n",
+		diary.Date.Format("2006-01-02"), html.EscapeString(diary.Title), diary.MoodScore, html.EscapeString(diary.Content))
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *htmlExporter) End() error {
+	_, err := io.WriteString(e.w, "</body>\n</html>\n")
+	return err
+}
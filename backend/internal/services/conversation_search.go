@@ -0,0 +1,356 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"seven-ai-backend/internal/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidSearchFilter 搜索过滤条件格式错误
+var ErrInvalidSearchFilter = errors.New("无效的搜索条件")
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 50
+	searchSnippetRadius   = 30 // 片段中命中词前后保留的字符数
+	ngramTokenSize        = 2  // 与MySQL ngram_token_size一致，更短的词无法走全文索引
+
+	semanticSearchChunk = 200 // 语义搜索时每次按相似度顺序送入过滤条件的候选数
+)
+
+// 聊天记录搜索方式
+const (
+	SearchModeKeyword  = "keyword"  // 关键词全文检索（默认）
+	SearchModeSemantic = "semantic" // 向量语义检索
+)
+
+// searchTerms 将搜索词按空白拆分，并去除全文检索的布尔运算符
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		term := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`+-<>()~*"@'\%_`, r) {
+				return -1
+			}
+			return r
+		}, field)
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// SearchConversations 在用户的全部聊天记录中搜索，mode=semantic时按语义相似度检索
+func (s *ConversationService) SearchConversations(userID int, req models.ConversationSearchRequest) ([]models.ConversationSearchResult, error) {
+	terms := searchTerms(req.Query)
+	if len(terms) == 0 {
+		return []models.ConversationSearchResult{}, nil
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = defaultSearchPageSize
+	}
+	if req.Limit > maxSearchPageSize {
+		req.Limit = maxSearchPageSize
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
+	where, args, err := searchFilters(userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Mode {
+	case "", SearchModeKeyword:
+		return s.keywordSearch(req, terms, where, args)
+	case SearchModeSemantic:
+		return s.semanticSearch(userID, req, terms, where, args)
+	default:
+		return nil, fmt.Errorf("%w: mode应为keyword或semantic", ErrInvalidSearchFilter)
+	}
+}
+
+// searchFilters 按用户和过滤参数生成查询条件
+func searchFilters(userID int, req models.ConversationSearchRequest) ([]string, []interface{}, error) {
+	where := []string{"c.user_id = ?", "c.deleted_at IS NULL"}
+	args := []interface{}{userID}
+
+	if req.CharacterID > 0 {
+		where = append(where, "c.character_id = ?")
+		args = append(args, req.CharacterID)
+	}
+	if req.CompanionID > 0 {
+		where = append(where, "c.companion_id = ?")
+		args = append(args, req.CompanionID)
+	}
+	if req.MessageType != "" {
+		where = append(where, "c.message_type = ?")
+		args = append(args, req.MessageType)
+	}
+	if req.From != "" {
+		from, err := time.ParseInLocation("2006-01-02", req.From, time.Local)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: from日期格式应为YYYY-MM-DD", ErrInvalidSearchFilter)
+		}
+		where = append(where, "c.created_at >= ?")
+		args = append(args, from)
+	}
+	if req.To != "" {
+		to, err := time.ParseInLocation("2006-01-02", req.To, time.Local)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: to日期格式应为YYYY-MM-DD", ErrInvalidSearchFilter)
+		}
+		where = append(where, "c.created_at < ?")
+		args = append(args, to.AddDate(0, 0, 1))
+	}
+	return where, args, nil
+}
+
+// keywordSearch 基于ngram全文索引的关键词搜索
+func (s *ConversationService) keywordSearch(req models.ConversationSearchRequest, terms []string, where []string, args []interface{}) ([]models.ConversationSearchResult, error) {
+	// 能走ngram全文索引的词合并为一个布尔查询，单字词退化为LIKE
+	var booleanTerms []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= ngramTokenSize {
+			booleanTerms = append(booleanTerms, `+"`+term+`"`)
+			continue
+		}
+		where = append(where, "(c.user_message LIKE ? OR c.ai_response LIKE ?)")
+		args = append(args, "%"+term+"%", "%"+term+"%")
+	}
+	relevance := "0"
+	var relevanceArgs []interface{}
+	if len(booleanTerms) > 0 {
+		booleanQuery := strings.Join(booleanTerms, " ")
+		where = append(where, "MATCH(c.user_message, c.ai_response) AGAINST (? IN BOOLEAN MODE)")
+		args = append(args, booleanQuery)
+		relevance = "MATCH(c.user_message, c.ai_response) AGAINST (? IN BOOLEAN MODE)"
+		relevanceArgs = append(relevanceArgs, booleanQuery)
+	}
+
+	query := searchSelect(relevance) + `
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY relevance DESC, c.created_at DESC, c.id DESC
+		LIMIT ? OFFSET ?
+	`
+	queryArgs := append(relevanceArgs, args...)
+	queryArgs = append(queryArgs, req.Limit, req.Offset)
+
+	rows, err := s.db.Query(query, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	defer rows.Close()
+	return scanSearchResults(rows, terms)
+}
+
+// semanticSearch 用向量索引按相似度给该用户的全部对话排序，按顺序分批套用过滤条件，
+// 直到凑满当前页；分页建立在过滤后的结果上，翻页时顺序稳定
+func (s *ConversationService) semanticSearch(userID int, req models.ConversationSearchRequest, terms []string, where []string, args []interface{}) ([]models.ConversationSearchResult, error) {
+	if s.vectorIndex == nil {
+		return nil, fmt.Errorf("%w: 未启用语义搜索", ErrInvalidSearchFilter)
+	}
+	queryVector, err := s.vectorIndex.EmbedQuery(req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed search query: %w", err)
+	}
+
+	matches := s.vectorIndex.Search(VectorKindConversation, userID, queryVector, 0)
+	need := req.Offset + req.Limit
+	results := []models.ConversationSearchResult{}
+	for start := 0; start < len(matches) && len(results) < need; start += semanticSearchChunk {
+		end := start + semanticSearchChunk
+		if end > len(matches) {
+			end = len(matches)
+		}
+		chunk, err := s.filterSemanticMatches(matches[start:end], terms, where, args)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, chunk...)
+	}
+
+	if req.Offset >= len(results) {
+		return []models.ConversationSearchResult{}, nil
+	}
+	results = results[req.Offset:]
+	if len(results) > req.Limit {
+		results = results[:req.Limit]
+	}
+	return results, nil
+}
+
+// filterSemanticMatches 对一批候选套用过滤条件，结果保持候选的相似度顺序
+func (s *ConversationService) filterSemanticMatches(matches []VectorMatch, terms []string, where []string, args []interface{}) ([]models.ConversationSearchResult, error) {
+	order := make(map[int]int, len(matches))
+	placeholders := make([]string, len(matches))
+	args = append([]interface{}{}, args...)
+	for i, m := range matches {
+		order[m.RefID] = i
+		placeholders[i] = "?"
+		args = append(args, m.RefID)
+	}
+	where = append(append([]string{}, where...), "c.id IN ("+strings.Join(placeholders, ",")+")")
+
+	rows, err := s.db.Query(searchSelect("0")+`
+		WHERE `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search conversations: %w", err)
+	}
+	defer rows.Close()
+	results, err := scanSearchResults(rows, terms)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Score = matches[order[results[i].MessageID]].Similarity
+	}
+	sort.Slice(results, func(i, j int) bool { return order[results[i].MessageID] < order[results[j].MessageID] })
+	return results, nil
+}
+
+// searchSelect 搜索结果的查询字段，relevance为相关度表达式
+func searchSelect(relevance string) string {
+	return `
+		SELECT c.id, c.session_id, COALESCE(c.character_id, 0), c.companion_id,
+		       COALESCE(ac.name, pc.name, ''), c.message_type,
+		       COALESCE(c.user_message, ''), COALESCE(c.ai_response, ''), c.created_at,
+		       cs.id IS NOT NULL, ` + relevance + ` AS relevance
+		FROM conversations c
+		LEFT JOIN preset_characters pc ON pc.id = c.character_id
+		LEFT JOIN ai_companions ac ON ac.id = c.companion_id
+		LEFT JOIN chat_sessions cs ON cs.id = c.session_id AND cs.user_id = c.user_id
+	`
+}
+
+// scanSearchResults 扫描搜索结果并生成命中片段和上下文地址
+func scanSearchResults(rows *sql.Rows, terms []string) ([]models.ConversationSearchResult, error) {
+	results := []models.ConversationSearchResult{}
+	for rows.Next() {
+		var result models.ConversationSearchResult
+		var companionID sql.NullInt64
+		var userMessage, aiResponse string
+		var hasChatSession bool
+		err := rows.Scan(
+			&result.MessageID, &result.SessionID, &result.CharacterID, &companionID,
+			&result.CharacterName, &result.MessageType,
+			&userMessage, &aiResponse, &result.CreatedAt, &hasChatSession, &result.Score,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		if companionID.Valid {
+			id := int(companionID.Int64)
+			result.CompanionID = &id
+		}
+
+		// 优先在用户消息中定位命中片段
+		result.MatchedField = "user_message"
+		result.Snippet, result.Highlights = buildSnippet(userMessage, terms)
+		if len(result.Highlights) == 0 {
+			if snippet, highlights := buildSnippet(aiResponse, terms); len(highlights) > 0 {
+				result.MatchedField = "ai_response"
+				result.Snippet, result.Highlights = snippet, highlights
+			}
+		}
+
+		// 语音通话的对话记录带着通话的session_id，但没有对应的聊天会话，按聊天对象定位
+		if hasChatSession {
+			result.ContextURL = fmt.Sprintf("/api/v1/conversations/sessions/%s?around=%d", result.SessionID, result.MessageID)
+		} else if result.CompanionID != nil {
+			result.ContextURL = fmt.Sprintf("/api/v1/conversations/history?companion_id=%d&around=%d", *result.CompanionID, result.MessageID)
+		} else {
+			result.ContextURL = fmt.Sprintf("/api/v1/conversations/history?character_id=%d&around=%d", result.CharacterID, result.MessageID)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// buildSnippet 截取第一个命中词附近的文本，并返回片段内所有命中词的位置
+func buildSnippet(text string, terms []string) (string, [][2]int) {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// 大小写转换改变了长度时直接按原文匹配
+		lower = runes
+	}
+
+	first := -1
+	for _, term := range terms {
+		if idx := runeIndex(lower, []rune(strings.ToLower(term)), 0); idx >= 0 && (first < 0 || idx < first) {
+			first = idx
+		}
+	}
+	if first < 0 {
+		if len(runes) > searchSnippetRadius*2 {
+			return string(runes[:searchSnippetRadius*2]) + "…", nil
+		}
+		return text, nil
+	}
+
+	start := first - searchSnippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := first + searchSnippetRadius*2
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(runes) {
+		suffix = "…"
+	}
+	offset := utf8.RuneCountInString(prefix)
+
+	var highlights [][2]int
+	window := lower[start:end]
+	for _, term := range terms {
+		termRunes := []rune(strings.ToLower(term))
+		for from := 0; ; {
+			idx := runeIndex(window, termRunes, from)
+			if idx < 0 {
+				break
+			}
+			highlights = append(highlights, [2]int{offset + idx, offset + idx + len(termRunes)})
+			from = idx + len(termRunes)
+		}
+	}
+
+	return prefix + string(runes[start:end]) + suffix, highlights
+}
+
+// runeIndex 在rune切片中查找子串，from为起始位置
+func runeIndex(haystack, needle []rune, from int) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
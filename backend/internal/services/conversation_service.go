@@ -3,14 +3,19 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"seven-ai-backend/internal/growth"
 	"seven-ai-backend/internal/models"
 	"strings"
 	"time"
 )
 
 type ConversationService struct {
-	db        *sql.DB
-	aiService *AIService
+	db            *sql.DB
+	aiService     *AIService
+	contextBudget int            // 上下文token预算
+	eventHub      *EventHub      // 实时事件推送
+	memoryService *MemoryService // AI伙伴长期记忆
+	vectorIndex   *VectorIndex   // 语义搜索的向量索引，可为nil
 }
 
 func NewConversationService(db *sql.DB, aiService *AIService) *ConversationService {
@@ -20,74 +25,64 @@ func NewConversationService(db *sql.DB, aiService *AIService) *ConversationServi
 	}
 }
 
-func (s *ConversationService) Chat(userID int, req models.ChatRequest) (*models.ChatResponse, error) {
-	// 获取角色信息
-	character, err := s.getCharacterByID(req.CharacterID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get character: %w", err)
-	}
+// SetEventHub 设置实时事件中心
+func (s *ConversationService) SetEventHub(hub *EventHub) {
+	s.eventHub = hub
+}
 
-	// 如果是空白AI（characterID = 5），检查用户是否有AI伙伴
-	if req.CharacterID == 5 {
-		// 检查用户是否已有AI伙伴
-		var companionID int
-		err := s.db.QueryRow("SELECT id FROM ai_companions WHERE user_id = ?", userID).Scan(&companionID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				// 用户还没有AI伙伴，返回引导消息
-				return &models.ChatResponse{
-					Response:  "你好！我是空白AI，一个正在等待被创造的AI伙伴。请先给我起个名字，选择成长模式，然后我们就可以开始聊天了！",
-					SessionID: req.SessionID,
-					Character: character.Name,
-					MessageID: 0,
-				}, nil
-			}
-			// 记录具体错误信息
-			fmt.Printf("Error checking companion for user %d: %v\n", userID, err)
-			return nil, fmt.Errorf("failed to check companion: %w", err)
-		}
+// SetMemoryService 设置记忆服务，与AI伙伴对话后自动提取长期记忆
+func (s *ConversationService) SetMemoryService(memoryService *MemoryService) {
+	s.memoryService = memoryService
+}
+
+// SetVectorIndex 设置向量索引，新对话会写入索引并支持语义搜索
+func (s *ConversationService) SetVectorIndex(index *VectorIndex) {
+	s.vectorIndex = index
+}
 
-		fmt.Printf("Found companion ID %d for user %d\n", companionID, userID)
+// publishMessageCreated 推送新消息事件，让用户的其他设备同步
+func (s *ConversationService) publishMessageCreated(userID int, event MessageCreatedEvent) {
+	s.eventHub.Publish(userID, EventMessageCreated, event)
+}
 
-		// 用户有AI伙伴，生成动态提示词
-		dynamicPrompt, err := s.generateCompanionPrompt(userID, req.Message)
-		if err != nil {
-			fmt.Printf("Error generating companion prompt for user %d: %v\n", userID, err)
-			return nil, fmt.Errorf("failed to generate companion prompt: %w", err)
-		}
-		character.SystemPrompt = dynamicPrompt
-		fmt.Printf("Generated dynamic prompt for companion: %s\n", dynamicPrompt[:min(len(dynamicPrompt), 100)])
+func (s *ConversationService) Chat(userID int, req models.ChatRequest) (*models.ChatResponse, error) {
+	// 获取聊天对象的人设（AI伙伴按成长状态动态生成提示词）
+	character, err := s.getTargetPersona(userID, req.ChatTarget, req.Message)
+	if err != nil {
+		return nil, err
 	}
 
-	// 获取历史对话
-	history, err := s.getConversationHistory(userID, req.CharacterID, 10)
+	// 先确定消息所属会话，无效的session_id不必调用模型
+	session, err := s.resolveChatSession(userID, req.ChatTarget, req.SessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conversation history: %w", err)
+		return nil, fmt.Errorf("failed to resolve chat session: %w", err)
 	}
+	req.SessionID = session.ID
 
 	// 检查用户是否长时间未聊天
-	lastMessageTime, err := s.getLastMessageTime(userID, req.CharacterID)
+	lastMessageTime, err := s.getLastMessageTime(userID, req.ChatTarget)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last message time: %w", err)
 	}
 
-	// 构建消息历史（包含记忆和自然回应）
-	// 转换历史记录类型
-	var conversationHistory []models.Conversation
-	for _, h := range history {
-		conversationHistory = append(conversationHistory, models.Conversation{
-			ID:          h.ID,
-			UserMessage: h.UserMessage,
-			AIResponse:  h.AIResponse,
-			MessageType: h.MessageType,
-			CreatedAt:   h.CreatedAt,
-		})
+	// 在token预算内组装上下文（系统提示词、相关记忆、摘要和最近的对话）
+	chatModel := "qwen3-max"
+	memories := s.recallMemories(req.ChatTarget, req.Message, chatModel)
+	messages, err := s.assembleContext(contextRequest{
+		UserID:         userID,
+		Target:         req.ChatTarget,
+		Model:          chatModel,
+		SystemPrompt:   s.buildCharacterSystemPrompt(character, lastMessageTime),
+		Memories:       memoryContents(memories),
+		CurrentMessage: req.Message,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build context: %w", err)
 	}
-	messages := s.buildMessageHistoryWithMemory(character, conversationHistory, req.Message, lastMessageTime)
 
 	// 调用AI服务
 	fmt.Printf("Calling LLM with %d messages for character %s\n", len(messages), character.Name)
-	response, err := s.aiService.ChatWithLLM(messages, "qwen3-max", 0.8, "text")
+	response, err := s.aiService.ChatWithLLM(messages, chatModel, 0.8, "text")
 	if err != nil {
 		fmt.Printf("LLM call failed: %v\n", err)
 		return nil, fmt.Errorf("failed to get AI response: %w", err)
@@ -95,12 +90,7 @@ func (s *ConversationService) Chat(userID int, req models.ChatRequest) (*models.
 	fmt.Printf("LLM response: %s\n", response[:min(len(response), 100)])
 
 	// 后处理AI响应，移除角色名字前缀
-	if strings.HasPrefix(response, character.Name+"。") {
-		response = strings.TrimPrefix(response, character.Name+"。")
-	} else if strings.HasPrefix(response, character.Name) {
-		response = strings.TrimPrefix(response, character.Name)
-	}
-	response = strings.TrimSpace(response) // 移除可能存在的首尾空格
+	response = trimCharacterPrefix(character.Name, response)
 
 	// 判断消息类型
 	messageType := "text"
@@ -108,58 +98,67 @@ func (s *ConversationService) Chat(userID int, req models.ChatRequest) (*models.
 		messageType = "emoji"
 	}
 
-	// 为AI伙伴获取companionID
-	var companionID *int
-	if req.CharacterID == 5 {
-		// 获取用户的AI伙伴ID
-		var cID int
-		err := s.db.QueryRow("SELECT id FROM ai_companions WHERE user_id = ?", userID).Scan(&cID)
-		if err != nil {
-			if err != sql.ErrNoRows {
-				return nil, fmt.Errorf("failed to get companion ID: %w", err)
-			}
-			// 如果没有AI伙伴记录，companionID保持为nil
-		} else {
-			companionID = &cID
-		}
-	}
-
 	// 保存对话记录
-	fmt.Printf("Saving conversation for user %d, character %d, companion %v\n", userID, req.CharacterID, companionID)
-	messageID, err := s.saveConversation(userID, req.CharacterID, companionID, req.SessionID, messageType, req.Message, response, "", "", 0.5, 10)
+	fmt.Printf("Saving conversation for user %d, target %+v\n", userID, req.ChatTarget)
+	messageID, err := s.saveConversation(userID, req.ChatTarget, req.SessionID, messageType, req.Message, response, "", "", 0.5, 0)
 	if err != nil {
 		fmt.Printf("Failed to save conversation: %v\n", err)
 		return nil, fmt.Errorf("failed to save conversation: %w", err)
 	}
 	fmt.Printf("Conversation saved with message ID: %d\n", messageID)
+	if len(memories) > 0 {
+		s.recordMemoryUsage(messageID, memories)
+	}
+	s.publishMessageCreated(userID, MessageCreatedEvent{
+		MessageID:   messageID,
+		ChatTarget:  req.ChatTarget,
+		SessionID:   req.SessionID,
+		UserMessage: req.Message,
+		AIResponse:  response,
+	})
 
-	// 如果是AI伙伴，分析用户消息并更新成长数据
-	if req.CharacterID == 5 && companionID != nil {
-		err = s.analyzeUserMessageAndUpdateCompanion(userID, req.Message, response)
+	// 更新会话活跃时间，第一轮对话后自动生成标题
+	s.touchSession(session.ID)
+	if session.Title == "" && session.MessageCount == 0 {
+		go s.generateSessionTitle(session.ID, req.Message, response)
+	}
+
+	var growth *companionGrowthResult
+	if req.IsCompanion() {
+		// 分析用户消息并更新AI伙伴的成长数据
+		growth, err = s.analyzeUserMessageAndUpdateCompanion(userID, req.CompanionID, messageID, req.Message, response)
 		if err != nil {
 			// 记录错误但不影响对话
 			fmt.Printf("Failed to update companion growth: %v\n", err)
 		}
-	}
-
-	// 更新好友关系的最后消息时间
-	_, err = s.db.Exec(`
-		UPDATE user_friendships 
-		SET last_message_at = NOW(), updated_at = NOW()
-		WHERE user_id = ? AND character_id = ?
-	`, userID, req.CharacterID)
-	if err != nil {
-		// 记录错误但不影响对话
-		fmt.Printf("Failed to update friendship: %v\n", err)
+		// 后台提取本轮对话中值得长期记住的内容
+		s.extractMemories(userID, req.CompanionID, req.Message, response)
+	} else {
+		// 更新好友关系的最后消息时间
+		_, err = s.db.Exec(`
+			UPDATE user_friendships 
+			SET last_message_at = NOW(), updated_at = NOW()
+			WHERE user_id = ? AND character_id = ?
+		`, userID, req.CharacterID)
+		if err != nil {
+			// 记录错误但不影响对话
+			fmt.Printf("Failed to update friendship: %v\n", err)
+		}
 	}
 
 	fmt.Printf("Returning ChatResponse: Response=%s, Character=%s, MessageID=%d\n", response[:min(len(response), 50)], character.Name, messageID)
-	return &models.ChatResponse{
+	chatResponse := &models.ChatResponse{
 		Response:  response,
 		SessionID: req.SessionID,
 		Character: character.Name,
 		MessageID: messageID,
-	}, nil
+	}
+	if growth != nil {
+		chatResponse.ExperienceGain = growth.ExperienceGain
+		chatResponse.LevelUp = growth.LevelUp
+		chatResponse.NewSkills = growth.NewSkills
+	}
+	return chatResponse, nil
 }
 
 func (s *ConversationService) VoiceChat(userID int, req models.VoiceChatRequest) (*models.ChatResponse, error) {
@@ -171,20 +170,27 @@ func (s *ConversationService) VoiceChat(userID int, req models.VoiceChatRequest)
 
 	// 调用文字聊天
 	chatReq := models.ChatRequest{
-		CharacterID: req.CharacterID,
-		Message:     text,
-		SessionID:   req.SessionID,
+		ChatTarget: req.ChatTarget,
+		Message:    text,
+		SessionID:  req.SessionID,
 	}
 
 	return s.Chat(userID, chatReq)
 }
 
 func (s *ConversationService) ImageChat(userID int, req models.ImageChatRequest) (*models.ChatResponse, error) {
-	// 获取角色信息
-	character, err := s.getCharacterByID(req.CharacterID)
+	// 获取聊天对象的人设
+	character, err := s.getTargetPersona(userID, req.ChatTarget, req.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先确定消息所属会话，无效的session_id不必调用模型
+	session, err := s.resolveChatSession(userID, req.ChatTarget, req.SessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get character: %w", err)
+		return nil, fmt.Errorf("failed to resolve chat session: %w", err)
 	}
+	req.SessionID = session.ID
 
 	// 分析图片
 	prompt := fmt.Sprintf("用户发送了一张图片，请以%s的身份回应。%s", character.Name, req.Message)
@@ -194,10 +200,21 @@ func (s *ConversationService) ImageChat(userID int, req models.ImageChatRequest)
 	}
 
 	// 保存对话记录
-	messageID, err := s.saveConversation(userID, req.CharacterID, nil, req.SessionID, "image", req.Message, response, req.ImageData, "", 0.5, 10)
+	messageID, err := s.saveConversation(userID, req.ChatTarget, req.SessionID, "image", req.Message, response, req.ImageData, "", 0.5, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save conversation: %w", err)
 	}
+	s.touchSession(session.ID)
+	s.publishMessageCreated(userID, MessageCreatedEvent{
+		MessageID:   messageID,
+		ChatTarget:  req.ChatTarget,
+		SessionID:   req.SessionID,
+		UserMessage: req.Message,
+		AIResponse:  response,
+	})
+	if req.IsCompanion() {
+		s.extractMemories(userID, req.CompanionID, req.Message, response)
+	}
 
 	return &models.ChatResponse{
 		Response:  response,
@@ -207,50 +224,16 @@ func (s *ConversationService) ImageChat(userID int, req models.ImageChatRequest)
 	}, nil
 }
 
-func (s *ConversationService) GetHistory(userID int, characterID int) ([]models.ConversationHistory, error) {
-	rows, err := s.db.Query(`
-		SELECT id, user_message, ai_response, message_type, created_at
-		FROM conversations 
-		WHERE user_id = ? AND character_id = ?
-		ORDER BY created_at ASC
-	`, userID, characterID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query conversation history: %w", err)
-	}
-	defer rows.Close()
-
-	var history []models.ConversationHistory
-	for rows.Next() {
-		var conv models.ConversationHistory
-		err := rows.Scan(&conv.ID, &conv.UserMessage, &conv.AIResponse, &conv.MessageType, &conv.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan conversation: %w", err)
-		}
-		history = append(history, conv)
+// GetHistory 分页获取与某个角色或AI伙伴的聊天记录
+func (s *ConversationService) GetHistory(userID int, target models.ChatTarget, page models.HistoryPageRequest) (*models.HistoryPage, error) {
+	if !target.Valid() {
+		return nil, ErrInvalidChatTarget
 	}
-
-	return history, nil
+	filter, value := targetFilter("", target)
+	return s.queryHistoryPage("user_id = ? AND "+filter+" AND deleted_at IS NULL", []interface{}{userID, value}, page)
 }
 
 func (s *ConversationService) getCharacterByID(characterID int) (*models.CharacterResponse, error) {
-	// 如果是AI伙伴（characterID = 5），从ai_companions表获取信息
-	if characterID == 5 {
-		// 这里不需要查询，因为AI伙伴信息会在Chat方法中动态处理
-		return &models.CharacterResponse{
-			ID:                   5,
-			Name:                 "AI伙伴",
-			Description:          "一个正在成长的AI伙伴",
-			AvatarURL:            "", // 空字符串，使用粒子小球
-			PersonalitySignature: "",
-			PersonalityTraits:    "",
-			BackgroundStory:      "",
-			VoiceSettings:        "",
-			SystemPrompt:         "", // 将在Chat方法中动态生成
-			SearchKeywords:       "",
-			Skills:               "",
-		}, nil
-	}
-
 	// 普通角色的处理逻辑
 	var char models.CharacterResponse
 	var voiceSettings sql.NullString
@@ -279,37 +262,6 @@ func (s *ConversationService) getCharacterByID(characterID int) (*models.Charact
 	return &char, nil
 }
 
-func (s *ConversationService) getConversationHistory(userID int, characterID int, limit int) ([]models.ConversationHistory, error) {
-	rows, err := s.db.Query(`
-		SELECT id, user_message, ai_response, message_type, created_at
-		FROM conversations 
-		WHERE user_id = ? AND character_id = ?
-		ORDER BY created_at DESC
-		LIMIT ?
-	`, userID, characterID, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var history []models.ConversationHistory
-	for rows.Next() {
-		var conv models.ConversationHistory
-		err := rows.Scan(&conv.ID, &conv.UserMessage, &conv.AIResponse, &conv.MessageType, &conv.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		history = append(history, conv)
-	}
-
-	// 反转顺序，让最早的对话在前面
-	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
-		history[i], history[j] = history[j], history[i]
-	}
-
-	return history, nil
-}
-
 func (s *ConversationService) buildMessageHistory(character *models.CharacterResponse, history []models.ConversationHistory, currentMessage string) []Message {
 	messages := []Message{
 		{Role: "system", Content: character.SystemPrompt},
@@ -325,12 +277,13 @@ func (s *ConversationService) buildMessageHistory(character *models.CharacterRes
 }
 
 // getLastMessageTime 获取最后一条消息的时间
-func (s *ConversationService) getLastMessageTime(userID, characterID int) (*time.Time, error) {
+func (s *ConversationService) getLastMessageTime(userID int, target models.ChatTarget) (*time.Time, error) {
 	var lastMessageTime *time.Time
+	filter, value := targetFilter("", target)
 	err := s.db.QueryRow(`
 		SELECT MAX(created_at) FROM conversations 
-		WHERE user_id = ? AND character_id = ?
-	`, userID, characterID).Scan(&lastMessageTime)
+		WHERE user_id = ? AND `+filter+` AND deleted_at IS NULL
+	`, userID, value).Scan(&lastMessageTime)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -340,10 +293,8 @@ func (s *ConversationService) getLastMessageTime(userID, characterID int) (*time
 	return lastMessageTime, nil
 }
 
-// buildMessageHistoryWithMemory 构建包含记忆和自然回应的消息历史
-func (s *ConversationService) buildMessageHistoryWithMemory(character *models.CharacterResponse, history []models.Conversation, currentMessage string, lastMessageTime *time.Time) []Message {
-	var messages []Message
-
+// buildCharacterSystemPrompt 构建包含角色设定和自然回应提示的系统提示词
+func (s *ConversationService) buildCharacterSystemPrompt(character *models.CharacterResponse, lastMessageTime *time.Time) string {
 	// 构建系统提示词，包含角色设定和记忆
 	systemPrompt := fmt.Sprintf(`你是%s，请严格按照以下角色设定进行对话：
 
@@ -374,37 +325,18 @@ func (s *ConversationService) buildMessageHistoryWithMemory(character *models.Ch
 		}
 	}
 
-	// 添加系统提示
-	messages = append(messages, Message{Role: "system", Content: systemPrompt})
-
-	// 添加历史对话（限制数量以避免token过多）
-	maxHistory := 8 // 减少历史消息数量
-	if len(history) > maxHistory {
-		history = history[len(history)-maxHistory:]
-	}
-
-	for _, conv := range history {
-		if conv.UserMessage != "" {
-			messages = append(messages, Message{Role: "user", Content: conv.UserMessage})
-		}
-		if conv.AIResponse != "" {
-			messages = append(messages, Message{Role: "assistant", Content: conv.AIResponse})
-		}
-	}
-
-	// 添加当前消息
-	messages = append(messages, Message{Role: "user", Content: currentMessage})
-
-	return messages
+	return systemPrompt
 }
 
-func (s *ConversationService) saveConversation(userID, characterID int, companionID *int, sessionID, messageType, userMessage, aiResponse, imageData, audioData string, sentimentScore float64, experienceGained int) (int, error) {
-	fmt.Printf("Executing saveConversation: userID=%d, characterID=%d, companionID=%v, sessionID=%s\n", userID, characterID, companionID, sessionID)
+// saveConversation 保存一轮对话，AI回复随请求直接返回给用户，因此记为已读
+func (s *ConversationService) saveConversation(userID int, target models.ChatTarget, sessionID, messageType, userMessage, aiResponse, imageData, audioData string, sentimentScore float64, experienceGained int) (int, error) {
+	fmt.Printf("Executing saveConversation: userID=%d, target=%+v, sessionID=%s\n", userID, target, sessionID)
+	characterID, companionID := targetColumns(target)
 	result, err := s.db.Exec(`
 		INSERT INTO conversations 
 		(user_id, character_id, companion_id, session_id, message_type, user_message, ai_response, image_data, audio_data, sentiment_score, experience_gained, is_read, created_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, userID, characterID, companionID, sessionID, messageType, userMessage, aiResponse, imageData, audioData, sentimentScore, experienceGained, false, time.Now())
+	`, userID, characterID, companionID, sessionID, messageType, userMessage, aiResponse, imageData, audioData, sentimentScore, experienceGained, true, time.Now())
 	if err != nil {
 		fmt.Printf("Database exec error: %v\n", err)
 		return 0, err
@@ -417,11 +349,19 @@ func (s *ConversationService) saveConversation(userID, characterID int, companio
 	}
 
 	fmt.Printf("Successfully saved conversation with ID: %d\n", messageID)
+	if s.vectorIndex != nil {
+		go s.vectorIndex.addInBackground(VectorItem{
+			Kind:    VectorKindConversation,
+			RefID:   int(messageID),
+			OwnerID: userID,
+			Text:    conversationVectorText(userMessage, aiResponse),
+		})
+	}
 	return int(messageID), nil
 }
 
 // generateCompanionPrompt 为AI伙伴生成动态提示词，实现成长和模仿效果
-func (s *ConversationService) generateCompanionPrompt(userID int, userMessage string) (string, error) {
+func (s *ConversationService) generateCompanionPrompt(userID, companionID int, userMessage string) (string, error) {
 	// 获取AI伙伴信息
 	var companion models.AICompanion
 	var personalityTraits, learnedVocabulary sql.NullString
@@ -432,8 +372,8 @@ func (s *ConversationService) generateCompanionPrompt(userID int, userMessage st
 			   knowledge_breadth, empathy_depth, creativity_level, humor_sense,
 			   total_experience, current_level, growth_percentage, gender,
 			   personality_traits, learned_vocabulary, memory_summary, growth_mode
-		FROM ai_companions WHERE user_id = ?
-	`, userID).Scan(
+		FROM ai_companions WHERE id = ? AND user_id = ?
+	`, companionID, userID).Scan(
 		&companion.ID, &companion.Name, &companion.PersonalitySignature,
 		&companion.ConversationFluency, &companion.KnowledgeBreadth,
 		&companion.EmpathyDepth, &companion.CreativityLevel, &companion.HumorSense,
@@ -565,29 +505,51 @@ func (s *ConversationService) generateCompanionPrompt(userID int, userMessage st
 		basePrompt += " 我是长期养成模式，会慢慢深度成长。"
 	}
 
+	// 添加已解锁的技能
+	skills, err := loadCompanionSkills(s.db, companion.ID)
+	if err != nil {
+		return "", err
+	}
+	basePrompt += skillPrompt(skills, userMessage)
+
 	return basePrompt, nil
 }
 
-// analyzeUserMessageAndUpdateCompanion 分析用户消息并更新AI伙伴的学习数据
-func (s *ConversationService) analyzeUserMessageAndUpdateCompanion(userID int, userMessage string, aiResponse string) error {
+// companionGrowthResult 一轮对话给AI伙伴带来的成长变化
+type companionGrowthResult struct {
+	ExperienceGain int
+	LevelUp        bool
+	NewSkills      []string
+}
+
+// analyzeUserMessageAndUpdateCompanion 分析用户消息并更新AI伙伴的学习数据、技能使用和解锁
+// messageID为本轮已保存的对话记录，结算后的经验写回该记录的experience_gained
+func (s *ConversationService) analyzeUserMessageAndUpdateCompanion(userID, companionID, messageID int, userMessage string, aiResponse string) (*companionGrowthResult, error) {
+	// 能力值和经验在同一事务中更新，锁定AI伙伴行避免并发对话互相覆盖
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	// 获取AI伙伴信息
 	var companion models.AICompanion
 	var learnedVocabulary sql.NullString
 	var memorySummary sql.NullString
 
-	err := s.db.QueryRow(`
+	err = tx.QueryRow(`
 		SELECT id, conversation_fluency, knowledge_breadth, empathy_depth, 
 			   creativity_level, humor_sense, total_experience, current_level,
 			   growth_percentage, learned_vocabulary, memory_summary
-		FROM ai_companions WHERE user_id = ?
-	`, userID).Scan(
+		FROM ai_companions WHERE id = ? AND user_id = ? FOR UPDATE
+	`, companionID, userID).Scan(
 		&companion.ID, &companion.ConversationFluency, &companion.KnowledgeBreadth,
 		&companion.EmpathyDepth, &companion.CreativityLevel, &companion.HumorSense,
 		&companion.TotalExperience, &companion.CurrentLevel, &companion.GrowthPercentage,
 		&learnedVocabulary, &memorySummary,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to get companion: %w", err)
+		return nil, fmt.Errorf("failed to get companion: %w", err)
 	}
 
 	// 处理可能为NULL或空字符串的字段
@@ -602,11 +564,11 @@ func (s *ConversationService) analyzeUserMessageAndUpdateCompanion(userID int, u
 		companion.MemorySummary = ""
 	}
 
-	// 计算经验值增长
-	experienceGained := s.calculateExperienceGain(userMessage, aiResponse)
-
-	// 更新能力值（基于对话内容分析）
-	s.updateCompanionAbilities(&companion, userMessage, aiResponse)
+	// 计算经验值增长并更新能力值，经过质量、重复、每日递减和冷却的防刷调整
+	experienceGained, err := s.applyGrowthGuards(tx, userID, &companion, userMessage, aiResponse)
+	if err != nil {
+		return nil, err
+	}
 
 	// 更新学习词汇（模仿用户语言）
 	s.updateLearnedVocabulary(&companion, userMessage)
@@ -614,26 +576,56 @@ func (s *ConversationService) analyzeUserMessageAndUpdateCompanion(userID int, u
 	// 更新记忆摘要
 	s.updateMemorySummary(&companion, userMessage, aiResponse)
 
-	// 更新成长进度
-	s.updateGrowthProgress(&companion, experienceGained)
-
-	// 分析用户消息情绪并更新AI伙伴情绪状态
-	s.updateCompanionEmotion(&companion, userMessage)
-
 	// 保存更新到数据库
-	_, err = s.db.Exec(`
+	_, err = tx.Exec(`
 		UPDATE ai_companions SET 
 			conversation_fluency = ?, knowledge_breadth = ?, empathy_depth = ?,
-			creativity_level = ?, humor_sense = ?, total_experience = ?,
-			current_level = ?, growth_percentage = ?, learned_vocabulary = ?,
+			creativity_level = ?, humor_sense = ?, learned_vocabulary = ?,
 			memory_summary = ?, last_active_at = NOW(), updated_at = NOW()
 		WHERE id = ?
 	`, companion.ConversationFluency, companion.KnowledgeBreadth, companion.EmpathyDepth,
-		companion.CreativityLevel, companion.HumorSense, companion.TotalExperience,
-		companion.CurrentLevel, companion.GrowthPercentage, companion.LearnedVocabulary,
+		companion.CreativityLevel, companion.HumorSense, companion.LearnedVocabulary,
 		companion.MemorySummary, companion.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 由成长引擎结算经验、等级和成长进度
+	progress, err := growth.ApplyExperience(tx, companion.ID, experienceGained)
+	if err != nil {
+		return nil, err
+	}
+	if messageID > 0 {
+		if _, err := tx.Exec(`UPDATE conversations SET experience_gained = ? WHERE id = ?`, progress.ExperienceGained, messageID); err != nil {
+			return nil, fmt.Errorf("failed to record message experience: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	companion.TotalExperience = progress.TotalExperience
+	companion.CurrentLevel = progress.CurrentLevel
+	companion.GrowthPercentage = progress.GrowthPercentage
+
+	// 分析用户消息情绪并更新AI伙伴情绪状态
+	s.updateCompanionEmotion(userID, &companion, userMessage)
+
+	result := &companionGrowthResult{
+		ExperienceGain: progress.ExperienceGained,
+		LevelUp:        progress.LevelUp,
+	}
+	publishGrowthEvents(s.eventHub, userID, progress)
 
-	return err
+	// 已解锁的技能随使用升级，新的等级和能力值可能解锁新技能
+	skills, err := loadCompanionSkills(s.db, companion.ID)
+	if err != nil {
+		return result, err
+	}
+	if err := s.recordSkillUse(skills, userMessage); err != nil {
+		return result, err
+	}
+	result.NewSkills, err = s.unlockSkills(userID, &companion, skills)
+	return result, err
 }
 
 // calculateExperienceGain 计算经验值增长
@@ -641,13 +633,15 @@ func (s *ConversationService) calculateExperienceGain(userMessage, aiResponse st
 	// 基础经验值
 	baseExp := 5
 
-	// 根据消息长度增加经验
+	// 根据消息长度增加经验，疑似粘贴的长文本不加，避免靠粘贴刷经验
 	messageLength := len([]rune(userMessage))
-	if messageLength > 50 {
-		baseExp += 3
-	}
-	if messageLength > 100 {
-		baseExp += 5
+	if messageLength <= qualityPasteRunes {
+		if messageLength > 50 {
+			baseExp += 3
+		}
+		if messageLength > 100 {
+			baseExp += 5
+		}
 	}
 
 	// 根据AI回应质量增加经验（这里简化处理）
@@ -658,35 +652,35 @@ func (s *ConversationService) calculateExperienceGain(userMessage, aiResponse st
 	return baseExp
 }
 
-// updateCompanionAbilities 更新AI伙伴的能力值
-func (s *ConversationService) updateCompanionAbilities(companion *models.AICompanion, userMessage, aiResponse string) {
-	// 分析用户消息的情感色彩
-	messageLength := len([]rune(userMessage))
+// abilityHits 根据对话内容判断本轮可能提升的能力
+func (s *ConversationService) abilityHits(userMessage string) []string {
+	var hits []string
 
 	// 语言流畅度：基于消息长度和复杂度
-	if messageLength > 20 {
-		companion.ConversationFluency = min(companion.ConversationFluency+1, 10)
+	if len([]rune(userMessage)) > 20 {
+		hits = append(hits, AbilityFluency)
 	}
 
 	// 共情深度：基于情感词汇
 	if s.containsEmotionalWords(userMessage) {
-		companion.EmpathyDepth = min(companion.EmpathyDepth+1, 10)
+		hits = append(hits, AbilityEmpathy)
 	}
 
 	// 创造力：基于用户使用的新颖表达
 	if s.containsCreativeExpressions(userMessage) {
-		companion.CreativityLevel = min(companion.CreativityLevel+1, 10)
+		hits = append(hits, AbilityCreativity)
 	}
 
 	// 幽默感：基于用户使用幽默表达
 	if s.containsHumor(userMessage) {
-		companion.HumorSense = min(companion.HumorSense+1, 10)
+		hits = append(hits, AbilityHumor)
 	}
 
 	// 知识广度：基于用户提到的知识领域
 	if s.containsKnowledgeTopics(userMessage) {
-		companion.KnowledgeBreadth = min(companion.KnowledgeBreadth+1, 10)
+		hits = append(hits, AbilityKnowledge)
 	}
+	return hits
 }
 
 // updateLearnedVocabulary 更新学习词汇（模仿用户语言）
@@ -713,38 +707,26 @@ func (s *ConversationService) updateLearnedVocabulary(companion *models.AICompan
 func (s *ConversationService) updateMemorySummary(companion *models.AICompanion, userMessage, aiResponse string) {
 	// 提取重要信息并更新记忆摘要
 	// 这里简化处理，实际可以更复杂的记忆管理
-	if len(userMessage) > 50 {
+	// 按字符而不是字节截取，避免切断多字节的UTF-8字符
+	if len([]rune(userMessage)) > 50 {
 		// 简单的记忆摘要更新
-		currentSummary := companion.MemorySummary
+		currentSummary := []rune(companion.MemorySummary)
 		if len(currentSummary) > 500 {
 			// 如果记忆太长，截取后半部分
 			currentSummary = currentSummary[250:]
 		}
-		companion.MemorySummary = currentSummary + " " + userMessage[:min(len(userMessage), 100)]
+		companion.MemorySummary = string(currentSummary) + " " + truncateRunes(userMessage, 100)
 	}
 }
 
-// updateGrowthProgress 更新成长进度
-func (s *ConversationService) updateGrowthProgress(companion *models.AICompanion, experienceGained int) {
-	companion.TotalExperience += experienceGained
-
-	// 根据经验值计算等级和成长进度
-	levelThresholds := []int{0, 100, 300, 600, 1000, 1500, 2100, 2800, 3600, 4500, 5500}
-
-	for i, threshold := range levelThresholds {
-		if companion.TotalExperience >= threshold {
-			companion.CurrentLevel = i + 1
-		}
-	}
-
-	// 计算成长进度百分比
-	if companion.CurrentLevel < len(levelThresholds) {
-		currentLevelExp := companion.TotalExperience - levelThresholds[companion.CurrentLevel-1]
-		nextLevelExp := levelThresholds[companion.CurrentLevel] - levelThresholds[companion.CurrentLevel-1]
-		companion.GrowthPercentage = float64(currentLevelExp) / float64(nextLevelExp) * 100
-	} else {
-		companion.GrowthPercentage = 100.0
+// trimCharacterPrefix 移除AI回复开头的角色名字前缀及首尾空格
+func trimCharacterPrefix(characterName, response string) string {
+	if strings.HasPrefix(response, characterName+"。") {
+		response = strings.TrimPrefix(response, characterName+"。")
+	} else if strings.HasPrefix(response, characterName) {
+		response = strings.TrimPrefix(response, characterName)
 	}
+	return strings.TrimSpace(response)
 }
 
 // 辅助函数
@@ -755,6 +737,14 @@ func min(a, b int) int {
 	return b
 }
 
+// truncateRunes 按字符截取字符串的前n个字符
+func truncateRunes(text string, n int) string {
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n])
+	}
+	return text
+}
+
 func (s *ConversationService) containsEmotionalWords(message string) bool {
 	emotionalWords := []string{"开心", "难过", "生气", "担心", "害怕", "兴奋", "失望", "感动", "爱", "恨"}
 	for _, word := range emotionalWords {
@@ -795,18 +785,6 @@ func (s *ConversationService) containsKnowledgeTopics(message string) bool {
 	return false
 }
 
-// updateCompanionEmotion 分析用户消息情绪并更新AI伙伴情绪状态
-func (s *ConversationService) updateCompanionEmotion(companion *models.AICompanion, userMessage string) {
-	// 简单的情绪分析（基于关键词）
-	emotion := s.analyzeEmotion(userMessage)
-
-	// 更新AI伙伴的情绪状态到数据库
-	// 这里我们可以在ai_companions表中添加emotion字段，或者使用现有的字段
-	// 暂时先记录到日志
-	fmt.Printf("Companion %d emotion updated to: %s based on message: %s\n",
-		companion.ID, emotion, userMessage[:min(len(userMessage), 20)])
-}
-
 // analyzeEmotion 分析消息中的情绪
 func (s *ConversationService) analyzeEmotion(message string) string {
 	message = strings.ToLower(message)
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Embedder 把文本转换为向量，用于语义检索
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+	// Model 向量模型标识，模型变化后已有向量需要重建
+	Model() string
+}
+
+const (
+	embeddingBatchSize         = 32 // 单次请求最多发送的文本数
+	defaultHashingEmbedderDims = 256
+)
+
+// RemoteEmbedder 调用OpenAI兼容的 /embeddings 接口
+type RemoteEmbedder struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewRemoteEmbedder 创建远程向量模型客户端
+func NewRemoteEmbedder(apiKey, baseURL, model string) *RemoteEmbedder {
+	return &RemoteEmbedder{
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		model:   model,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// embeddingRequest OpenAI兼容的向量请求
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingResponse OpenAI兼容的向量响应
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Model 返回向量模型名称
+func (e *RemoteEmbedder) Model() string {
+	return e.model
+}
+
+// Embed 批量获取文本向量，超过单次上限时分批请求
+func (e *RemoteEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.embedBatch(texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// embedBatch 发送一次向量请求，按响应中的index还原顺序
+func (e *RemoteEmbedder) embedBatch(texts []string) ([][]float32, error) {
+	reqBody, err := json.Marshal(embeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", e.baseURL+"/embeddings", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding API returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var embResp embeddingResponse
+	if err := json.Unmarshal(respBody, &embResp); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+	}
+	if len(embResp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d texts", len(embResp.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range embResp.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding API returned invalid index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// HashingEmbedder 本地确定性向量：把检索分词哈希到固定维度后归一化
+// 不需要外部服务，语义能力有限，适合测试和离线环境
+type HashingEmbedder struct {
+	dims int
+}
+
+// NewHashingEmbedder 创建本地哈希向量模型，dims<=0时使用默认维度
+func NewHashingEmbedder(dims int) *HashingEmbedder {
+	if dims <= 0 {
+		dims = defaultHashingEmbedderDims
+	}
+	return &HashingEmbedder{dims: dims}
+}
+
+// Model 返回包含维度的模型标识，维度变化时会触发重建
+func (e *HashingEmbedder) Model() string {
+	return fmt.Sprintf("local-hashing-%d", e.dims)
+}
+
+// Embed 计算文本的哈希向量，哈希的最高位决定正负号以减少碰撞带来的偏差
+func (e *HashingEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dims)
+		for _, token := range memoryTokens(text) {
+			h := fnv.New32a()
+			h.Write([]byte(token))
+			sum := h.Sum32()
+			if sum&0x80000000 != 0 {
+				vector[int(sum&0x7fffffff)%e.dims]--
+			} else {
+				vector[int(sum)%e.dims]++
+			}
+		}
+
+		var norm float64
+		for _, v := range vector {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			scale := float32(1 / math.Sqrt(norm))
+			for j := range vector {
+				vector[j] *= scale
+			}
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
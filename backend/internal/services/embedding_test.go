@@ -0,0 +1,57 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHashingEmbedder(t *testing.T) {
+	embedder := NewHashingEmbedder(64)
+	if got := embedder.Model(); got != "local-hashing-64" {
+		t.Errorf("Model() = %q, want local-hashing-64", got)
+	}
+	if got := NewHashingEmbedder(0).Model(); got != "local-hashing-256" {
+		t.Errorf("default Model() = %q, want local-hashing-256", got)
+	}
+
+	texts := []string{"我喜欢喝咖啡", "我喜欢喝咖啡", "我喜欢喝咖啡和茶", "明天要去爬山", "", "！！！"}
+	vectors, err := embedder.Embed(texts)
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("Embed() returned %d vectors, want %d", len(vectors), len(texts))
+	}
+
+	tests := []struct {
+		name     string
+		vector   []float32
+		wantNorm float64
+	}{
+		{"text", vectors[0], 1},
+		{"longer text", vectors[2], 1},
+		{"empty text", vectors[4], 0},
+		{"punctuation only", vectors[5], 0},
+	}
+	for _, tt := range tests {
+		if len(tt.vector) != 64 {
+			t.Errorf("%s: dims = %d, want 64", tt.name, len(tt.vector))
+		}
+		var norm float64
+		for _, v := range tt.vector {
+			norm += float64(v) * float64(v)
+		}
+		if math.Abs(math.Sqrt(norm)-tt.wantNorm) > 1e-5 {
+			t.Errorf("%s: norm = %v, want %v", tt.name, math.Sqrt(norm), tt.wantNorm)
+		}
+	}
+
+	if sim := cosineSimilarity(vectors[0], vectors[1]); math.Abs(sim-1) > 1e-6 {
+		t.Errorf("same text similarity = %v, want 1", sim)
+	}
+	related := cosineSimilarity(vectors[0], vectors[2])
+	unrelated := cosineSimilarity(vectors[0], vectors[3])
+	if related <= unrelated {
+		t.Errorf("related similarity %v should exceed unrelated %v", related, unrelated)
+	}
+}
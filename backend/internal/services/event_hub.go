@@ -0,0 +1,262 @@
+package services
+
+import (
+	"log"
+	"seven-ai-backend/internal/growth"
+	"seven-ai-backend/internal/models"
+	"sync"
+	"time"
+)
+
+// 实时事件类型
+const (
+	EventMessageCreated         = "message.created"           // 新消息（含AI主动消息）
+	EventCompanionLevelUp       = "companion.level_up"        // AI伙伴升级
+	EventCompanionEmotionChange = "companion.emotion_changed" // AI伙伴情绪变化
+	EventSkillUnlocked          = "companion.skill_unlocked"  // AI伙伴解锁了新技能
+	EventMilestoneReached       = "companion.milestone"       // AI伙伴达成成长里程碑
+	EventDiaryCreated           = "diary.created"             // AI伙伴写了新日记
+	EventFriendAdded            = "friend.added"              // 添加了新好友
+	EventGroupMessageCreated    = "group.message_created"     // 群聊新消息
+)
+
+const (
+	defaultEventReplaySize    = 200              // 每个用户保留的最近事件数，用于断线补发
+	defaultEventHistoryTTL    = 10 * time.Minute // 没有在线连接的用户，最后一个事件超过该时长后丢弃其补发记录
+	eventSubscriptionCapacity = 64               // 每个连接的事件缓冲，写满视为慢连接并断开
+)
+
+// Event 推送给客户端的实时事件
+type Event struct {
+	ID        int64       `json:"id"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// EventSubscription 一个设备连接对事件流的订阅
+type EventSubscription struct {
+	userID int
+	events chan Event
+	closed bool
+}
+
+// Events 返回事件通道，订阅被取消或因积压被断开时通道关闭
+func (sub *EventSubscription) Events() <-chan Event {
+	return sub.events
+}
+
+// EventHub 进程内的用户事件发布订阅中心，同一用户的多个设备都会收到事件
+type EventHub struct {
+	mu            sync.Mutex
+	startID       int64 // 本进程发布的第一个事件ID之前的值
+	nextID        int64
+	replaySize    int
+	historyTTL    time.Duration
+	subscriptions map[int]map[*EventSubscription]struct{}
+	history       map[int][]Event // 每个用户最近的事件，按ID递增
+	evictedUpTo   map[int]int64   // 每个用户已从history中丢弃的最大事件ID
+	prunedUpTo    int64           // 因空闲被整体清理的用户补发记录中最大的事件ID
+}
+
+// NewEventHub 创建事件中心
+func NewEventHub() *EventHub {
+	// 以启动时间作为起始ID，重启后新事件ID仍大于客户端记住的旧ID
+	startID := time.Now().UnixMilli() * 1000
+	return &EventHub{
+		startID:       startID,
+		nextID:        startID,
+		replaySize:    defaultEventReplaySize,
+		historyTTL:    defaultEventHistoryTTL,
+		subscriptions: make(map[int]map[*EventSubscription]struct{}),
+		history:       make(map[int][]Event),
+		evictedUpTo:   make(map[int]int64),
+	}
+}
+
+// Publish 向用户的所有连接发布事件，hub为nil时忽略
+func (h *EventHub) Publish(userID int, eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	event := Event{ID: h.nextID, Type: eventType, Data: data, CreatedAt: time.Now()}
+
+	history, ok := h.history[userID]
+	if !ok && h.prunedUpTo > 0 {
+		// 该用户之前的补发记录可能已被清理，更早的事件视为无法补发
+		h.evictedUpTo[userID] = h.prunedUpTo
+	}
+	history = append(history, event)
+	if len(history) > h.replaySize {
+		h.evictedUpTo[userID] = history[len(history)-h.replaySize-1].ID
+		history = history[len(history)-h.replaySize:]
+	}
+	h.history[userID] = history
+
+	for sub := range h.subscriptions[userID] {
+		select {
+		case sub.events <- event:
+		default:
+			// 客户端消费太慢，断开后由客户端按last_event_id重连补发
+			log.Printf("事件连接积压，断开订阅: userID=%d", userID)
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe 订阅用户事件，并返回lastEventID之后错过的事件
+// complete为false表示错过的事件已超出保留范围，客户端应全量刷新
+func (h *EventHub) Subscribe(userID int, lastEventID int64) (sub *EventSubscription, missed []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &EventSubscription{userID: userID, events: make(chan Event, eventSubscriptionCapacity)}
+	if h.subscriptions[userID] == nil {
+		h.subscriptions[userID] = make(map[*EventSubscription]struct{})
+	}
+	h.subscriptions[userID][sub] = struct{}{}
+
+	complete = true
+	if lastEventID > 0 {
+		// 服务重启前的事件，或已超出保留范围的事件无法补发
+		if lastEventID < h.startID || lastEventID < h.evictedUpTo[userID] {
+			complete = false
+		}
+		// 没有补发记录时，事件可能已随空闲清理被丢弃
+		if _, ok := h.history[userID]; !ok && lastEventID < h.prunedUpTo {
+			complete = false
+		}
+		for _, event := range h.history[userID] {
+			if event.ID > lastEventID {
+				missed = append(missed, event)
+			}
+		}
+	}
+	return sub, missed, complete
+}
+
+// Unsubscribe 取消订阅
+func (h *EventHub) Unsubscribe(sub *EventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+// ConnectionCount 用户当前的在线连接数
+func (h *EventHub) ConnectionCount(userID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscriptions[userID])
+}
+
+// StartJanitor 启动后台清理任务，定期丢弃空闲用户的补发记录
+func (h *EventHub) StartJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			h.pruneIdleHistory(time.Now())
+		}
+	}()
+}
+
+// pruneIdleHistory 丢弃没有在线连接、且最后一个事件已超出补发时限的用户的补发记录
+func (h *EventHub) pruneIdleHistory(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pruned := 0
+	for userID, history := range h.history {
+		if len(h.subscriptions[userID]) > 0 {
+			continue
+		}
+		last := history[len(history)-1]
+		if now.Sub(last.CreatedAt) < h.historyTTL {
+			continue
+		}
+		if last.ID > h.prunedUpTo {
+			h.prunedUpTo = last.ID
+		}
+		delete(h.history, userID)
+		delete(h.evictedUpTo, userID)
+		pruned++
+	}
+	if pruned > 0 {
+		log.Printf("清理空闲用户的事件补发记录: %d个", pruned)
+	}
+}
+
+// removeLocked 移除订阅并关闭通道，调用方需持有锁
+func (h *EventHub) removeLocked(sub *EventSubscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+
+	subs := h.subscriptions[sub.userID]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscriptions, sub.userID)
+	}
+}
+
+// MessageCreatedEvent message.created 事件数据
+type MessageCreatedEvent struct {
+	models.ChatTarget
+	MessageID     int    `json:"message_id"`
+	SessionID     string `json:"session_id"`
+	UserMessage   string `json:"user_message,omitempty"`
+	AIResponse    string `json:"ai_response"`
+	IsAIInitiated bool   `json:"is_ai_initiated"`
+	Kind          string `json:"kind,omitempty"` // 主动消息类型（welcome/morning_greeting/follow_up/check_in）
+}
+
+// LevelUpEvent companion.level_up 事件数据
+type LevelUpEvent struct {
+	CompanionID      int     `json:"companion_id"`
+	PreviousLevel    int     `json:"previous_level"`
+	CurrentLevel     int     `json:"current_level"`
+	TotalExperience  int     `json:"total_experience"`
+	GrowthPercentage float64 `json:"growth_percentage"`
+}
+
+// MilestoneReachedEvent companion.milestone 事件数据
+type MilestoneReachedEvent struct {
+	CompanionID int              `json:"companion_id"`
+	Milestone   growth.Milestone `json:"milestone"`
+}
+
+// SkillUnlockedEvent companion.skill_unlocked 事件数据
+type SkillUnlockedEvent struct {
+	CompanionID int    `json:"companion_id"`
+	SkillName   string `json:"skill_name"`
+	Description string `json:"description"`
+}
+
+// EmotionChangedEvent companion.emotion_changed 事件数据
+type EmotionChangedEvent struct {
+	CompanionID     int                  `json:"companion_id"`
+	PreviousEmotion string               `json:"previous_emotion"`
+	Emotion         string               `json:"emotion"`
+	State           *models.EmotionState `json:"state"` // 变化后的小球外观
+}
+
+// DiaryCreatedEvent diary.created 事件数据
+type DiaryCreatedEvent struct {
+	CompanionID int    `json:"companion_id"`
+	DiaryID     int    `json:"diary_id"`
+	Date        string `json:"date"`
+	Title       string `json:"title"`
+	MoodScore   int    `json:"mood_score"`
+}
+
+// FriendAddedEvent friend.added 事件数据
+type FriendAddedEvent struct {
+	CharacterID int `json:"character_id"`
+}
@@ -11,6 +11,7 @@ import (
 type FriendshipService struct {
 	db        *sql.DB
 	aiService *AIService
+	eventHub  *EventHub // 实时事件推送
 }
 
 func NewFriendshipService(db *sql.DB, aiService *AIService) *FriendshipService {
@@ -21,6 +22,11 @@ func NewFriendshipService(db *sql.DB, aiService *AIService) *FriendshipService {
 }
 
 // GetUserFriends 获取用户的好友列表（包括AI伙伴）
+// SetEventHub 设置实时事件中心
+func (s *FriendshipService) SetEventHub(hub *EventHub) {
+	s.eventHub = hub
+}
+
 func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, error) {
 	var friends []models.FriendInfo
 
@@ -40,17 +46,22 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 				END, ''
 			) as last_message,
 			uf.last_message_at,
+			(SELECT COUNT(*) FROM conversations cu
+				WHERE cu.user_id = uf.user_id AND cu.character_id = uf.character_id
+				AND cu.is_read = FALSE AND cu.deleted_at IS NULL) as unread_count,
 			true as is_online,
 			'character' as type
 		FROM user_friendships uf
 		JOIN preset_characters pc ON uf.character_id = pc.id
 		LEFT JOIN conversations c ON c.user_id = uf.user_id 
 			AND c.character_id = uf.character_id 
+			AND c.deleted_at IS NULL
 			AND c.created_at = (
 				SELECT MAX(created_at) 
 				FROM conversations c2 
 				WHERE c2.user_id = uf.user_id 
 				AND c2.character_id = uf.character_id
+				AND c2.deleted_at IS NULL
 			)
 		WHERE uf.user_id = ? AND uf.is_active = true
 		ORDER BY uf.last_message_at DESC, uf.created_at DESC
@@ -72,6 +83,7 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 			&friend.PersonalitySignature,
 			&friend.LastMessage,
 			&friend.LastMessageAt,
+			&friend.UnreadCount,
 			&friend.IsOnline,
 			&friend.Type,
 		)
@@ -85,7 +97,6 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 	aiQuery := `
 		SELECT 
 			ac.id,
-			5 as character_id, -- AI伙伴使用5作为特殊character_id
 			ac.name,
 			ac.avatar_url,
 			ac.personality_signature,
@@ -97,6 +108,9 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 				END, ''
 			) as last_message,
 			ac.last_active_at as last_message_at,
+			(SELECT COUNT(*) FROM conversations cu
+				WHERE cu.user_id = ac.user_id AND cu.companion_id = ac.id
+				AND cu.is_read = FALSE AND cu.deleted_at IS NULL) as unread_count,
 			true as is_online,
 			'companion' as type,
 			ac.growth_percentage,
@@ -104,15 +118,17 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 			ac.total_experience
 		FROM ai_companions ac
 		LEFT JOIN conversations c ON c.user_id = ac.user_id 
-			AND c.character_id = 5 
+			AND c.companion_id = ac.id 
+			AND c.deleted_at IS NULL
 			AND c.created_at = (
 				SELECT MAX(created_at) 
 				FROM conversations c2 
 				WHERE c2.user_id = ac.user_id 
-				AND c2.character_id = 5
+				AND c2.companion_id = ac.id
+				AND c2.deleted_at IS NULL
 			)
-		WHERE ac.user_id = ?
-		ORDER BY ac.last_active_at DESC
+		WHERE ac.user_id = ? AND ac.archived_at IS NULL
+		ORDER BY ac.is_default DESC, ac.last_active_at DESC
 	`
 
 	aiRows, err := s.db.Query(aiQuery, userID)
@@ -129,12 +145,12 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 
 		err := aiRows.Scan(
 			&friend.ID,
-			&friend.CharacterID,
 			&friend.Name,
 			&friend.AvatarURL,
 			&friend.PersonalitySignature,
 			&friend.LastMessage,
 			&friend.LastMessageAt,
+			&friend.UnreadCount,
 			&friend.IsOnline,
 			&friend.Type,
 			&growthPercentage,
@@ -146,6 +162,7 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 		}
 
 		// 设置AI伙伴特有的字段
+		friend.CompanionID = friend.ID
 		if growthPercentage.Valid {
 			friend.GrowthPercentage = growthPercentage.Float64
 		}
@@ -161,7 +178,7 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 
 	// 添加空白AI到好友列表（如果用户还没有AI伙伴）
 	var hasCompanion bool
-	err = s.db.QueryRow("SELECT COUNT(*) > 0 FROM ai_companions WHERE user_id = ?", userID).Scan(&hasCompanion)
+	err = s.db.QueryRow("SELECT COUNT(*) > 0 FROM ai_companions WHERE user_id = ? AND archived_at IS NULL", userID).Scan(&hasCompanion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check companion: %w", err)
 	}
@@ -170,7 +187,6 @@ func (s *FriendshipService) GetUserFriends(userID int) ([]models.FriendInfo, err
 		// 用户还没有AI伙伴，添加空白AI到好友列表
 		blankAI := models.FriendInfo{
 			ID:                   0,
-			CharacterID:          5,
 			Name:                 "空白AI",
 			AvatarURL:            "",
 			PersonalitySignature: "我...我是谁？你...你是谁？",
@@ -272,6 +288,7 @@ func (s *FriendshipService) AddFriend(userID int, characterID int) error {
 	if err != nil {
 		return fmt.Errorf("failed to add friend: %w", err)
 	}
+	s.eventHub.Publish(userID, EventFriendAdded, FriendAddedEvent{CharacterID: characterID})
 
 	// 生成AI欢迎消息
 	err = s.generateWelcomeMessage(userID, characterID)
@@ -356,7 +373,7 @@ func (s *FriendshipService) generateWelcomeMessage(userID int, characterID int)
 
 	// 保存欢迎消息到数据库
 	sessionID := fmt.Sprintf("welcome_%d_%d_%d", userID, characterID, time.Now().Unix())
-	_, err = s.db.Exec(`
+	result, err := s.db.Exec(`
 		INSERT INTO conversations 
 		(user_id, character_id, session_id, message_type, user_message, ai_response, is_ai_initiated, created_at)
 		VALUES (?, ?, ?, 'text', '', ?, true, NOW())
@@ -364,11 +381,21 @@ func (s *FriendshipService) generateWelcomeMessage(userID int, characterID int)
 	if err != nil {
 		return fmt.Errorf("failed to save welcome message: %w", err)
 	}
+	if messageID, err := result.LastInsertId(); err == nil {
+		s.eventHub.Publish(userID, EventMessageCreated, MessageCreatedEvent{
+			ChatTarget:    models.ChatTarget{CharacterID: characterID},
+			MessageID:     int(messageID),
+			SessionID:     sessionID,
+			AIResponse:    response,
+			IsAIInitiated: true,
+			Kind:          "welcome",
+		})
+	}
 
-	// 更新好友关系的最后消息时间和未读数量
+	// 更新好友关系的最后消息时间（欢迎消息未读，由未读统计计入）
 	_, err = s.db.Exec(`
 		UPDATE user_friendships 
-		SET last_message_at = NOW(), unread_count = unread_count + 1, updated_at = NOW()
+		SET last_message_at = NOW(), updated_at = NOW()
 		WHERE user_id = ? AND character_id = ?
 	`, userID, characterID)
 	if err != nil {
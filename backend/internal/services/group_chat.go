@@ -0,0 +1,478 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"seven-ai-backend/internal/models"
+	"strings"
+)
+
+var (
+	// ErrGroupChatNotFound 群聊不存在或不属于当前用户
+	ErrGroupChatNotFound = errors.New("群聊不存在")
+	// ErrInvalidGroupMember 群聊成员必须是用户的好友或AI伙伴
+	ErrInvalidGroupMember = errors.New("群聊成员必须是你的好友")
+	// ErrGroupChatNoSpeakers 群聊中没有可以发言的成员（成员已被移除或归档）
+	ErrGroupChatNoSpeakers = errors.New("群聊中没有可以发言的成员")
+)
+
+const (
+	groupTranscriptLimit = 30 // 生成回复时最多读取的群聊消息数
+	groupReplyMaxTokens  = 120
+)
+
+// GroupChatService 多角色群聊服务
+type GroupChatService struct {
+	db                  *sql.DB
+	aiService           *AIService
+	conversationService *ConversationService
+	eventHub            *EventHub
+}
+
+// NewGroupChatService 创建群聊服务
+func NewGroupChatService(db *sql.DB, aiService *AIService, conversationService *ConversationService) *GroupChatService {
+	return &GroupChatService{
+		db:                  db,
+		aiService:           aiService,
+		conversationService: conversationService,
+	}
+}
+
+// SetEventHub 设置实时事件中心
+func (s *GroupChatService) SetEventHub(hub *EventHub) {
+	s.eventHub = hub
+}
+
+// CreateGroupChat 创建群聊，成员必须是用户已添加的好友或自己的AI伙伴
+func (s *GroupChatService) CreateGroupChat(userID int, req models.CreateGroupChatRequest) (*models.GroupChat, error) {
+	candidates := make([]models.ChatTarget, 0, len(req.CharacterIDs)+len(req.CompanionIDs))
+	for _, id := range req.CharacterIDs {
+		candidates = append(candidates, models.ChatTarget{CharacterID: id})
+	}
+	for _, id := range req.CompanionIDs {
+		candidates = append(candidates, models.ChatTarget{CompanionID: id})
+	}
+
+	seen := map[models.ChatTarget]bool{}
+	var members []models.ChatTarget
+	for _, target := range candidates {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		if err := s.checkMember(userID, target); err != nil {
+			return nil, err
+		}
+		members = append(members, target)
+	}
+	if len(members) < 2 || len(members) > 6 {
+		return nil, ErrInvalidGroupMember
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO group_chats (user_id, title, created_at, last_active_at)
+		VALUES (?, ?, NOW(), NOW())
+	`, userID, req.Title)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group chat: %w", err)
+	}
+	groupID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, target := range members {
+		characterID, companionID := targetColumns(target)
+		_, err = tx.Exec(`
+			INSERT INTO group_chat_members (group_id, character_id, companion_id, joined_at) VALUES (?, ?, ?, NOW())
+		`, groupID, characterID, companionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add group member: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	group, err := s.GetGroupChat(userID, int(groupID))
+	if err != nil {
+		return nil, err
+	}
+	if group.Title == "" {
+		// 未指定标题时使用成员名字
+		names := make([]string, 0, len(group.Members))
+		for _, m := range group.Members {
+			names = append(names, m.Name)
+		}
+		group.Title = strings.Join(names, "、")
+		if _, err := s.db.Exec(`UPDATE group_chats SET title = ? WHERE id = ?`, group.Title, group.ID); err != nil {
+			return nil, fmt.Errorf("failed to update group title: %w", err)
+		}
+	}
+	return group, nil
+}
+
+// checkMember 检查角色或AI伙伴是否可以加入用户的群聊
+func (s *GroupChatService) checkMember(userID int, target models.ChatTarget) error {
+	if !target.Valid() {
+		return ErrInvalidGroupMember
+	}
+	var ok bool
+	var err error
+	if target.IsCompanion() {
+		err = s.db.QueryRow(`
+			SELECT COUNT(*) > 0 FROM ai_companions WHERE id = ? AND user_id = ? AND archived_at IS NULL
+		`, target.CompanionID, userID).Scan(&ok)
+	} else {
+		err = s.db.QueryRow(`
+			SELECT COUNT(*) > 0 FROM user_friendships
+			WHERE user_id = ? AND character_id = ? AND is_active = TRUE
+		`, userID, target.CharacterID).Scan(&ok)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check group member: %w", err)
+	}
+	if !ok {
+		return ErrInvalidGroupMember
+	}
+	return nil
+}
+
+// GetGroupChat 获取群聊及其成员
+func (s *GroupChatService) GetGroupChat(userID, groupID int) (*models.GroupChat, error) {
+	var group models.GroupChat
+	err := s.db.QueryRow(`
+		SELECT id, user_id, title, created_at, last_active_at
+		FROM group_chats WHERE id = ? AND user_id = ?
+	`, groupID, userID).Scan(&group.ID, &group.UserID, &group.Title, &group.CreatedAt, &group.LastActiveAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupChatNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group chat: %w", err)
+	}
+
+	members, err := s.listMembers(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	group.Members = members
+	return &group, nil
+}
+
+// listMembers 获取群聊成员，AI伙伴使用用户给它起的名字
+func (s *GroupChatService) listMembers(userID, groupID int) ([]models.GroupMember, error) {
+	rows, err := s.db.Query(`
+		SELECT m.character_id, m.companion_id,
+		       COALESCE(ac.name, pc.name, ''),
+		       COALESCE(ac.avatar_url, pc.avatar_url, '')
+		FROM group_chat_members m
+		LEFT JOIN preset_characters pc ON pc.id = m.character_id
+		LEFT JOIN ai_companions ac ON ac.id = m.companion_id AND ac.user_id = ?
+		WHERE m.group_id = ?
+		ORDER BY m.joined_at, m.id
+	`, userID, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.GroupMember{}
+	for rows.Next() {
+		var m models.GroupMember
+		var characterID, companionID sql.NullInt64
+		if err := rows.Scan(&characterID, &companionID, &m.Name, &m.AvatarURL); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		m.ChatTarget = scanTarget(characterID, companionID)
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// ListGroupChats 获取用户的群聊列表
+func (s *GroupChatService) ListGroupChats(userID int) ([]models.GroupChat, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, title, created_at, last_active_at
+		FROM group_chats WHERE user_id = ?
+		ORDER BY last_active_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group chats: %w", err)
+	}
+
+	groups := []models.GroupChat{}
+	for rows.Next() {
+		var group models.GroupChat
+		if err := rows.Scan(&group.ID, &group.UserID, &group.Title, &group.CreatedAt, &group.LastActiveAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan group chat: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	rows.Close()
+
+	for i := range groups {
+		members, err := s.listMembers(userID, groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].Members = members
+	}
+	return groups, nil
+}
+
+// DeleteGroupChat 删除群聊及其消息
+func (s *GroupChatService) DeleteGroupChat(userID, groupID int) error {
+	result, err := s.db.Exec(`DELETE FROM group_chats WHERE id = ? AND user_id = ?`, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group chat: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrGroupChatNotFound
+	}
+	return nil
+}
+
+// GetGroupMessages 获取群聊消息，beforeID为0时返回最新的消息，结果按时间正序
+func (s *GroupChatService) GetGroupMessages(userID, groupID, beforeID, limit int) ([]models.GroupMessage, error) {
+	group, err := s.GetGroupChat(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.queryMessages(group, beforeID, limit)
+}
+
+// queryMessages 按ID倒序取消息后翻转为正序，并填充发言角色名字
+func (s *GroupChatService) queryMessages(group *models.GroupChat, beforeID, limit int) ([]models.GroupMessage, error) {
+	query := `
+		SELECT id, group_id, speaker_type, character_id, companion_id, content, created_at
+		FROM group_messages WHERE group_id = ?
+	`
+	args := []interface{}{group.ID}
+	if beforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, beforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.GroupMessage{}
+	for rows.Next() {
+		var msg models.GroupMessage
+		var characterID, companionID sql.NullInt64
+		if err := rows.Scan(&msg.ID, &msg.GroupID, &msg.SpeakerType, &characterID, &companionID, &msg.Content, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group message: %w", err)
+		}
+		setGroupMessageSpeaker(group, &msg, characterID, companionID)
+		messages = append(messages, msg)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// SendGroupMessage 用户在群聊中发言，由编排器选出本轮回复的角色依次回复
+func (s *GroupChatService) SendGroupMessage(userID, groupID int, req models.GroupChatRequest) (*models.GroupChatResponse, error) {
+	group, err := s.GetGroupChat(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	recent, err := s.queryMessages(group, 0, groupTranscriptLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先加载成员人设再保存用户消息，加载失败时不会留下没有回复的消息
+	speakers, err := s.loadSpeakers(userID, group, req.Message)
+	if err != nil {
+		return nil, err
+	}
+	if len(speakers) == 0 {
+		return nil, ErrGroupChatNoSpeakers
+	}
+
+	userMessage, err := s.saveMessage(group, models.ChatTarget{}, req.Message)
+	if err != nil {
+		return nil, err
+	}
+	transcript := append(recent, *userMessage)
+
+	response := &models.GroupChatResponse{UserMessage: *userMessage, Replies: []models.GroupMessage{}}
+	for _, speaker := range selectSpeakers(speakers, req.Message, recent) {
+		reply, err := s.generateReply(userID, group, speaker, transcript)
+		if err != nil {
+			// 单个角色失败不影响其他角色发言
+			fmt.Printf("Group chat reply failed: group=%d, speaker=%+v, err=%v\n", group.ID, speaker.member.ChatTarget, err)
+			continue
+		}
+		saved, err := s.saveMessage(group, speaker.member.ChatTarget, reply)
+		if err != nil {
+			return nil, err
+		}
+		// 后发言的角色能看到同一轮中前面角色的回复
+		transcript = append(transcript, *saved)
+		response.Replies = append(response.Replies, *saved)
+	}
+
+	if _, err := s.db.Exec(`UPDATE group_chats SET last_active_at = NOW() WHERE id = ?`, group.ID); err != nil {
+		fmt.Printf("Failed to update group chat activity: %v\n", err)
+	}
+	return response, nil
+}
+
+// loadSpeakers 加载群成员的人设，AI伙伴使用动态生成的提示词；已归档的AI伙伴暂不发言
+func (s *GroupChatService) loadSpeakers(userID int, group *models.GroupChat, message string) ([]groupSpeaker, error) {
+	speakers := make([]groupSpeaker, 0, len(group.Members))
+	for _, member := range group.Members {
+		character, err := s.conversationService.getTargetPersona(userID, member.ChatTarget, message)
+		if errors.Is(err, ErrCompanionArchived) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get group member persona: %w", err)
+		}
+		speakers = append(speakers, groupSpeaker{
+			member:    member,
+			character: character,
+			keywords:  speakerKeywords(character),
+		})
+	}
+	return speakers, nil
+}
+
+// generateReply 以某个角色的身份，根据共享的群聊记录生成回复
+func (s *GroupChatService) generateReply(userID int, group *models.GroupChat, speaker groupSpeaker, transcript []models.GroupMessage) (string, error) {
+	var others []string
+	for _, m := range group.Members {
+		if m.ChatTarget != speaker.member.ChatTarget {
+			others = append(others, m.Name)
+		}
+	}
+	name := speaker.member.Name
+	systemPrompt := fmt.Sprintf(`%s
+
+你现在在一个群聊里，群成员有：用户、%s，以及你自己（%s）。
+要求：
+1. 只以%s的身份说话，不要替其他人发言，也不要在开头写自己的名字
+2. 可以回应用户，也可以接其他成员的话，保持你自己的性格和说话方式
+3. 像群聊一样简短自然，一般不超过60字`, speaker.character.SystemPrompt, strings.Join(others, "、"), name, name)
+
+	chatModel := "qwen3-max"
+	budget := s.conversationService.contextBudget
+	if budget <= 0 {
+		budget = defaultContextTokenBudget
+	}
+	remaining := budget - contextReplyReserve - CountTokens(chatModel, systemPrompt)
+
+	// 从最新的消息往前放，直到预算用完；自己的发言作为assistant，其他人的带上名字
+	var history []Message
+	for i := len(transcript) - 1; i >= 0; i-- {
+		msg := transcript[i]
+		var m Message
+		switch msg.Speaker() {
+		case models.ChatTarget{}:
+			m = Message{Role: "user", Content: "用户：" + msg.Content}
+		case speaker.member.ChatTarget:
+			m = Message{Role: "assistant", Content: msg.Content}
+		default:
+			m = Message{Role: "user", Content: msg.CharacterName + "：" + msg.Content}
+		}
+		cost := countMessageTokens(chatModel, m)
+		if cost > remaining {
+			break
+		}
+		remaining -= cost
+		history = append([]Message{m}, history...)
+	}
+
+	messages := append([]Message{{Role: "system", Content: systemPrompt}}, history...)
+	response, err := s.aiService.ChatWithLLMMaxTokens(messages, chatModel, 0.85, "text", groupReplyMaxTokens)
+	if err != nil {
+		return "", err
+	}
+
+	response = trimCharacterPrefix(name, response)
+	response = strings.TrimSpace(strings.TrimPrefix(response, "："))
+	if response == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+	return response, nil
+}
+
+// saveMessage 保存一条群聊消息，speaker为空值表示用户发言
+func (s *GroupChatService) saveMessage(group *models.GroupChat, speaker models.ChatTarget, content string) (*models.GroupMessage, error) {
+	speakerType := "user"
+	var characterID, companionID interface{}
+	if !speaker.IsZero() {
+		speakerType = "character"
+		characterID, companionID = targetColumns(speaker)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO group_messages (group_id, speaker_type, character_id, companion_id, content, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())
+	`, group.ID, speakerType, characterID, companionID, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save group message: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg models.GroupMessage
+	var savedCharacterID, savedCompanionID sql.NullInt64
+	err = s.db.QueryRow(`
+		SELECT id, group_id, speaker_type, character_id, companion_id, content, created_at
+		FROM group_messages WHERE id = ?
+	`, id).Scan(&msg.ID, &msg.GroupID, &msg.SpeakerType, &savedCharacterID, &savedCompanionID, &msg.Content, &msg.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group message: %w", err)
+	}
+	setGroupMessageSpeaker(group, &msg, savedCharacterID, savedCompanionID)
+
+	s.eventHub.Publish(group.UserID, EventGroupMessageCreated, msg)
+	return &msg, nil
+}
+
+// setGroupMessageSpeaker 填充消息的发言者及其名字
+func setGroupMessageSpeaker(group *models.GroupChat, msg *models.GroupMessage, characterID, companionID sql.NullInt64) {
+	if characterID.Valid {
+		id := int(characterID.Int64)
+		msg.CharacterID = &id
+	}
+	if companionID.Valid {
+		id := int(companionID.Int64)
+		msg.CompanionID = &id
+	}
+	speaker := msg.Speaker()
+	if speaker.IsZero() {
+		return
+	}
+	for _, m := range group.Members {
+		if m.ChatTarget == speaker {
+			msg.CharacterName = m.Name
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/json"
+	"seven-ai-backend/internal/models"
+	"sort"
+	"strings"
+)
+
+const (
+	maxMentionedSpeakers  = 3 // 被点名时本轮最多几个角色回复
+	maxSpontaneousSpeaker = 2 // 未点名时本轮最多几个角色回复
+	turnTakingWindow      = 6 // 统计最近几条消息中各角色的发言次数
+	minRelevanceToJoin    = 1 // 第二个角色接话所需的最低相关度
+)
+
+// groupSpeaker 群聊中的一个角色及其人设
+type groupSpeaker struct {
+	member    models.GroupMember
+	character *models.CharacterResponse
+	keywords  []string // 用于判断话题相关度的关键词
+}
+
+// selectSpeakers 决定本轮由哪些角色发言：
+// 1. 被@或被直接叫到名字的角色按出现顺序优先回复
+// 2. 否则按话题相关度和轮流发言排序，最近说得多的角色靠后
+func selectSpeakers(speakers []groupSpeaker, message string, recent []models.GroupMessage) []groupSpeaker {
+	if len(speakers) == 0 {
+		return nil
+	}
+
+	// 按名字出现的位置找出被点名的角色
+	type mention struct {
+		speaker groupSpeaker
+		index   int
+	}
+	var mentions []mention
+	for _, sp := range speakers {
+		if sp.member.Name == "" {
+			continue
+		}
+		if idx := strings.Index(message, sp.member.Name); idx >= 0 {
+			mentions = append(mentions, mention{speaker: sp, index: idx})
+		}
+	}
+	if len(mentions) > 0 {
+		sort.SliceStable(mentions, func(i, j int) bool { return mentions[i].index < mentions[j].index })
+		selected := make([]groupSpeaker, 0, len(mentions))
+		for _, m := range mentions {
+			if len(selected) == maxMentionedSpeakers {
+				break
+			}
+			selected = append(selected, m.speaker)
+		}
+		return selected
+	}
+
+	// 最近发言次数，用于轮流发言
+	spoken := map[models.ChatTarget]int{}
+	start := len(recent) - turnTakingWindow
+	if start < 0 {
+		start = 0
+	}
+	for _, msg := range recent[start:] {
+		if speaker := msg.Speaker(); !speaker.IsZero() {
+			spoken[speaker]++
+		}
+	}
+	var lastSpeaker models.ChatTarget
+	for i := len(recent) - 1; i >= 0; i-- {
+		if speaker := recent[i].Speaker(); !speaker.IsZero() {
+			lastSpeaker = speaker
+			break
+		}
+	}
+
+	type scored struct {
+		speaker   groupSpeaker
+		relevance int
+		score     int
+	}
+	candidates := make([]scored, 0, len(speakers))
+	for _, sp := range speakers {
+		relevance := 0
+		for _, keyword := range sp.keywords {
+			if strings.Contains(message, keyword) {
+				relevance++
+			}
+		}
+		score := relevance*3 - spoken[sp.member.ChatTarget]*2
+		if sp.member.ChatTarget == lastSpeaker {
+			score -= 2
+		}
+		candidates = append(candidates, scored{speaker: sp, relevance: relevance, score: score})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	// 得分最高的角色一定回复，其余角色只有话题相关时才接话
+	selected := []groupSpeaker{candidates[0].speaker}
+	for _, c := range candidates[1:] {
+		if len(selected) == maxSpontaneousSpeaker {
+			break
+		}
+		if c.relevance >= minRelevanceToJoin {
+			selected = append(selected, c.speaker)
+		}
+	}
+	return selected
+}
+
+// speakerKeywords 从角色的搜索关键词和技能中提取话题关键词
+func speakerKeywords(character *models.CharacterResponse) []string {
+	var keywords []string
+	for _, k := range strings.FieldsFunc(character.SearchKeywords, func(r rune) bool {
+		return r == ',' || r == '，' || r == ' ' || r == '、'
+	}) {
+		if k != character.Name && len([]rune(k)) >= 2 {
+			keywords = append(keywords, k)
+		}
+	}
+
+	var skills []string
+	if character.Skills != "" && json.Unmarshal([]byte(character.Skills), &skills) == nil {
+		for _, skill := range skills {
+			if len([]rune(skill)) >= 2 {
+				keywords = append(keywords, skill)
+			}
+		}
+	}
+	return keywords
+}
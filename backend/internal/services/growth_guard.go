@@ -0,0 +1,321 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"seven-ai-backend/internal/growth"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 成长事件类型
+const (
+	GrowthEventExperience = "experience" // 一轮对话的经验结算
+	GrowthEventAbility    = "ability"    // 一次能力值变化（或被拦截的变化）
+)
+
+const (
+	abilityCooldown          = 30 * time.Minute // 同一项能力两次提升的最短间隔
+	duplicateLookback        = 10               // 与最近几条用户消息比较是否重复
+	duplicateWindow          = 24 * time.Hour   // 只和这段时间内的消息比较
+	duplicateSimilarity      = 0.85             // 相似度达到该值视为重复消息
+	minAbilityQuality        = 0.4              // 质量分低于该值的对话不提升能力
+	minQualityMultiplier     = 0.2              // 质量分为0时经验的折算比例
+	qualityShortMessageRunes = 4                // 少于该长度视为过短
+	qualityPasteRunes        = 300              // 超过该长度视为疑似粘贴
+	qualityMinDiversity      = 0.3              // 不同字符占比低于该值视为刷字
+)
+
+// exchangeAssessment 对一轮对话的防刷评估
+type exchangeAssessment struct {
+	quality   float64  // 质量分 (0-1)
+	duplicate bool     // 是否与最近的消息重复
+	reasons   []string // 扣减原因，写入成长事件
+}
+
+// applyGrowthGuards 按质量、重复、每日递减和能力冷却计算本轮经验并更新能力值，
+// 所有调整都写入成长事件日志；返回最终获得的经验
+func (s *ConversationService) applyGrowthGuards(tx *sql.Tx, userID int, companion *models.AICompanion, userMessage, aiResponse string) (int, error) {
+	now := time.Now()
+	assessment, err := assessExchange(tx, userID, companion.ID, userMessage, aiResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	// 经验：基础值 × 质量折算 × 每日递减，重复消息不得经验
+	earned, err := experienceEarnedSince(tx, companion.ID, now.Add(-growth.DailyWindow))
+	if err != nil {
+		return 0, err
+	}
+	dailyMultiplier := growth.DailyMultiplier(earned)
+
+	base := s.calculateExperienceGain(userMessage, aiResponse)
+	final := guardedExperience(base, assessment.quality, dailyMultiplier)
+	reasons := append([]string{}, assessment.reasons...)
+	if assessment.duplicate {
+		final = 0
+	}
+	if dailyMultiplier < 1 {
+		reasons = append(reasons, fmt.Sprintf("24小时内已获得%d经验，收益递减为%.0f%%", earned, dailyMultiplier*100))
+	}
+	err = recordGrowthEvent(tx, models.GrowthEvent{
+		CompanionID:     companion.ID,
+		EventType:       GrowthEventExperience,
+		BaseValue:       base,
+		FinalValue:      final,
+		QualityScore:    assessment.quality,
+		DailyMultiplier: dailyMultiplier,
+		Reasons:         reasons,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// 能力值：每项能力在冷却时间内最多提升一次，重复或低质量的对话不提升
+	cooling, err := abilitiesInCooldown(tx, companion.ID, now.Add(-abilityCooldown))
+	if err != nil {
+		return 0, err
+	}
+	for _, ability := range s.abilityHits(userMessage) {
+		event := models.GrowthEvent{
+			CompanionID:  companion.ID,
+			EventType:    GrowthEventAbility,
+			Ability:      ability,
+			BaseValue:    1,
+			QualityScore: assessment.quality,
+		}
+		field := abilityField(companion, ability)
+		switch {
+		case assessment.duplicate:
+			event.Reasons = []string{"重复消息"}
+		case assessment.quality < minAbilityQuality:
+			event.Reasons = []string{"对话质量较低"}
+		case cooling[ability]:
+			event.Reasons = []string{fmt.Sprintf("%d分钟内已提升过", int(abilityCooldown.Minutes()))}
+		case *field >= 10:
+			event.Reasons = []string{"已达上限"}
+		default:
+			*field++
+			event.FinalValue = 1
+		}
+		if err := recordGrowthEvent(tx, event); err != nil {
+			return 0, err
+		}
+	}
+
+	return final, nil
+}
+
+// guardedExperience 基础经验按质量分和每日递减系数折算后的经验
+func guardedExperience(base int, quality, dailyMultiplier float64) int {
+	qualityMultiplier := minQualityMultiplier + (1-minQualityMultiplier)*quality
+	return int(math.Round(float64(base) * qualityMultiplier * dailyMultiplier))
+}
+
+// assessExchange 评估一轮对话的质量并检测重复消息
+func assessExchange(tx *sql.Tx, userID, companionID int, userMessage, aiResponse string) (exchangeAssessment, error) {
+	quality, reasons := exchangeQuality(userMessage, aiResponse)
+	assessment := exchangeAssessment{quality: quality, reasons: reasons}
+
+	duplicate, err := isDuplicateMessage(tx, userID, companionID, userMessage)
+	if err != nil {
+		return assessment, err
+	}
+	if duplicate {
+		assessment.duplicate = true
+		assessment.reasons = append(assessment.reasons, "与最近的消息重复或高度相似")
+	}
+	return assessment, nil
+}
+
+// exchangeQuality 启发式质量分 (0-1)：过短、刷字、没有文字、疑似粘贴或没有得到回复都会降低分数
+func exchangeQuality(userMessage, aiResponse string) (float64, []string) {
+	runes := []rune(strings.TrimSpace(userMessage))
+	if len(runes) == 0 {
+		return 0, []string{"空消息"}
+	}
+
+	score := 1.0
+	var reasons []string
+
+	hasText := false
+	unique := map[rune]bool{}
+	for _, r := range runes {
+		unique[r] = true
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			hasText = true
+		}
+	}
+	if !hasText {
+		score *= 0.3
+		reasons = append(reasons, "没有文字内容")
+	}
+	if len(runes) < qualityShortMessageRunes {
+		score *= 0.5
+		reasons = append(reasons, "消息过短")
+	}
+	if len(runes) >= 6 {
+		if diversity := float64(len(unique)) / float64(len(runes)); diversity < qualityMinDiversity {
+			score *= diversity / qualityMinDiversity
+			reasons = append(reasons, "重复字符过多")
+		}
+	}
+	if len(runes) > qualityPasteRunes {
+		score *= 0.7
+		reasons = append(reasons, "疑似粘贴长文本")
+	}
+	if strings.TrimSpace(aiResponse) == "" {
+		score *= 0.5
+		reasons = append(reasons, "没有得到回复")
+	}
+	return math.Round(clampUnit(score)*1000) / 1000, reasons
+}
+
+// isDuplicateMessage 用户消息是否与最近发给该AI伙伴的消息相同或高度相似
+// 本轮消息已先于结算保存，比较时跳过与其完全相同的第一条
+func isDuplicateMessage(tx *sql.Tx, userID, companionID int, userMessage string) (bool, error) {
+	rows, err := tx.Query(`
+		SELECT user_message FROM conversations
+		WHERE user_id = ? AND companion_id = ? AND deleted_at IS NULL
+		  AND is_ai_initiated = FALSE AND user_message <> '' AND created_at >= ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, userID, companionID, time.Now().Add(-duplicateWindow), duplicateLookback+1)
+	if err != nil {
+		return false, fmt.Errorf("failed to query recent messages: %w", err)
+	}
+	defer rows.Close()
+
+	var recent []string
+	for rows.Next() {
+		var previous string
+		if err := rows.Scan(&previous); err != nil {
+			return false, fmt.Errorf("failed to scan recent message: %w", err)
+		}
+		recent = append(recent, previous)
+	}
+	return duplicateOfRecent(recent, userMessage), nil
+}
+
+// duplicateOfRecent 消息是否与最近的消息（最新的在前）相同或高度相似，
+// 第一条完全相同的视为本轮消息自身并跳过
+func duplicateOfRecent(recent []string, userMessage string) bool {
+	skippedCurrent := false
+	for _, previous := range recent {
+		if !skippedCurrent && previous == userMessage {
+			skippedCurrent = true
+			continue
+		}
+		if memorySimilarity(previous, userMessage) >= duplicateSimilarity {
+			return true
+		}
+	}
+	return false
+}
+
+// experienceEarnedSince AI伙伴自since以来已获得的对话经验
+func experienceEarnedSince(tx *sql.Tx, companionID int, since time.Time) (int, error) {
+	var earned int
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(final_value), 0) FROM companion_growth_events
+		WHERE companion_id = ? AND event_type = ? AND created_at >= ?
+	`, companionID, GrowthEventExperience, since).Scan(&earned)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum daily experience: %w", err)
+	}
+	return earned, nil
+}
+
+// abilitiesInCooldown since之后提升过的能力
+func abilitiesInCooldown(tx *sql.Tx, companionID int, since time.Time) (map[string]bool, error) {
+	rows, err := tx.Query(`
+		SELECT DISTINCT ability FROM companion_growth_events
+		WHERE companion_id = ? AND event_type = ? AND final_value > 0 AND created_at >= ?
+	`, companionID, GrowthEventAbility, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ability cooldowns: %w", err)
+	}
+	defer rows.Close()
+
+	cooling := map[string]bool{}
+	for rows.Next() {
+		var ability string
+		if err := rows.Scan(&ability); err != nil {
+			return nil, fmt.Errorf("failed to scan ability cooldown: %w", err)
+		}
+		cooling[ability] = true
+	}
+	return cooling, nil
+}
+
+// recordGrowthEvent 写入一条成长事件
+func recordGrowthEvent(tx *sql.Tx, event models.GrowthEvent) error {
+	reasons, err := json.Marshal(event.Reasons)
+	if err != nil {
+		return err
+	}
+	var ability interface{}
+	if event.Ability != "" {
+		ability = event.Ability
+	}
+	_, err = tx.Exec(`
+		INSERT INTO companion_growth_events
+		(companion_id, event_type, ability, base_value, final_value, quality_score, daily_multiplier, reasons, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	`, event.CompanionID, event.EventType, ability, event.BaseValue, event.FinalValue,
+		event.QualityScore, event.DailyMultiplier, string(reasons))
+	if err != nil {
+		return fmt.Errorf("failed to record growth event: %w", err)
+	}
+	return nil
+}
+
+// loadGrowthEvents 查询AI伙伴最近的成长事件，最新的在前
+func loadGrowthEvents(db *sql.DB, companionID int, req models.GrowthEventListRequest) ([]models.GrowthEvent, error) {
+	if req.Limit <= 0 || req.Limit > 200 {
+		req.Limit = 50
+	}
+	where := "companion_id = ?"
+	args := []interface{}{companionID}
+	if req.EventType != "" {
+		where += " AND event_type = ?"
+		args = append(args, req.EventType)
+	}
+	args = append(args, req.Limit)
+
+	rows, err := db.Query(`
+		SELECT id, companion_id, event_type, COALESCE(ability, ''), base_value, final_value,
+		       quality_score, daily_multiplier, reasons, created_at
+		FROM companion_growth_events
+		WHERE `+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query growth events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.GrowthEvent{}
+	for rows.Next() {
+		var event models.GrowthEvent
+		var reasons sql.NullString
+		if err := rows.Scan(&event.ID, &event.CompanionID, &event.EventType, &event.Ability,
+			&event.BaseValue, &event.FinalValue, &event.QualityScore, &event.DailyMultiplier,
+			&reasons, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan growth event: %w", err)
+		}
+		if reasons.Valid {
+			_ = json.Unmarshal([]byte(reasons.String), &event.Reasons)
+		}
+		if event.Reasons == nil {
+			event.Reasons = []string{}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExchangeQuality(t *testing.T) {
+	varied := pastedText(400)
+	tests := []struct {
+		name       string
+		message    string
+		reply      string
+		wantScore  float64
+		wantReason string
+	}{
+		{"normal", "今天工作好累，想和你聊聊天", "辛苦啦，想聊什么都可以", 1, ""},
+		{"empty", "   ", "好的", 0, "空消息"},
+		{"short", "嗯", "怎么啦", 0.5, "消息过短"},
+		{"no text", "！！！？？？", "怎么啦", 0.3, "没有文字内容"},
+		{"repeated characters", strings.Repeat("哈", 10), "这么开心呀", 0.333, "重复字符过多"},
+		{"pasted text", varied, "好长的一段话", 0.7, "疑似粘贴长文本"},
+		{"no reply", "今天工作好累，想和你聊聊天", "", 0.5, "没有得到回复"},
+	}
+	for _, tt := range tests {
+		score, reasons := exchangeQuality(tt.message, tt.reply)
+		if score != tt.wantScore {
+			t.Errorf("%s: score = %v, want %v", tt.name, score, tt.wantScore)
+		}
+		if tt.wantReason == "" {
+			if len(reasons) != 0 {
+				t.Errorf("%s: reasons = %v, want none", tt.name, reasons)
+			}
+			continue
+		}
+		found := false
+		for _, r := range reasons {
+			found = found || r == tt.wantReason
+		}
+		if !found {
+			t.Errorf("%s: reasons = %v, want %q", tt.name, reasons, tt.wantReason)
+		}
+	}
+}
+
+func TestDuplicateOfRecent(t *testing.T) {
+	tests := []struct {
+		name    string
+		recent  []string
+		message string
+		want    bool
+	}{
+		{"only the current message", []string{"今天天气真好啊"}, "今天天气真好啊", false},
+		{"exact repeat", []string{"今天天气真好啊", "你好", "今天天气真好啊"}, "今天天气真好啊", true},
+		{"near duplicate", []string{"今天天气真好啊！", "今天天气真好啊"}, "今天天气真好啊！", true},
+		{"different messages", []string{"我想去看电影", "晚饭吃了面条"}, "我想去看电影", false},
+		{"no history", nil, "你好", false},
+	}
+	for _, tt := range tests {
+		if got := duplicateOfRecent(tt.recent, tt.message); got != tt.want {
+			t.Errorf("%s: duplicateOfRecent = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPastedTextEarnsLessThanNormalMessage(t *testing.T) {
+	s := &ConversationService{}
+	reply := "听起来很有意思，能再多说一点吗？我很想知道后来发生了什么"
+
+	normal := "今天下班路上看到一只小猫，特别可爱，一直跟着我走了好远"
+	normalQuality, _ := exchangeQuality(normal, reply)
+	normalXP := guardedExperience(s.calculateExperienceGain(normal, reply), normalQuality, 1)
+
+	pasted := pastedText(400)
+	pastedQuality, _ := exchangeQuality(pasted, reply)
+	pastedXP := guardedExperience(s.calculateExperienceGain(pasted, reply), pastedQuality, 1)
+
+	if pastedXP >= normalXP {
+		t.Fatalf("pasted text earned %d XP, normal message earned %d", pastedXP, normalXP)
+	}
+}
+
+func TestGuardedExperience(t *testing.T) {
+	tests := []struct {
+		base    int
+		quality float64
+		daily   float64
+		want    int
+	}{
+		{10, 1, 1, 10},
+		{10, 0, 1, 2},
+		{10, 1, 0.5, 5},
+		{10, 0.5, 0.1, 1},
+	}
+	for _, tt := range tests {
+		if got := guardedExperience(tt.base, tt.quality, tt.daily); got != tt.want {
+			t.Errorf("guardedExperience(%d, %v, %v) = %d, want %d", tt.base, tt.quality, tt.daily, got, tt.want)
+		}
+	}
+}
+
+// pastedText 生成n个互不相同的汉字，模拟粘贴的长文本
+func pastedText(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteRune(rune(0x4E00 + i))
+	}
+	return b.String()
+}
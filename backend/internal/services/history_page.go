@@ -0,0 +1,190 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"seven-ai-backend/internal/models"
+	"time"
+)
+
+// ErrInvalidHistoryCursor 游标消息不存在或不属于当前查询范围
+var ErrInvalidHistoryCursor = errors.New("无效的分页游标")
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+// historyColumns 聊天记录列表查询的字段，与scanHistory对应
+const historyColumns = `id, user_message, ai_response, message_type, created_at, edited_at,
+		(SELECT COUNT(*) FROM conversation_replies r WHERE r.conversation_id = conversations.id)`
+
+// scanHistory 扫描一条聊天记录
+func scanHistory(scanner interface{ Scan(...interface{}) error }, conv *models.ConversationHistory) error {
+	var editedAt sql.NullTime
+	err := scanner.Scan(&conv.ID, &conv.UserMessage, &conv.AIResponse, &conv.MessageType, &conv.CreatedAt,
+		&editedAt, &conv.AlternativeCount)
+	if err != nil {
+		return err
+	}
+	if editedAt.Valid {
+		conv.EditedAt = &editedAt.Time
+	}
+	// 未重新生成过的消息只有一个回复
+	if conv.AlternativeCount == 0 {
+		conv.AlternativeCount = 1
+	}
+	return nil
+}
+
+// normalizeHistoryPageRequest 补全分页参数默认值
+func normalizeHistoryPageRequest(page models.HistoryPageRequest) models.HistoryPageRequest {
+	if page.Limit <= 0 {
+		page.Limit = defaultHistoryPageSize
+	}
+	if page.Limit > maxHistoryPageSize {
+		page.Limit = maxHistoryPageSize
+	}
+	if page.Direction != models.HistoryDirectionForward {
+		page.Direction = models.HistoryDirectionBackward
+	}
+	// 同时传入两个游标时以before为准
+	if page.Before > 0 {
+		page.After = 0
+		page.Direction = models.HistoryDirectionBackward
+	} else if page.After > 0 {
+		page.Direction = models.HistoryDirectionForward
+	}
+	return page
+}
+
+// queryHistoryPage 按(created_at, id)游标分页查询聊天记录
+// filter为不含游标的WHERE条件，args为其参数
+func (s *ConversationService) queryHistoryPage(filter string, args []interface{}, page models.HistoryPageRequest) (*models.HistoryPage, error) {
+	if page.Around > 0 && page.Before == 0 && page.After == 0 {
+		return s.queryHistoryAround(filter, args, page)
+	}
+	page = normalizeHistoryPageRequest(page)
+	result := &models.HistoryPage{Messages: []models.ConversationHistory{}}
+
+	// 总数和未读数不受游标影响
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_read = FALSE THEN 1 ELSE 0 END), 0)
+		FROM conversations WHERE `+filter, args...).Scan(&result.Total, &result.Unread)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count conversation history: %w", err)
+	}
+
+	where := filter
+	queryArgs := append([]interface{}{}, args...)
+	cursorID := page.Before
+	if page.After > 0 {
+		cursorID = page.After
+	}
+	if cursorID > 0 {
+		var cursorTime time.Time
+		err := s.db.QueryRow(`SELECT created_at FROM conversations WHERE id = ? AND `+filter,
+			append([]interface{}{cursorID}, args...)...).Scan(&cursorTime)
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidHistoryCursor
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to query cursor message: %w", err)
+		}
+
+		if page.Before > 0 {
+			where += " AND (created_at < ? OR (created_at = ? AND id < ?))"
+		} else {
+			where += " AND (created_at > ? OR (created_at = ? AND id > ?))"
+		}
+		queryArgs = append(queryArgs, cursorTime, cursorTime, cursorID)
+	}
+
+	order := "created_at DESC, id DESC"
+	if page.Direction == models.HistoryDirectionForward {
+		order = "created_at ASC, id ASC"
+	}
+
+	// 多取一条用于判断是否还有更多
+	queryArgs = append(queryArgs, page.Limit+1)
+	rows, err := s.db.Query(`
+		SELECT `+historyColumns+`
+		FROM conversations
+		WHERE `+where+`
+		ORDER BY `+order+`
+		LIMIT ?
+	`, queryArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var conv models.ConversationHistory
+		if err := scanHistory(rows, &conv); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		result.Messages = append(result.Messages, conv)
+	}
+
+	if len(result.Messages) > page.Limit {
+		result.HasMore = true
+		result.Messages = result.Messages[:page.Limit]
+	}
+
+	// 统一按时间升序返回
+	if page.Direction == models.HistoryDirectionBackward {
+		msgs := result.Messages
+		for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		}
+	}
+
+	if n := len(result.Messages); n > 0 {
+		result.BeforeCursor = result.Messages[0].ID
+		result.AfterCursor = result.Messages[n-1].ID
+	}
+
+	return result, nil
+}
+
+// queryHistoryAround 查询某条消息及其前后各半页的消息
+func (s *ConversationService) queryHistoryAround(filter string, args []interface{}, page models.HistoryPageRequest) (*models.HistoryPage, error) {
+	page = normalizeHistoryPageRequest(page)
+	half := page.Limit / 2
+	if half < 1 {
+		half = 1
+	}
+
+	var center models.ConversationHistory
+	err := scanHistory(s.db.QueryRow(`
+		SELECT `+historyColumns+`
+		FROM conversations WHERE id = ? AND `+filter,
+		append([]interface{}{page.Around}, args...)...), &center)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidHistoryCursor
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cursor message: %w", err)
+	}
+
+	older, err := s.queryHistoryPage(filter, args, models.HistoryPageRequest{Before: page.Around, Limit: half})
+	if err != nil {
+		return nil, err
+	}
+	newer, err := s.queryHistoryPage(filter, args, models.HistoryPageRequest{After: page.Around, Limit: half})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.HistoryPage{
+		Messages: append(append(older.Messages, center), newer.Messages...),
+		HasMore:  older.HasMore || newer.HasMore,
+		Total:    older.Total,
+		Unread:   older.Unread,
+	}
+	result.BeforeCursor = result.Messages[0].ID
+	result.AfterCursor = result.Messages[len(result.Messages)-1].ID
+	return result, nil
+}
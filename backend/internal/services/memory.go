@@ -0,0 +1,431 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"unicode"
+)
+
+// ErrMemoryNotFound 记忆不存在或不属于当前用户的AI伙伴
+var ErrMemoryNotFound = errors.New("记忆不存在")
+
+const (
+	memoryExtractMinRunes  = 4    // 用户消息太短时不提取记忆
+	memoryMaxContentRunes  = 200  // 单条记忆的最大长度
+	memoryMaxTags          = 5    // 单条记忆最多保留的标签数
+	memoryExtractContext   = 40   // 提取时提供给模型参考的已有记忆数
+	memoryMergeSimilarity  = 0.75 // 与已有记忆的相似度达到该值时视为同一条记忆
+	defaultMemoryListLimit = 50
+	memoryExtractMaxTokens = 400
+)
+
+// memoryTypes 记忆类型：事件、偏好、情绪、教训、用户特征
+var memoryTypes = map[string]bool{
+	"event":      true,
+	"preference": true,
+	"emotion":    true,
+	"lesson":     true,
+	"user_trait": true,
+}
+
+// memoryColumns 查询记忆片段时的字段列表，与scanMemoryFragment的顺序一致
+const memoryColumns = `
+	mf.id, mf.companion_id, mf.memory_type, mf.content, mf.importance_score, mf.tags,
+	mf.mention_count, mf.is_user_edited, mf.created_at, mf.updated_at
+`
+
+// MemoryService AI伙伴的结构化长期记忆：对话后自动提取，用户可查看、修正和删除
+type MemoryService struct {
+	db          *sql.DB
+	aiService   *AIService
+	vectorIndex *VectorIndex // 可选的向量索引，用于语义检索
+	topK        int          // 每次回复最多带上的记忆数
+	tokenBudget int          // 记忆占用的token上限
+}
+
+// NewMemoryService 创建记忆服务
+func NewMemoryService(db *sql.DB, aiService *AIService) *MemoryService {
+	return &MemoryService{
+		db:          db,
+		aiService:   aiService,
+		topK:        defaultMemoryTopK,
+		tokenBudget: defaultMemoryTokenBudget,
+	}
+}
+
+// extractedMemory 模型从一轮对话中提取出的一条记忆
+type extractedMemory struct {
+	Type       string   `json:"type"`
+	Content    string   `json:"content"`
+	Importance int      `json:"importance"`
+	Tags       []string `json:"tags"`
+	MergeID    int      `json:"merge_id"` // 与之合并的已有记忆ID，0表示新记忆
+}
+
+// extractInBackground 后台提取记忆，失败只记录日志
+func (s *MemoryService) extractInBackground(userID, companionID int, userMessage, aiResponse string) {
+	if err := s.ExtractFromExchange(userID, companionID, userMessage, aiResponse); err != nil {
+		log.Printf("提取记忆失败: userID=%d, companionID=%d, err=%v", userID, companionID, err)
+	}
+}
+
+// ExtractFromExchange 从一轮对话中提取关于用户的长期记忆，并与已有记忆去重合并
+// 用户在偏好设置中关闭了自动保存记忆时不提取
+func (s *MemoryService) ExtractFromExchange(userID, companionID int, userMessage, aiResponse string) error {
+	if len([]rune(strings.TrimSpace(userMessage))) < memoryExtractMinRunes {
+		return nil
+	}
+
+	var enabled bool
+	err := s.db.QueryRow(`
+		SELECT COALESCE((SELECT auto_save_memories FROM user_preferences WHERE user_id = ?), TRUE)
+	`, userID).Scan(&enabled)
+	if err != nil {
+		return fmt.Errorf("failed to query memory preference: %w", err)
+	}
+	if !enabled {
+		return nil
+	}
+
+	existing, err := s.loadFragments(companionID, "", memoryExtractContext)
+	if err != nil {
+		return err
+	}
+
+	var known strings.Builder
+	for _, m := range existing {
+		fmt.Fprintf(&known, "[%d] (%s) %s\n", m.ID, m.MemoryType, m.Content)
+	}
+	if known.Len() == 0 {
+		known.WriteString("（暂无）\n")
+	}
+
+	messages := []Message{
+		{Role: "system", Content: `你负责为AI伙伴整理关于用户的长期记忆。从本轮对话中找出值得长期记住的、关于用户的事实，分为五类：
+event（用户经历的事件）、preference（喜好和厌恶）、emotion（持续的情绪状态）、lesson（用户分享的经验或道理）、user_trait（性格、身份等个人信息）。
+寒暄、一次性的提问和AI自己说的话不要记。每条记忆用一句第三人称陈述，重要性为1-10的整数。
+如果某条记忆与已有记忆是同一件事或是对它的更新，merge_id填该记忆的编号，content给出合并后的完整内容；否则merge_id为0。
+只输出JSON数组，没有值得记住的内容时输出[]。格式：[{"type":"preference","content":"用户喜欢吃辣","importance":6,"tags":["饮食"],"merge_id":0}]`},
+		{Role: "user", Content: fmt.Sprintf("已有记忆：\n%s\n本轮对话：\n用户：%s\n伙伴：%s", known.String(), userMessage, aiResponse)},
+	}
+	raw, err := s.aiService.ChatWithLLMMaxTokens(messages, "", 0.2, "text", memoryExtractMaxTokens)
+	if err != nil {
+		return fmt.Errorf("failed to extract memories: %w", err)
+	}
+
+	for _, m := range parseExtractedMemories(raw) {
+		saved, err := s.saveExtracted(companionID, existing, m)
+		if err != nil {
+			return err
+		}
+		// 新写入的记忆也参与同一批次后续条目的去重
+		if saved != nil {
+			existing = append(existing, saved)
+		}
+	}
+	return nil
+}
+
+// parseExtractedMemories 解析模型输出的JSON数组，丢弃格式不合法的条目
+func parseExtractedMemories(raw string) []extractedMemory {
+	start := strings.Index(raw, "[")
+	end := strings.LastIndex(raw, "]")
+	if start < 0 || end <= start {
+		return nil
+	}
+
+	var items []extractedMemory
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &items); err != nil {
+		return nil
+	}
+
+	var result []extractedMemory
+	for _, m := range items {
+		m.Type = strings.TrimSpace(m.Type)
+		m.Content = truncateRunes(strings.TrimSpace(m.Content), memoryMaxContentRunes)
+		if !memoryTypes[m.Type] || m.Content == "" {
+			continue
+		}
+		m.Importance = clampImportance(m.Importance)
+		m.Tags = normalizeTags(m.Tags)
+		result = append(result, m)
+	}
+	return result
+}
+
+// saveExtracted 把提取出的记忆合并进相同的已有记忆，没有相同的则新建
+// 新建时返回新记忆，合并时返回nil
+func (s *MemoryService) saveExtracted(companionID int, existing []*models.MemoryFragment, m extractedMemory) (*models.MemoryFragment, error) {
+	var target *models.MemoryFragment
+	bestSimilarity := 0.0
+	for _, fragment := range existing {
+		if m.MergeID > 0 && fragment.ID == m.MergeID {
+			target = fragment
+			break
+		}
+		if similarity := memorySimilarity(fragment.Content, m.Content); similarity >= memoryMergeSimilarity && similarity > bestSimilarity {
+			target, bestSimilarity = fragment, similarity
+		}
+	}
+
+	if target != nil {
+		return nil, s.mergeFragment(target, m)
+	}
+
+	tags, _ := json.Marshal(m.Tags)
+	result, err := s.db.Exec(`
+		INSERT INTO memory_fragments (companion_id, memory_type, content, importance_score, tags, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), NOW())
+	`, companionID, m.Type, m.Content, m.Importance, string(tags))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save memory: %w", err)
+	}
+	id, _ := result.LastInsertId()
+	fragment := &models.MemoryFragment{
+		ID:              int(id),
+		CompanionID:     companionID,
+		MemoryType:      m.Type,
+		Content:         m.Content,
+		ImportanceScore: m.Importance,
+		Tags:            tags,
+		MentionCount:    1,
+	}
+	s.indexMemory(fragment)
+	return fragment, nil
+}
+
+// mergeFragment 合并到已有记忆：重要性取较高值，标签取并集，用户修正过的内容不被覆盖
+func (s *MemoryService) mergeFragment(target *models.MemoryFragment, m extractedMemory) error {
+	var tags []string
+	if len(target.Tags) > 0 {
+		_ = json.Unmarshal(target.Tags, &tags)
+	}
+	tags = normalizeTags(append(tags, m.Tags...))
+	tagsJSON, _ := json.Marshal(tags)
+
+	if !target.IsUserEdited {
+		target.Content = m.Content
+		target.MemoryType = m.Type
+	}
+	if m.Importance > target.ImportanceScore {
+		target.ImportanceScore = m.Importance
+	}
+	target.Tags = tagsJSON
+	target.MentionCount++
+
+	_, err := s.db.Exec(`
+		UPDATE memory_fragments
+		SET memory_type = ?, content = ?, importance_score = ?, tags = ?,
+		    mention_count = mention_count + 1, updated_at = NOW()
+		WHERE id = ?
+	`, target.MemoryType, target.Content, target.ImportanceScore, string(tagsJSON), target.ID)
+	if err != nil {
+		return fmt.Errorf("failed to merge memory: %w", err)
+	}
+	s.indexMemory(target)
+	return nil
+}
+
+// loadFragments 按重要性和更新时间获取AI伙伴的记忆，memoryType为空表示全部类型
+func (s *MemoryService) loadFragments(companionID int, memoryType string, limit int) ([]*models.MemoryFragment, error) {
+	query := `SELECT ` + memoryColumns + ` FROM memory_fragments mf WHERE mf.companion_id = ?`
+	args := []interface{}{companionID}
+	if memoryType != "" {
+		query += " AND mf.memory_type = ?"
+		args = append(args, memoryType)
+	}
+	query += " ORDER BY mf.importance_score DESC, mf.updated_at DESC, mf.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memories: %w", err)
+	}
+	defer rows.Close()
+
+	fragments := []*models.MemoryFragment{}
+	for rows.Next() {
+		fragment, err := scanMemoryFragment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan memory: %w", err)
+		}
+		fragments = append(fragments, fragment)
+	}
+	return fragments, nil
+}
+
+// scanMemoryFragment 扫描一行记忆片段
+func scanMemoryFragment(row rowScanner) (*models.MemoryFragment, error) {
+	var fragment models.MemoryFragment
+	var tags sql.NullString
+	err := row.Scan(
+		&fragment.ID, &fragment.CompanionID, &fragment.MemoryType, &fragment.Content,
+		&fragment.ImportanceScore, &tags, &fragment.MentionCount, &fragment.IsUserEdited,
+		&fragment.CreatedAt, &fragment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tags.Valid && tags.String != "" {
+		fragment.Tags = json.RawMessage(tags.String)
+	} else {
+		fragment.Tags = json.RawMessage("[]")
+	}
+	return &fragment, nil
+}
+
+// ListMemories 获取用户的AI伙伴记住的内容
+func (s *MemoryService) ListMemories(userID, companionID int, req models.MemoryListRequest) ([]*models.MemoryFragment, error) {
+	if err := companionOwnedBy(s.db, userID, companionID); err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultMemoryListLimit
+	}
+	return s.loadFragments(companionID, req.MemoryType, limit)
+}
+
+// getMemory 获取属于用户AI伙伴的一条记忆
+func (s *MemoryService) getMemory(userID, companionID, memoryID int) (*models.MemoryFragment, error) {
+	row := s.db.QueryRow(`
+		SELECT `+memoryColumns+`
+		FROM memory_fragments mf
+		JOIN ai_companions ac ON ac.id = mf.companion_id
+		WHERE mf.id = ? AND mf.companion_id = ? AND ac.user_id = ?
+	`, memoryID, companionID, userID)
+	fragment, err := scanMemoryFragment(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrMemoryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memory: %w", err)
+	}
+	return fragment, nil
+}
+
+// UpdateMemory 用户修正一条记忆，修正后自动提取只会合并重要性和标签，不再改写内容
+func (s *MemoryService) UpdateMemory(userID, companionID, memoryID int, req models.UpdateMemoryRequest) (*models.MemoryFragment, error) {
+	fragment, err := s.getMemory(userID, companionID, memoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.MemoryType != "" {
+		fragment.MemoryType = req.MemoryType
+	}
+	if content := strings.TrimSpace(req.Content); content != "" {
+		fragment.Content = truncateRunes(content, memoryMaxContentRunes)
+	}
+	if req.ImportanceScore > 0 {
+		fragment.ImportanceScore = clampImportance(req.ImportanceScore)
+	}
+	if req.Tags != nil {
+		fragment.Tags, _ = json.Marshal(normalizeTags(req.Tags))
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE memory_fragments
+		SET memory_type = ?, content = ?, importance_score = ?, tags = ?, is_user_edited = TRUE, updated_at = NOW()
+		WHERE id = ?
+	`, fragment.MemoryType, fragment.Content, fragment.ImportanceScore, string(fragment.Tags), memoryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update memory: %w", err)
+	}
+	s.indexMemory(fragment)
+	return s.getMemory(userID, companionID, memoryID)
+}
+
+// DeleteMemory 删除一条记忆，AI伙伴将不再记得
+func (s *MemoryService) DeleteMemory(userID, companionID, memoryID int) error {
+	result, err := s.db.Exec(`
+		DELETE mf FROM memory_fragments mf
+		JOIN ai_companions ac ON ac.id = mf.companion_id
+		WHERE mf.id = ? AND mf.companion_id = ? AND ac.user_id = ?
+	`, memoryID, companionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete memory: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrMemoryNotFound
+	}
+	if s.vectorIndex != nil {
+		if err := s.vectorIndex.Remove(VectorKindMemory, memoryID); err != nil {
+			log.Printf("删除记忆向量失败: memoryID=%d, err=%v", memoryID, err)
+		}
+	}
+	return nil
+}
+
+// clampImportance 把重要性限制在1-10，缺省为5
+func clampImportance(importance int) int {
+	switch {
+	case importance <= 0:
+		return 5
+	case importance > 10:
+		return 10
+	default:
+		return importance
+	}
+}
+
+// normalizeTags 去除空白和重复的标签，最多保留memoryMaxTags个
+func normalizeTags(tags []string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+		if len(result) == memoryMaxTags {
+			break
+		}
+	}
+	return result
+}
+
+// memorySimilarity 两条记忆内容的字符二元组Jaccard相似度，忽略标点和空白
+func memorySimilarity(a, b string) float64 {
+	ra, rb := normalizeMemoryText(a), normalizeMemoryText(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		if string(ra) == string(rb) {
+			return 1
+		}
+		return 0
+	}
+
+	bigrams := func(runes []rune) map[string]bool {
+		set := make(map[string]bool, len(runes))
+		for i := 0; i+1 < len(runes); i++ {
+			set[string(runes[i:i+2])] = true
+		}
+		return set
+	}
+	setA, setB := bigrams(ra), bigrams(rb)
+	shared := 0
+	for gram := range setA {
+		if setB[gram] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
+
+// normalizeMemoryText 只保留字母、数字和汉字并转为小写
+func normalizeMemoryText(text string) []rune {
+	var runes []rune
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
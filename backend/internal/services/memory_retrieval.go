@@ -0,0 +1,384 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"seven-ai-backend/internal/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultMemoryTopK          = 5    // 每次回复最多带上的记忆数
+	defaultMemoryTokenBudget   = 300  // 记忆占用的token上限
+	memoryCandidateLimit       = 200  // 参与打分的候选记忆数
+	memoryRecencyHalfLifeDays  = 30   // 新近程度的半衰期（天）
+	memoryMustRecallImportance = 9    // 与当前消息无关时也会带上的重要性下限
+	memoryMinRelevance         = 0.15 // 关键词相关度低于该值视为与当前消息无关
+	memoryMinSemantic          = 0.5  // 语义相似度达到该值时即使没有关键词命中也视为相关
+	memoryBM25Scale            = 3.0  // BM25原始得分按 1-e^(-x/scale) 映射到0-1，不随候选集变化
+
+	memoryRelevanceWeight  = 0.6
+	memoryImportanceWeight = 0.25
+	memoryRecencyWeight    = 0.15
+	memorySemanticWeight   = 0.5 // 配置了向量模型时，语义相似度在相关度中的占比
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SetVectorIndex 设置向量索引，未设置时只使用关键词检索
+func (s *MemoryService) SetVectorIndex(index *VectorIndex) {
+	s.vectorIndex = index
+}
+
+// SetRetrievalLimits 设置每次回复检索的记忆条数和token上限
+func (s *MemoryService) SetRetrievalLimits(topK, tokenBudget int) {
+	if topK > 0 {
+		s.topK = topK
+	}
+	if tokenBudget > 0 {
+		s.tokenBudget = tokenBudget
+	}
+}
+
+// RetrieveMemories 按与用户消息的相关度、重要性和新近程度给AI伙伴的记忆打分，
+// 返回token预算内得分最高的前k条
+func (s *MemoryService) RetrieveMemories(companionID int, query, model string) ([]models.RecalledMemory, error) {
+	candidates, err := s.loadFragments(companionID, "", memoryCandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	docs := make([][]string, len(candidates))
+	for i, fragment := range candidates {
+		var tags []string
+		_ = json.Unmarshal(fragment.Tags, &tags)
+		docs[i] = retrievalTokens(fragment.Content + " " + strings.Join(tags, " "))
+	}
+	keyword := absoluteScores(bm25Scores(retrievalTokens(query), docs))
+	relevance := append([]float64(nil), keyword...)
+
+	var semantic []float64
+	if s.vectorIndex != nil {
+		semantic, err = s.semanticScores(query, candidates)
+		if err != nil {
+			log.Printf("记忆语义检索失败，仅使用关键词检索: companionID=%d, err=%v", companionID, err)
+			semantic = nil
+		} else {
+			for i := range relevance {
+				relevance[i] = (1-memorySemanticWeight)*relevance[i] + memorySemanticWeight*semantic[i]
+			}
+		}
+	}
+
+	now := time.Now()
+	var scored []models.RecalledMemory
+	for i, fragment := range candidates {
+		related := keyword[i] >= memoryMinRelevance || (semantic != nil && semantic[i] >= memoryMinSemantic)
+		if !related && fragment.ImportanceScore < memoryMustRecallImportance {
+			continue
+		}
+		ageDays := math.Max(now.Sub(fragment.UpdatedAt).Hours()/24, 0)
+		m := models.RecalledMemory{
+			MemoryID:   fragment.ID,
+			MemoryType: fragment.MemoryType,
+			Content:    fragment.Content,
+			Relevance:  relevance[i],
+			Importance: float64(fragment.ImportanceScore) / 10,
+			Recency:    math.Pow(0.5, ageDays/memoryRecencyHalfLifeDays),
+		}
+		m.Score = memoryRelevanceWeight*m.Relevance + memoryImportanceWeight*m.Importance + memoryRecencyWeight*m.Recency
+		scored = append(scored, m)
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+
+	// 在token预算内依次放入，放不下的跳过
+	var result []models.RecalledMemory
+	used := 0
+	for _, m := range scored {
+		if len(result) == s.topK {
+			break
+		}
+		cost := CountTokens(model, m.Content) + 2
+		if used+cost > s.tokenBudget {
+			continue
+		}
+		used += cost
+		m.Rank = len(result) + 1
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// semanticScores 用户消息与每条候选记忆的余弦相似度，负值记为0
+// 只使用索引中已有的向量，尚未索引的记忆记为0，由新建记忆时的后台写入和回填任务补建
+func (s *MemoryService) semanticScores(query string, candidates []*models.MemoryFragment) ([]float64, error) {
+	queryVector, err := s.vectorIndex.EmbedQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, fragment := range candidates {
+		if vector, ok := s.vectorIndex.Vector(VectorKindMemory, fragment.ID); ok {
+			scores[i] = math.Max(cosineSimilarity(queryVector, vector), 0)
+		}
+	}
+	return scores, nil
+}
+
+// memoryVectorItem 记忆片段对应的向量索引条目
+func memoryVectorItem(fragment *models.MemoryFragment) VectorItem {
+	return VectorItem{Kind: VectorKindMemory, RefID: fragment.ID, OwnerID: fragment.CompanionID, Text: fragment.Content}
+}
+
+// indexMemory 记忆新建或修改后后台更新向量
+func (s *MemoryService) indexMemory(fragment *models.MemoryFragment) {
+	if s.vectorIndex != nil {
+		go s.vectorIndex.addInBackground(memoryVectorItem(fragment))
+	}
+}
+
+// recordUsage 记录生成某条回复时使用的记忆，重新生成时覆盖之前的记录
+func (s *MemoryService) recordUsage(conversationID int, memories []models.RecalledMemory) error {
+	if _, err := s.db.Exec(`DELETE FROM conversation_memories WHERE conversation_id = ?`, conversationID); err != nil {
+		return fmt.Errorf("failed to clear memory usage: %w", err)
+	}
+	for _, m := range memories {
+		_, err := s.db.Exec(`
+			INSERT INTO conversation_memories (
+				conversation_id, memory_id, memory_rank, memory_type, content,
+				relevance, importance, recency, score, created_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
+		`, conversationID, m.MemoryID, m.Rank, m.MemoryType, m.Content, m.Relevance, m.Importance, m.Recency, m.Score)
+		if err != nil {
+			return fmt.Errorf("failed to record memory usage: %w", err)
+		}
+	}
+	return nil
+}
+
+// recallMemories 为AI伙伴的回复检索相关记忆，预设角色或检索失败时返回空
+func (s *ConversationService) recallMemories(target models.ChatTarget, userMessage, model string) []models.RecalledMemory {
+	if !target.IsCompanion() || s.memoryService == nil {
+		return nil
+	}
+	memories, err := s.memoryService.RetrieveMemories(target.CompanionID, userMessage, model)
+	if err != nil {
+		log.Printf("检索记忆失败: companionID=%d, err=%v", target.CompanionID, err)
+		return nil
+	}
+	return memories
+}
+
+// extractMemories 后台从一轮AI伙伴对话中提取记忆（文字、图片和语音通话共用）
+func (s *ConversationService) extractMemories(userID, companionID int, userMessage, aiResponse string) {
+	if s.memoryService == nil || companionID == 0 {
+		return
+	}
+	go s.memoryService.extractInBackground(userID, companionID, userMessage, aiResponse)
+}
+
+// memoryPrompt 记忆在系统提示词中的段落，没有记忆时为空
+func memoryPrompt(memories []string) string {
+	if len(memories) == 0 {
+		return ""
+	}
+	lines := make([]string, len(memories))
+	for i, memory := range memories {
+		lines[i] = "- " + memory
+	}
+	return "\n\n你记得的关于用户的事：\n" + strings.Join(lines, "\n")
+}
+
+// recordMemoryUsage 记录回复使用的记忆，失败只记录日志
+func (s *ConversationService) recordMemoryUsage(messageID int, memories []models.RecalledMemory) {
+	if s.memoryService == nil {
+		return
+	}
+	if err := s.memoryService.recordUsage(messageID, memories); err != nil {
+		log.Printf("记录记忆使用失败: messageID=%d, err=%v", messageID, err)
+	}
+}
+
+// memoryContents 取出记忆内容，按检索顺序放入上下文
+func memoryContents(memories []models.RecalledMemory) []string {
+	contents := make([]string, 0, len(memories))
+	for _, m := range memories {
+		contents = append(contents, m.Content)
+	}
+	return contents
+}
+
+// GetMessageMemories 查看生成某条回复时使用了哪些记忆（用于调试检索效果）
+func (s *ConversationService) GetMessageMemories(userID, messageID int) (*models.MessageMemories, error) {
+	if _, err := s.getMessage(userID, messageID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT memory_id, memory_type, content, relevance, importance, recency, score, memory_rank
+		FROM conversation_memories
+		WHERE conversation_id = ?
+		ORDER BY memory_rank ASC
+	`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message memories: %w", err)
+	}
+	defer rows.Close()
+
+	result := &models.MessageMemories{MessageID: messageID, Memories: []models.RecalledMemory{}}
+	for rows.Next() {
+		var m models.RecalledMemory
+		if err := rows.Scan(&m.MemoryID, &m.MemoryType, &m.Content, &m.Relevance, &m.Importance, &m.Recency, &m.Score, &m.Rank); err != nil {
+			return nil, fmt.Errorf("failed to scan message memory: %w", err)
+		}
+		result.Memories = append(result.Memories, m)
+	}
+	return result, nil
+}
+
+// memoryTokens 检索用分词：汉字取单字和相邻二元组，字母和数字按词切分
+func memoryTokens(text string) []string {
+	var tokens []string
+	var han, word []rune
+	flushHan := func() {
+		for _, r := range han {
+			tokens = append(tokens, string(r))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			tokens = append(tokens, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+	return tokens
+}
+
+// retrievalStopwords 检索时忽略的常见虚词和代词
+var retrievalStopwords = map[string]bool{
+	"我们": true, "你们": true, "他们": true, "她们": true, "什么": true, "这个": true, "那个": true,
+	"一个": true, "就是": true, "还是": true, "可以": true, "没有": true, "自己": true, "觉得": true,
+	"现在": true, "然后": true, "因为": true, "所以": true, "但是": true, "怎么": true, "这样": true,
+	"the": true, "a": true, "an": true, "is": true, "are": true, "to": true, "of": true, "and": true,
+	"i": true, "you": true, "it": true, "in": true,
+}
+
+// retrievalTokens 关键词检索用分词：在memoryTokens基础上去掉汉字单字和停用词，
+// 避免“的”“了”这类单字让无关记忆被召回
+func retrievalTokens(text string) []string {
+	var tokens []string
+	for _, token := range memoryTokens(text) {
+		runes := []rune(token)
+		if len(runes) == 1 && unicode.Is(unicode.Han, runes[0]) {
+			continue
+		}
+		if retrievalStopwords[token] {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// bm25Scores 计算查询对每篇文档的BM25得分
+func bm25Scores(query []string, docs [][]string) []float64 {
+	scores := make([]float64, len(docs))
+	if len(query) == 0 || len(docs) == 0 {
+		return scores
+	}
+
+	totalLen := 0
+	termFreqs := make([]map[string]int, len(docs))
+	docFreq := map[string]int{}
+	for i, doc := range docs {
+		totalLen += len(doc)
+		termFreqs[i] = map[string]int{}
+		for _, term := range doc {
+			termFreqs[i][term]++
+		}
+		for term := range termFreqs[i] {
+			docFreq[term]++
+		}
+	}
+	avgLen := float64(totalLen) / float64(len(docs))
+	if avgLen == 0 {
+		return scores
+	}
+
+	seen := map[string]bool{}
+	n := float64(len(docs))
+	for _, term := range query {
+		if seen[term] || docFreq[term] == 0 {
+			continue
+		}
+		seen[term] = true
+		df := float64(docFreq[term])
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i := range docs {
+			tf := float64(termFreqs[i][term])
+			if tf == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(len(docs[i]))/avgLen
+			scores[i] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return scores
+}
+
+// absoluteScores 把BM25原始得分映射到0-1，映射不依赖同批候选的最高分，
+// 只有真正命中较少见的词才会得到较高的相关度
+func absoluteScores(scores []float64) []float64 {
+	for i := range scores {
+		scores[i] = 1 - math.Exp(-scores[i]/memoryBM25Scale)
+	}
+	return scores
+}
+
+// cosineSimilarity 两个向量的余弦相似度，维度不同或为零向量时返回0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		normA += x * x
+		normB += y * y
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"scaled", []float32{1, 2}, []float32{2, 4}, 1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"opposite", []float32{1, 0}, []float32{-1, 0}, -1},
+		{"diagonal", []float32{1, 0}, []float32{1, 1}, 1 / math.Sqrt2},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+		{"different dims", []float32{1, 0}, []float32{1, 0, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := cosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: cosineSimilarity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBM25Scores(t *testing.T) {
+	docs := [][]string{
+		retrievalTokens("用户喜欢喝咖啡"),
+		retrievalTokens("用户养了一只猫"),
+		retrievalTokens("用户每天早上都喝咖啡，周末也喝咖啡"),
+		{},
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		check func([]float64) bool
+	}{
+		{"no query terms", "", func(s []float64) bool { return allZero(s) }},
+		{"no match", "爬山", func(s []float64) bool { return allZero(s) }},
+		{"single match", "猫", func(s []float64) bool { return allZero(s) }}, // 单字不参与检索
+		{"match ranks matching docs", "一只猫", func(s []float64) bool { return s[1] > 0 && s[0] == 0 && s[2] == 0 && s[3] == 0 }},
+		{"more occurrences score higher", "咖啡", func(s []float64) bool { return s[2] > s[0] && s[0] > 0 && s[1] == 0 }},
+		{"rarer term outweighs common term", "用户 养了", func(s []float64) bool { return s[1] > s[0] && s[1] > s[2] }},
+	}
+	for _, tt := range tests {
+		scores := bm25Scores(retrievalTokens(tt.query), docs)
+		if len(scores) != len(docs) {
+			t.Fatalf("%s: %d scores for %d docs", tt.name, len(scores), len(docs))
+		}
+		if !tt.check(scores) {
+			t.Errorf("%s: unexpected scores %v", tt.name, scores)
+		}
+	}
+
+	if scores := bm25Scores([]string{"咖啡"}, nil); len(scores) != 0 {
+		t.Errorf("no docs: scores = %v, want empty", scores)
+	}
+}
+
+func allZero(scores []float64) bool {
+	for _, s := range scores {
+		if s != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"time"
+)
+
+// ErrMessageNotFound 消息不存在、已删除或不属于当前用户
+var ErrMessageNotFound = errors.New("消息不存在")
+
+// ErrMessageNotEditable 消息不支持编辑或重新生成
+var ErrMessageNotEditable = errors.New("该消息不支持编辑或重新生成")
+
+// storedMessage 数据库中的一条对话记录
+type storedMessage struct {
+	ID              int
+	Target          models.ChatTarget
+	SessionID       string
+	MessageType     string
+	UserMessage     string
+	AIResponse      string
+	SelectedReplyID sql.NullInt64
+	EditedAt        sql.NullTime
+	CreatedAt       time.Time
+}
+
+// getMessage 获取用户未删除的一条消息
+func (s *ConversationService) getMessage(userID, messageID int) (*storedMessage, error) {
+	var msg storedMessage
+	var characterID, companionID sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT id, character_id, companion_id, session_id, message_type, COALESCE(user_message, ''),
+		       COALESCE(ai_response, ''), selected_reply_id, edited_at, created_at
+		FROM conversations
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, messageID, userID).Scan(
+		&msg.ID, &characterID, &companionID, &msg.SessionID, &msg.MessageType, &msg.UserMessage,
+		&msg.AIResponse, &msg.SelectedReplyID, &msg.EditedAt, &msg.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message: %w", err)
+	}
+	msg.Target = scanTarget(characterID, companionID)
+	return &msg, nil
+}
+
+// RegenerateReply 重新生成AI回复，之前的回复保留为可切换的候选
+func (s *ConversationService) RegenerateReply(userID, messageID int) (*models.MessageAlternatives, error) {
+	msg, err := s.getMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.MessageType == "image" || !msg.Target.Valid() {
+		return nil, ErrMessageNotEditable
+	}
+
+	if err := s.regenerateAndSelect(userID, msg, msg.UserMessage, false); err != nil {
+		return nil, err
+	}
+	return s.GetMessageAlternatives(userID, messageID)
+}
+
+// EditMessage 编辑用户消息并重新生成回复
+func (s *ConversationService) EditMessage(userID, messageID int, req models.EditMessageRequest) (*models.MessageAlternatives, error) {
+	msg, err := s.getMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.MessageType == "image" || !msg.Target.Valid() {
+		return nil, ErrMessageNotEditable
+	}
+
+	text := strings.TrimSpace(req.Message)
+	if text == "" {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+
+	// 先生成新回复再写入编辑，生成失败时原消息和回复保持不变
+	if err := s.regenerateAndSelect(userID, msg, text, true); err != nil {
+		return nil, err
+	}
+	return s.GetMessageAlternatives(userID, messageID)
+}
+
+// regenerateAndSelect 生成新回复，再在一个事务中写入编辑后的消息（edited为true时）、
+// 候选回复和当前回复的选择；回复变化后滚动摘要随之失效
+func (s *ConversationService) regenerateAndSelect(userID int, msg *storedMessage, userMessage string, edited bool) error {
+	response, memories, err := s.generateReplyAt(userID, msg, userMessage)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 生成期间可能有并发的重新生成，锁定后重新读取当前回复
+	current, err := lockMessageReply(tx, userID, msg.ID)
+	if err != nil {
+		return err
+	}
+
+	if edited {
+		if _, err := tx.Exec(`
+			UPDATE conversations SET user_message = ?, edited_at = NOW() WHERE id = ?
+		`, userMessage, msg.ID); err != nil {
+			return fmt.Errorf("failed to edit message: %w", err)
+		}
+	}
+	if err := invalidateSummary(tx, userID, msg.Target, msg.ID); err != nil {
+		return err
+	}
+
+	// 第一次重新生成时，把原始回复也存为候选
+	if !current.SelectedReplyID.Valid && current.AIResponse != "" {
+		if _, err := tx.Exec(`
+			INSERT INTO conversation_replies (conversation_id, ai_response, created_at)
+			VALUES (?, ?, ?)
+		`, msg.ID, current.AIResponse, msg.CreatedAt); err != nil {
+			return fmt.Errorf("failed to save original reply: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO conversation_replies (conversation_id, ai_response, created_at)
+		VALUES (?, ?, NOW())
+	`, msg.ID, response)
+	if err != nil {
+		return fmt.Errorf("failed to save regenerated reply: %w", err)
+	}
+	replyID, _ := result.LastInsertId()
+
+	if _, err := tx.Exec(`
+		UPDATE conversations SET ai_response = ?, selected_reply_id = ? WHERE id = ?
+	`, response, replyID, msg.ID); err != nil {
+		return fmt.Errorf("failed to select regenerated reply: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if msg.Target.IsCompanion() {
+		s.recordMemoryUsage(msg.ID, memories)
+	}
+	return nil
+}
+
+// lockMessageReply 在事务中锁定消息并读取当前回复和选中的候选
+func lockMessageReply(tx *sql.Tx, userID, messageID int) (*storedMessage, error) {
+	msg := &storedMessage{ID: messageID}
+	err := tx.QueryRow(`
+		SELECT COALESCE(ai_response, ''), selected_reply_id FROM conversations
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+		FOR UPDATE
+	`, messageID, userID).Scan(&msg.AIResponse, &msg.SelectedReplyID)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock message: %w", err)
+	}
+	return msg, nil
+}
+
+// generateReplyAt 以该消息之前的对话为上下文生成回复，同时返回使用的记忆
+func (s *ConversationService) generateReplyAt(userID int, msg *storedMessage, userMessage string) (string, []models.RecalledMemory, error) {
+	character, err := s.getTargetPersona(userID, msg.Target, userMessage)
+	if err != nil {
+		return "", nil, err
+	}
+
+	chatModel := "qwen3-max"
+	memories := s.recallMemories(msg.Target, userMessage, chatModel)
+	messages, err := s.assembleContext(contextRequest{
+		UserID:         userID,
+		Target:         msg.Target,
+		Model:          chatModel,
+		SystemPrompt:   s.buildCharacterSystemPrompt(character, nil),
+		Memories:       memoryContents(memories),
+		CurrentMessage: userMessage,
+		BeforeID:       msg.ID,
+		BeforeTime:     msg.CreatedAt,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to build context: %w", err)
+	}
+
+	// 重新生成时提高温度，让新回复与之前有所不同
+	response, err := s.aiService.ChatWithLLM(messages, chatModel, 0.95, "text")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get AI response: %w", err)
+	}
+	return trimCharacterPrefix(character.Name, response), memories, nil
+}
+
+// GetMessageAlternatives 获取一条消息的全部AI回复候选
+func (s *ConversationService) GetMessageAlternatives(userID, messageID int) (*models.MessageAlternatives, error) {
+	msg, err := s.getMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.MessageAlternatives{
+		MessageID:    msg.ID,
+		UserMessage:  msg.UserMessage,
+		AIResponse:   msg.AIResponse,
+		Alternatives: []models.ConversationReply{},
+	}
+	if msg.EditedAt.Valid {
+		result.EditedAt = &msg.EditedAt.Time
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, conversation_id, ai_response, created_at
+		FROM conversation_replies
+		WHERE conversation_id = ?
+		ORDER BY id ASC
+	`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query replies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reply models.ConversationReply
+		if err := rows.Scan(&reply.ID, &reply.ConversationID, &reply.AIResponse, &reply.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reply: %w", err)
+		}
+		reply.IsSelected = msg.SelectedReplyID.Valid && int64(reply.ID) == msg.SelectedReplyID.Int64
+		if reply.IsSelected {
+			result.SelectedReplyID = reply.ID
+		}
+		result.Alternatives = append(result.Alternatives, reply)
+	}
+
+	// 从未重新生成过的消息，当前回复即唯一候选
+	if len(result.Alternatives) == 0 {
+		result.Alternatives = append(result.Alternatives, models.ConversationReply{
+			ConversationID: msg.ID,
+			AIResponse:     msg.AIResponse,
+			IsSelected:     true,
+			CreatedAt:      msg.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+// SelectReply 切换到指定的AI回复候选，回复变化后滚动摘要随之失效
+func (s *ConversationService) SelectReply(userID, messageID, replyID int) (*models.MessageAlternatives, error) {
+	msg, err := s.getMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockMessageReply(tx, userID, messageID); err != nil {
+		return nil, err
+	}
+
+	var response string
+	err = tx.QueryRow(`
+		SELECT ai_response FROM conversation_replies WHERE id = ? AND conversation_id = ?
+	`, replyID, messageID).Scan(&response)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reply: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE conversations SET ai_response = ?, selected_reply_id = ? WHERE id = ?
+	`, response, replyID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select reply: %w", err)
+	}
+	if err := invalidateSummary(tx, userID, msg.Target, messageID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetMessageAlternatives(userID, messageID)
+}
+
+// DeleteMessage 软删除消息，使其不再出现在聊天记录、对话上下文和滚动摘要中
+func (s *ConversationService) DeleteMessage(userID, messageID int) error {
+	msg, err := s.getMessage(userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE conversations SET deleted_at = NOW()
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`, messageID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrMessageNotFound
+	}
+	if err := invalidateSummary(tx, userID, msg.Target, msg.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.removeConversationVectors([]int{messageID})
+	return nil
+}
+
+// removeConversationVectors 从语义搜索索引中移除已删除的对话，失败时由回填任务清理
+func (s *ConversationService) removeConversationVectors(ids []int) {
+	if s.vectorIndex == nil {
+		return
+	}
+	for _, id := range ids {
+		if err := s.vectorIndex.Remove(VectorKindConversation, id); err != nil {
+			log.Printf("删除对话向量失败: messageID=%d, err=%v", id, err)
+		}
+	}
+}
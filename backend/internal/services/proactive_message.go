@@ -0,0 +1,414 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/models"
+	"strings"
+	"time"
+)
+
+// 主动消息类型
+const (
+	ProactiveMorningGreeting = "morning_greeting" // 早安问候
+	ProactiveFollowUp        = "follow_up"        // 跟进用户之前提到的事
+	ProactiveCheckIn         = "check_in"         // 长时间未聊天后的问候
+)
+
+const (
+	defaultUserTimezone   = "Asia/Shanghai"
+	morningGreetingStart  = 7                  // 早安问候开始时间（用户本地小时）
+	morningGreetingEnd    = 10                 // 早安问候结束时间（用户本地小时）
+	greetingActiveWithin  = 7 * 24 * time.Hour // 只给最近一周聊过天的用户发早安
+	followUpMinAge        = 12 * time.Hour     // 用户提到的事至少过去这么久才跟进
+	followUpMaxAge        = 48 * time.Hour     // 超过这个时间不再跟进
+	maxUnansweredMessages = 1                  // 用户未回复时最多连续主动发几条
+)
+
+// followUpKeywords 值得事后跟进的话题关键词
+var followUpKeywords = []string{
+	"明天", "后天", "下周", "考试", "面试", "约会", "生病", "感冒", "发烧", "医院",
+	"体检", "出差", "旅行", "比赛", "答辩", "搬家", "加班", "开会", "汇报",
+}
+
+// ProactiveLimits 主动消息的频率限制
+type ProactiveLimits struct {
+	MaxPerCharacterPerDay int           // 每个角色每天最多主动发几条
+	MaxPerUserPerDay      int           // 每个用户每天最多收到几条
+	InactivityThreshold   time.Duration // 用户多久未聊天后发送问候
+}
+
+// ProactiveMessageService 角色主动消息调度器
+type ProactiveMessageService struct {
+	db                  *sql.DB
+	aiService           *AIService
+	conversationService *ConversationService
+	limits              ProactiveLimits
+}
+
+// proactiveCandidate 可能收到主动消息的用户和角色（或AI伙伴）
+type proactiveCandidate struct {
+	userID          int
+	target          models.ChatTarget
+	quietHoursStart int
+	quietHoursEnd   int
+	timezone        string
+	lastActiveAt    time.Time
+}
+
+// NewProactiveMessageService 创建主动消息调度器
+func NewProactiveMessageService(db *sql.DB, aiService *AIService, conversationService *ConversationService) *ProactiveMessageService {
+	return &ProactiveMessageService{
+		db:                  db,
+		aiService:           aiService,
+		conversationService: conversationService,
+		limits: ProactiveLimits{
+			MaxPerCharacterPerDay: 1,
+			MaxPerUserPerDay:      3,
+			InactivityThreshold:   48 * time.Hour,
+		},
+	}
+}
+
+// SetLimits 设置频率限制
+func (s *ProactiveMessageService) SetLimits(limits ProactiveLimits) {
+	s.limits = limits
+}
+
+// Start 启动后台调度，定期检查并发送主动消息
+func (s *ProactiveMessageService) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := s.runOnce(time.Now()); err != nil {
+				log.Printf("主动消息调度失败: %v", err)
+			}
+		}
+	}()
+}
+
+// runOnce 检查所有候选用户和角色，按需发送一条主动消息
+func (s *ProactiveMessageService) runOnce(now time.Time) error {
+	candidates, err := s.listCandidates()
+	if err != nil {
+		return err
+	}
+
+	sentToday := map[int]int{}     // 本轮之前用户24小时内收到的数量
+	greetedToday := map[int]bool{} // 用户今天是否已收到早安
+	sent := 0
+	for _, c := range candidates {
+		loc, err := time.LoadLocation(c.timezone)
+		if err != nil {
+			loc, _ = time.LoadLocation(defaultUserTimezone)
+		}
+		localNow := now.In(loc)
+		if inQuietHours(localNow.Hour(), c.quietHoursStart, c.quietHoursEnd) {
+			continue
+		}
+
+		if _, ok := sentToday[c.userID]; !ok {
+			count, greeted, err := s.userProactiveStats(c.userID, now, localNow)
+			if err != nil {
+				log.Printf("查询用户主动消息统计失败: userID=%d, err=%v", c.userID, err)
+				continue
+			}
+			sentToday[c.userID] = count
+			greetedToday[c.userID] = greeted
+		}
+		if sentToday[c.userID] >= s.limits.MaxPerUserPerDay {
+			continue
+		}
+
+		kind, sourceID, hint, err := s.decide(c, now, localNow, greetedToday[c.userID])
+		if err != nil {
+			log.Printf("判断主动消息失败: userID=%d, target=%+v, err=%v", c.userID, c.target, err)
+			continue
+		}
+		if kind == "" {
+			continue
+		}
+
+		_, err = s.send(c.userID, c.target, kind, sourceID, hint)
+		if err != nil {
+			log.Printf("发送主动消息失败: userID=%d, target=%+v, kind=%s, err=%v", c.userID, c.target, kind, err)
+			continue
+		}
+		sentToday[c.userID]++
+		if kind == ProactiveMorningGreeting {
+			greetedToday[c.userID] = true
+		}
+		sent++
+	}
+
+	if sent > 0 {
+		log.Printf("已发送主动消息: %d条", sent)
+	}
+	return nil
+}
+
+// listCandidates 获取开启了通知的用户及其好友角色和AI伙伴，最近聊过的排在前面
+func (s *ProactiveMessageService) listCandidates() ([]proactiveCandidate, error) {
+	rows, err := s.db.Query(`
+		SELECT t.user_id, t.character_id, t.companion_id,
+		       COALESCE(p.quiet_hours_start, 22), COALESCE(p.quiet_hours_end, 8),
+		       COALESCE(p.timezone, ?),
+		       COALESCE((SELECT MAX(c.created_at) FROM conversations c
+		                 WHERE c.user_id = t.user_id
+		                   AND (c.character_id = t.character_id OR c.companion_id = t.companion_id)
+		                   AND c.deleted_at IS NULL), '1970-01-01 00:00:00') AS last_active_at
+		FROM (
+			SELECT user_id, character_id, NULL AS companion_id FROM user_friendships WHERE is_active = TRUE
+			UNION ALL
+			SELECT user_id, NULL, id FROM ai_companions WHERE archived_at IS NULL
+		) t
+		LEFT JOIN user_preferences p ON p.user_id = t.user_id
+		WHERE COALESCE(p.notification_enabled, TRUE) = TRUE
+		ORDER BY t.user_id, last_active_at DESC
+	`, defaultUserTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proactive candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []proactiveCandidate
+	for rows.Next() {
+		var c proactiveCandidate
+		var characterID, companionID sql.NullInt64
+		if err := rows.Scan(&c.userID, &characterID, &companionID, &c.quietHoursStart, &c.quietHoursEnd, &c.timezone, &c.lastActiveAt); err != nil {
+			return nil, fmt.Errorf("failed to scan proactive candidate: %w", err)
+		}
+		c.target = scanTarget(characterID, companionID)
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// userProactiveStats 用户24小时内收到的主动消息数，以及本地今天是否已收到早安
+func (s *ProactiveMessageService) userProactiveStats(userID int, now, localNow time.Time) (int, bool, error) {
+	localMidnight := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, localNow.Location())
+	var count, greetings int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(kind = ? AND created_at >= ?), 0)
+		FROM proactive_messages
+		WHERE user_id = ? AND created_at >= ?
+	`, ProactiveMorningGreeting, localMidnight, userID, now.Add(-24*time.Hour)).Scan(&count, &greetings)
+	if err != nil {
+		return 0, false, err
+	}
+	return count, greetings > 0, nil
+}
+
+// decide 判断该角色此时应发送哪种主动消息，不需要发送时返回空
+func (s *ProactiveMessageService) decide(c proactiveCandidate, now, localNow time.Time, greetedToday bool) (string, int, string, error) {
+	filter, value := targetFilter("", c.target)
+
+	// 角色每日上限
+	var characterCount int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM proactive_messages
+		WHERE user_id = ? AND `+filter+` AND created_at >= ?
+	`, c.userID, value, now.Add(-24*time.Hour)).Scan(&characterCount)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if characterCount >= s.limits.MaxPerCharacterPerDay {
+		return "", 0, "", nil
+	}
+
+	// 用户最后一次发言时间，从未聊过天的不主动打扰
+	var lastUserAt sql.NullTime
+	err = s.db.QueryRow(`
+		SELECT MAX(created_at) FROM conversations
+		WHERE user_id = ? AND `+filter+` AND deleted_at IS NULL
+		  AND is_ai_initiated = FALSE AND user_message <> ''
+	`, c.userID, value).Scan(&lastUserAt)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if !lastUserAt.Valid {
+		return "", 0, "", nil
+	}
+
+	// 用户还没回复之前的主动消息时不再追发
+	var unanswered int
+	err = s.db.QueryRow(`
+		SELECT COUNT(*) FROM conversations
+		WHERE user_id = ? AND `+filter+` AND deleted_at IS NULL
+		  AND is_ai_initiated = TRUE AND created_at > ?
+	`, c.userID, value, lastUserAt.Time).Scan(&unanswered)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if unanswered >= maxUnansweredMessages {
+		return "", 0, "", nil
+	}
+
+	// 跟进用户前一两天提到的事
+	sourceID, topic, err := s.findFollowUpTopic(c.userID, c.target, now)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if sourceID > 0 {
+		return ProactiveFollowUp, sourceID, topic, nil
+	}
+
+	// 早安问候：每个用户每天只发一条，发给最近聊过的角色
+	hour := localNow.Hour()
+	if !greetedToday && hour >= morningGreetingStart && hour < morningGreetingEnd && now.Sub(lastUserAt.Time) < greetingActiveWithin {
+		return ProactiveMorningGreeting, 0, "", nil
+	}
+
+	// 长时间未聊天
+	if now.Sub(c.lastActiveAt) >= s.limits.InactivityThreshold {
+		return ProactiveCheckIn, 0, "", nil
+	}
+
+	return "", 0, "", nil
+}
+
+// findFollowUpTopic 查找用户之前提到、值得跟进且尚未跟进过的消息
+func (s *ProactiveMessageService) findFollowUpTopic(userID int, target models.ChatTarget, now time.Time) (int, string, error) {
+	filter, value := targetFilter("c", target)
+	rows, err := s.db.Query(`
+		SELECT c.id, c.user_message FROM conversations c
+		WHERE c.user_id = ? AND `+filter+` AND c.deleted_at IS NULL
+		  AND c.is_ai_initiated = FALSE AND c.user_message <> ''
+		  AND c.created_at BETWEEN ? AND ?
+		  AND NOT EXISTS (SELECT 1 FROM proactive_messages pm WHERE pm.source_conversation_id = c.id)
+		ORDER BY c.created_at DESC
+		LIMIT 20
+	`, userID, value, now.Add(-followUpMaxAge), now.Add(-followUpMinAge))
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var message string
+		if err := rows.Scan(&id, &message); err != nil {
+			return 0, "", err
+		}
+		for _, keyword := range followUpKeywords {
+			if strings.Contains(message, keyword) {
+				return id, message, nil
+			}
+		}
+	}
+	return 0, "", nil
+}
+
+// send 生成并保存一条主动消息，返回消息ID
+func (s *ProactiveMessageService) send(userID int, target models.ChatTarget, kind string, sourceID int, hint string) (int, error) {
+	cs := s.conversationService
+	character, err := cs.getTargetPersona(userID, target, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get persona: %w", err)
+	}
+
+	var instruction string
+	switch kind {
+	case ProactiveMorningGreeting:
+		instruction = "（现在是早上，请你主动给用户发一句早安问候，可以结合你们最近聊过的内容。）"
+	case ProactiveFollowUp:
+		instruction = fmt.Sprintf("（用户之前说过：“%s”。请你主动发消息关心一下这件事后来怎么样了。）", hint)
+	default:
+		instruction = "（用户已经有一段时间没有来找你聊天了，请你主动发一条消息问候，表达想念但不要让用户有压力。）"
+	}
+	instruction += "（要求：符合角色性格，简短自然，不超过50字，直接输出消息内容。）"
+
+	lastMessageTime, err := cs.getLastMessageTime(userID, target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last message time: %w", err)
+	}
+
+	chatModel := "qwen3-max"
+	messages, err := cs.assembleContext(contextRequest{
+		UserID:         userID,
+		Target:         target,
+		Model:          chatModel,
+		SystemPrompt:   cs.buildCharacterSystemPrompt(character, lastMessageTime),
+		CurrentMessage: instruction,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to build context: %w", err)
+	}
+
+	response, err := s.aiService.ChatWithLLM(messages, chatModel, 0.8, "text")
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate proactive message: %w", err)
+	}
+	response = trimCharacterPrefix(character.Name, response)
+	if response == "" {
+		return 0, fmt.Errorf("empty proactive message")
+	}
+
+	session, err := cs.resolveChatSession(userID, target, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve chat session: %w", err)
+	}
+
+	characterID, companionID := targetColumns(target)
+	result, err := s.db.Exec(`
+		INSERT INTO conversations
+		(user_id, character_id, companion_id, session_id, message_type, user_message, ai_response, is_ai_initiated, created_at)
+		VALUES (?, ?, ?, ?, 'text', '', ?, true, NOW())
+	`, userID, characterID, companionID, session.ID, response)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save proactive message: %w", err)
+	}
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	cs.touchSession(session.ID)
+
+	var source interface{}
+	if sourceID > 0 {
+		source = sourceID
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO proactive_messages (user_id, character_id, companion_id, conversation_id, kind, source_conversation_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+	`, userID, characterID, companionID, messageID, kind, source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record proactive message: %w", err)
+	}
+
+	// 更新好友关系的最后消息时间
+	if !target.IsCompanion() {
+		_, err = s.db.Exec(`
+			UPDATE user_friendships
+			SET last_message_at = NOW(), updated_at = NOW()
+			WHERE user_id = ? AND character_id = ?
+		`, userID, target.CharacterID)
+		if err != nil {
+			log.Printf("更新好友关系失败: %v", err)
+		}
+	}
+
+	cs.publishMessageCreated(userID, MessageCreatedEvent{
+		ChatTarget:    target,
+		MessageID:     int(messageID),
+		SessionID:     session.ID,
+		AIResponse:    response,
+		IsAIInitiated: true,
+		Kind:          kind,
+	})
+
+	return int(messageID), nil
+}
+
+// inQuietHours 判断本地小时是否处于免打扰时段，支持跨午夜（如22点到8点）
+func inQuietHours(hour, start, end int) bool {
+	if start == end {
+		return false
+	}
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
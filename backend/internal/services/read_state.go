@@ -0,0 +1,90 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"seven-ai-backend/internal/models"
+)
+
+// ErrInvalidReadTarget 未指定要标记已读的角色、AI伙伴或会话
+var ErrInvalidReadTarget = errors.New("需要指定角色、AI伙伴或会话")
+
+// MarkAsRead 将角色、AI伙伴或会话中的未读消息标记为已读，可只标记到指定消息为止
+func (s *ConversationService) MarkAsRead(userID int, req models.MarkReadRequest) (*models.MarkReadResult, error) {
+	filter := "user_id = ? AND is_read = FALSE AND deleted_at IS NULL"
+	args := []interface{}{userID}
+
+	target := req.ChatTarget
+	switch {
+	case req.SessionID != "":
+		session, err := s.GetSession(userID, req.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		target = sessionTarget(session)
+		filter += " AND session_id = ?"
+		args = append(args, session.ID)
+	case target.Valid():
+		targetCond, value := targetFilter("", target)
+		filter += " AND " + targetCond
+		args = append(args, value)
+	default:
+		return nil, ErrInvalidReadTarget
+	}
+	if req.UpToMessageID > 0 {
+		filter += " AND id <= ?"
+		args = append(args, req.UpToMessageID)
+	}
+
+	result, err := s.db.Exec("UPDATE conversations SET is_read = TRUE WHERE "+filter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark messages read: %w", err)
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	var unread int
+	targetCond, value := targetFilter("", target)
+	err = s.db.QueryRow(`
+		SELECT COUNT(*) FROM conversations
+		WHERE user_id = ? AND `+targetCond+` AND is_read = FALSE AND deleted_at IS NULL
+	`, userID, value).Scan(&unread)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+
+	return &models.MarkReadResult{
+		ChatTarget: target,
+		Marked:     int(marked),
+		Unread:     unread,
+	}, nil
+}
+
+// GetUnreadCounts 获取每个角色和AI伙伴的未读消息数及总数
+func (s *ConversationService) GetUnreadCounts(userID int) (*models.UnreadSummary, error) {
+	rows, err := s.db.Query(`
+		SELECT character_id, companion_id, COUNT(*) FROM conversations
+		WHERE user_id = ? AND is_read = FALSE AND deleted_at IS NULL
+		GROUP BY character_id, companion_id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unread counts: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &models.UnreadSummary{Characters: []models.UnreadCount{}}
+	for rows.Next() {
+		var count models.UnreadCount
+		var characterID, companionID sql.NullInt64
+		if err := rows.Scan(&characterID, &companionID, &count.Unread); err != nil {
+			return nil, fmt.Errorf("failed to scan unread count: %w", err)
+		}
+		count.ChatTarget = scanTarget(characterID, companionID)
+		summary.Total += count.Unread
+		summary.Characters = append(summary.Characters, count)
+	}
+	return summary, nil
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"seven-ai-backend/internal/models"
+	"seven-ai-backend/internal/storage"
 	"sync"
 	"time"
 
@@ -212,44 +213,92 @@ type Character struct {
 // StreamingVoiceCallService 流式语音通话服务
 type StreamingVoiceCallService struct {
 	aiService *AIService
-	asrClient *RealtimeASRClient
-	db        *sql.DB
-	mu        sync.RWMutex
-	sessions  map[string]*VoiceCallSession
+	// AI伙伴的成长提示词和成长数据更新复用对话服务
+	conversationService *ConversationService
+	asrClient           *RealtimeASRClient
+	db                  *sql.DB
+	recordingStore      storage.FileStore // 通话录音存储（不对外公开）
+	mu                  sync.RWMutex
+	sessions            map[string]*VoiceCallSession
 	// 添加WebSocket连接通知回调
 	onConnectionError func(sessionID string, err error)
 	// 添加AI回复回调
 	onResponseCallback func(sessionID, userText, aiText string, audioData []byte)
+	// 会话结束回调
+	onSessionClosed func(sessionID string)
+	// 断线重连宽限期
+	resumeGrace time.Duration
 }
 
 // VoiceCallSession 语音通话会话
 type VoiceCallSession struct {
 	ID           string
 	UserID       int64
-	CharacterID  int64
+	CharacterID  int64 // 预设角色ID，与AI伙伴通话时为0
+	CompanionID  int64 // 与AI伙伴通话时为ai_companions.id，否则为0
 	ASRClient    *RealtimeASRClient
 	IsActive     bool
 	LastText     string
 	TextOffset   int
 	SilenceTimer *time.Timer
 	AudioBuffer  []byte // 添加音频缓冲区
-	mu           sync.RWMutex
+	// 通话记录
+	CallID         int64         // voice_calls表中的记录ID
+	StartedAt      time.Time     // 发起时间
+	AnsweredAt     *time.Time    // 接通时间（用户第一次说话）
+	EndedAt        *time.Time    // 结束时间
+	LastActivityAt time.Time     // 最近一次收到音频的时间
+	Recorder       *CallRecorder // 通话录音器，用户同意录音时才创建
+	// 断线重连
+	ResumeToken    string      // 重连令牌，在call_started中下发
+	DisconnectedAt *time.Time  // WebSocket断开时间，重连后清空
+	graceTimer     *time.Timer // 宽限期计时器
+	mu             sync.RWMutex
+}
+
+// defaultRecordingRetentionDays 用户未设置时通话录音的默认保留天数
+const defaultRecordingRetentionDays = 30
+
+// chatTarget 通话对象对应的聊天对象
+func (session *VoiceCallSession) chatTarget() models.ChatTarget {
+	if session.CompanionID != 0 {
+		return models.ChatTarget{CompanionID: int(session.CompanionID)}
+	}
+	return models.ChatTarget{CharacterID: int(session.CharacterID)}
+}
+
+// CallPersona 通话对象，可以是预设角色或用户的AI伙伴
+type CallPersona struct {
+	CharacterID  int64 // 预设角色ID，AI伙伴为0
+	CompanionID  int64 // AI伙伴ID，预设角色为0
+	Name         string
+	SystemPrompt string          // 系统提示词，AI伙伴为成长阶段提示词
+	Voice        TTSVoiceProfile // TTS音色
+}
+
+// IsCompanion 是否为AI伙伴
+func (p *CallPersona) IsCompanion() bool {
+	return p.CompanionID != 0
 }
 
 // StreamingVoiceCallRequest 流式语音通话请求
 type StreamingVoiceCallRequest struct {
-	UserID      int64  `json:"user_id"`
-	CharacterID int64  `json:"character_id"`
-	SessionID   string `json:"session_id"`
+	UserID        int64  `json:"user_id"`
+	CharacterID   int64  `json:"character_id"`
+	CompanionID   int64  `json:"companion_id"` // 与AI伙伴通话时指定，此时character_id为0
+	SessionID     string `json:"session_id"`
+	RecordConsent bool   `json:"record_consent"` // 用户是否同意录音
 }
 
 // StreamingVoiceCallResponse 流式语音通话响应
 type StreamingVoiceCallResponse struct {
 	SessionID     string `json:"session_id"`
+	ResumeToken   string `json:"resume_token,omitempty"`
 	UserText      string `json:"user_text"`
 	TextResponse  string `json:"text_response"`
 	AudioResponse string `json:"audio_response"`
 	IsComplete    bool   `json:"is_complete"`
+	IsRecording   bool   `json:"is_recording"`
 	Error         string `json:"error,omitempty"`
 }
 
@@ -262,21 +311,35 @@ func NewStreamingVoiceCallService(aiService *AIService, db *sql.DB) *StreamingVo
 	}
 }
 
+// SetRecordingStore 设置通话录音存储，该存储不应注册为静态文件目录
+func (s *StreamingVoiceCallService) SetRecordingStore(store storage.FileStore) {
+	s.recordingStore = store
+}
+
+// SetConversationService 设置对话服务（用于AI伙伴通话）
+func (s *StreamingVoiceCallService) SetConversationService(conversationService *ConversationService) {
+	s.conversationService = conversationService
+}
+
 // SetConnectionErrorCallback 设置连接错误回调
 func (s *StreamingVoiceCallService) SetConnectionErrorCallback(callback func(sessionID string, err error)) {
 	s.onConnectionError = callback
 }
 
-// GetCharacterByID 根据ID获取角色信息
-func (s *StreamingVoiceCallService) GetCharacterByID(characterID int) (*models.PresetCharacter, error) {
-	query := `SELECT id, name, personality_signature, avatar_url FROM preset_characters WHERE id = ?`
+// GetCallPersona 获取通话对象信息，companionID非0时返回用户的AI伙伴
+func (s *StreamingVoiceCallService) GetCallPersona(userID, characterID, companionID int64) (*CallPersona, error) {
+	if companionID != 0 {
+		return s.getCompanionPersona(userID, companionID)
+	}
+
+	query := `SELECT id, name, personality_signature FROM preset_characters WHERE id = ?`
 
-	var character models.PresetCharacter
+	var persona CallPersona
+	var signature sql.NullString
 	err := s.db.QueryRow(query, characterID).Scan(
-		&character.ID,
-		&character.Name,
-		&character.PersonalitySignature,
-		&character.AvatarURL,
+		&persona.CharacterID,
+		&persona.Name,
+		&signature,
 	)
 
 	if err != nil {
@@ -286,12 +349,45 @@ func (s *StreamingVoiceCallService) GetCharacterByID(characterID int) (*models.P
 		return nil, fmt.Errorf("获取角色信息失败: %v", err)
 	}
 
-	return &character, nil
+	// 预设角色的人设由历史消息维持，个性签名仅作为兜底提示词
+	persona.SystemPrompt = signature.String
+	persona.Voice = s.aiService.voiceProfileForCharacter(persona.Name)
+	return &persona, nil
+}
+
+// getCompanionPersona 获取用户的AI伙伴，使用其成长阶段提示词和音色
+func (s *StreamingVoiceCallService) getCompanionPersona(userID, companionID int64) (*CallPersona, error) {
+	var persona CallPersona
+	var voiceType sql.NullString
+	err := s.db.QueryRow(`
+		SELECT id, name, voice_type FROM ai_companions WHERE id = ? AND user_id = ? AND archived_at IS NULL
+	`, companionID, userID).Scan(&persona.CompanionID, &persona.Name, &voiceType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("AI伙伴不存在")
+		}
+		return nil, fmt.Errorf("获取AI伙伴信息失败: %v", err)
+	}
+
+	if s.conversationService == nil {
+		return nil, fmt.Errorf("未配置对话服务，无法与AI伙伴通话")
+	}
+	prompt, err := s.conversationService.generateCompanionPrompt(int(userID), int(companionID), "")
+	if err != nil {
+		return nil, fmt.Errorf("生成AI伙伴提示词失败: %v", err)
+	}
+	persona.SystemPrompt = prompt + " 现在是语音通话，请用口语化的短句回应。"
+
+	persona.Voice = s.aiService.voiceProfileForCharacter(persona.Name)
+	if voiceType.Valid && voiceType.String != "" {
+		persona.Voice.VoiceType = voiceType.String
+	}
+	return &persona, nil
 }
 
-// GenerateTTS 生成TTS音频
-func (s *StreamingVoiceCallService) GenerateTTS(text string, characterName string) ([]byte, error) {
-	return s.aiService.TextToSpeech(text, characterName)
+// GenerateTTS 使用通话对象的音色生成TTS音频
+func (s *StreamingVoiceCallService) GenerateTTS(text string, persona *CallPersona) ([]byte, error) {
+	return s.aiService.TextToSpeechWithProfile(text, persona.Voice)
 }
 
 // SetResponseCallback 设置AI回复回调函数
@@ -299,37 +395,70 @@ func (s *StreamingVoiceCallService) SetResponseCallback(callback func(sessionID,
 	s.onResponseCallback = callback
 }
 
-// StartStreamingCall 开始流式语音通话
+// StartStreamingCall 开始流式语音通话，session_id已存在时拒绝（断线重连只能通过ResumeSession）
 func (s *StreamingVoiceCallService) StartStreamingCall(req *StreamingVoiceCallRequest) (*StreamingVoiceCallResponse, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// 检查是否已存在会话
-	if session, exists := s.sessions[req.SessionID]; exists {
-		if session.IsActive {
-			return &StreamingVoiceCallResponse{
-				SessionID:  req.SessionID,
-				IsComplete: false,
-			}, nil
-		}
+	// 确认通话对象存在（AI伙伴需要用户已创建）
+	persona, err := s.GetCallPersona(req.UserID, req.CharacterID, req.CompanionID)
+	if err != nil {
+		return nil, err
+	}
+
+	resumeToken, err := newResumeToken()
+	if err != nil {
+		return nil, err
 	}
 
 	// 创建会话（不使用WebSocket ASR，改用HTTP ASR）
+	now := time.Now()
 	session := &VoiceCallSession{
-		ID:          req.SessionID,
-		UserID:      req.UserID,
-		CharacterID: req.CharacterID,
-		ASRClient:   nil, // 不使用WebSocket ASR
-		IsActive:    true,
-		LastText:    "",
-		TextOffset:  0,
+		ID:             req.SessionID,
+		UserID:         req.UserID,
+		CharacterID:    persona.CharacterID,
+		CompanionID:    persona.CompanionID,
+		ASRClient:      nil, // 不使用WebSocket ASR
+		IsActive:       true,
+		LastText:       "",
+		TextOffset:     0,
+		StartedAt:      now,
+		LastActivityAt: now,
+		ResumeToken:    resumeToken,
+	}
+	if req.RecordConsent {
+		recorder, err := NewCallRecorder(now)
+		if err != nil {
+			log.Printf("%v，本次通话不录音", err)
+		} else {
+			session.Recorder = recorder
+		}
 	}
 
+	// 在写锁内检查并插入，避免并发发起的同ID通话都创建会话
+	s.mu.Lock()
+	if _, exists := s.sessions[req.SessionID]; exists {
+		s.mu.Unlock()
+		if session.Recorder != nil {
+			session.Recorder.Close()
+		}
+		return nil, ErrVoiceSessionExists
+	}
 	s.sessions[req.SessionID] = session
+	s.mu.Unlock()
+
+	// 写入通话记录（失败不影响通话）
+	callID, err := s.recordCallStarted(session)
+	if err != nil {
+		log.Printf("%v", err)
+	} else {
+		session.mu.Lock()
+		session.CallID = callID
+		session.mu.Unlock()
+	}
 
 	return &StreamingVoiceCallResponse{
-		SessionID:  req.SessionID,
-		IsComplete: false,
+		SessionID:   req.SessionID,
+		ResumeToken: resumeToken,
+		IsComplete:  false,
+		IsRecording: session.Recorder != nil,
 	}, nil
 }
 
@@ -347,6 +476,10 @@ func (s *StreamingVoiceCallService) ProcessAudioChunk(sessionID string, audioDat
 	defer session.mu.Unlock()
 
 	fmt.Printf("处理音频分片: sessionID=%s, 数据长度=%d bytes\n", sessionID, len(audioData))
+	session.LastActivityAt = time.Now()
+	if session.Recorder != nil {
+		session.Recorder.AddUserAudio(audioData, session.LastActivityAt)
+	}
 
 	// 累积音频数据
 	if session.AudioBuffer == nil {
@@ -397,8 +530,18 @@ func (s *StreamingVoiceCallService) processAccumulatedAudio(sessionID string, au
 
 	fmt.Printf("处理累积音频: sessionID=%s, 数据长度=%d bytes\n", sessionID, len(audioData))
 
+	// 用户开始说话，通话视为接通
+	s.mu.RLock()
+	answeredSession, exists := s.sessions[sessionID]
+	s.mu.RUnlock()
+	if exists {
+		s.markCallAnswered(answeredSession)
+	}
+
 	// 调用ASR进行语音识别
+	timing := newVoiceTurnTiming()
 	text, err := s.aiService.SpeechToText(audioData)
+	timing.asr = time.Since(timing.start)
 	if err != nil {
 		log.Printf("ASR识别失败: %v", err)
 
@@ -412,18 +555,18 @@ func (s *StreamingVoiceCallService) processAccumulatedAudio(sessionID string, au
 		}
 
 		// 获取角色信息
-		character, err := s.getCharacterByID(session.CharacterID)
+		persona, err := s.GetCallPersona(session.UserID, session.CharacterID, session.CompanionID)
 		if err != nil {
 			log.Printf("Failed to get character: %v", err)
 			return
 		}
 
 		// 获取噪音响应
-		noiseResponse := s.getNoiseResponseForCharacter(character.Name)
+		noiseResponse := s.getNoiseResponseForCharacter(persona.Name)
 		log.Printf("ASR失败，使用噪音响应: %s", noiseResponse)
 
 		// 处理噪音响应
-		s.processAIResponse(session, "", noiseResponse, character)
+		s.processAIResponse(session, "", noiseResponse, persona, nil, timing)
 		return
 	}
 
@@ -445,7 +588,7 @@ func (s *StreamingVoiceCallService) processAccumulatedAudio(sessionID string, au
 	}
 
 	// 处理识别结果
-	s.processCompleteText(session, text)
+	s.processCompleteText(session, text, timing)
 }
 
 // listenForResponses 监听ASR响应
@@ -516,7 +659,7 @@ func (s *StreamingVoiceCallService) listenForResponses(session *VoiceCallSession
 
 			// 设置静音超时（1.5秒）
 			session.SilenceTimer = time.AfterFunc(1500*time.Millisecond, func() {
-				s.processCompleteText(session, text)
+				s.processCompleteText(session, text, newVoiceTurnTiming())
 			})
 		}
 
@@ -525,74 +668,103 @@ func (s *StreamingVoiceCallService) listenForResponses(session *VoiceCallSession
 }
 
 // processCompleteText 处理完整文本
-func (s *StreamingVoiceCallService) processCompleteText(session *VoiceCallSession, text string) {
+func (s *StreamingVoiceCallService) processCompleteText(session *VoiceCallSession, text string, timing *voiceTurnTiming) {
 	if text == "" || len(text) < 2 {
 		return
 	}
 
 	log.Printf("Processing complete text: %s", text)
 
-	// 获取角色信息
-	character, err := s.getCharacterByID(session.CharacterID)
+	// 获取角色信息（AI伙伴每轮重新生成提示词，以反映最新成长阶段）
+	persona, err := s.GetCallPersona(session.UserID, session.CharacterID, session.CompanionID)
 	if err != nil {
 		log.Printf("Failed to get character: %v", err)
 		return
 	}
 
+	// AI伙伴检索与本轮相关的记忆，放入系统提示词
+	var memories []models.RecalledMemory
+	if persona.IsCompanion() && s.conversationService != nil {
+		memories = s.conversationService.recallMemories(session.chatTarget(), text, "")
+		persona.SystemPrompt += memoryPrompt(memoryContents(memories))
+	}
+
 	// 获取对话历史（像普通语音通话一样）
-	history, err := s.getConversationHistory(session.UserID, session.CharacterID, 5)
+	history, err := s.getConversationHistory(session.UserID, session.chatTarget(), 5)
 	if err != nil {
 		log.Printf("Failed to get conversation history: %v", err)
 		// 如果获取历史失败，使用简单的消息
 		messages := []Message{
-			{Role: "system", Content: character.PersonalitySignature},
+			{Role: "system", Content: persona.SystemPrompt},
 			{Role: "user", Content: text},
 		}
+		llmStart := time.Now()
 		aiText, err := s.aiService.ChatWithLLM(messages, "", 0.7, "voice")
+		timing.llm = time.Since(llmStart)
 		if err != nil {
 			log.Printf("Failed to get LLM response: %v", err)
 			return
 		}
 		// 处理AI回复
-		s.processAIResponse(session, text, aiText, character)
+		s.processAIResponse(session, text, aiText, persona, memories, timing)
 	} else {
 		// 构建消息历史（像普通语音通话一样）
 		messageHistory := s.buildMessageHistoryWithMemory(history, 4)
 
-		// 构建消息列表
-		messages := append(messageHistory, Message{
+		// 构建消息列表，AI伙伴需要成长阶段提示词
+		var messages []Message
+		if persona.IsCompanion() {
+			messages = append(messages, Message{Role: "system", Content: persona.SystemPrompt})
+		}
+		messages = append(messages, messageHistory...)
+		messages = append(messages, Message{
 			Role:    "user",
 			Content: text,
 		})
 
 		// AI回复
+		llmStart := time.Now()
 		aiText, err := s.aiService.ChatWithLLM(messages, "", 0.7, "voice")
+		timing.llm = time.Since(llmStart)
 		if err != nil {
 			log.Printf("Failed to get LLM response: %v", err)
 			return
 		}
 
 		// 处理AI回复
-		s.processAIResponse(session, text, aiText, character)
+		s.processAIResponse(session, text, aiText, persona, memories, timing)
 	}
 }
 
 // processAIResponse 处理AI回复
-func (s *StreamingVoiceCallService) processAIResponse(session *VoiceCallSession, userText, aiText string, character *models.PresetCharacter) {
+func (s *StreamingVoiceCallService) processAIResponse(session *VoiceCallSession, userText, aiText string, persona *CallPersona, memories []models.RecalledMemory, timing *voiceTurnTiming) {
 
 	// 调用TTS
-	aiAudioData, err := s.aiService.TextToSpeech(aiText, character.Name)
+	ttsStart := time.Now()
+	aiAudioData, err := s.GenerateTTS(aiText, persona)
+	timing.tts = time.Since(ttsStart)
 	if err != nil {
 		log.Printf("Failed to get TTS response: %v", err)
 		return
 	}
 
 	// 保存对话记录
-	err = s.saveVoiceCall(session.UserID, session.CharacterID, session.ID, userText, aiText)
+	messageID, err := s.saveVoiceCall(session.UserID, session.chatTarget(), session.ID, userText, aiText)
 	if err != nil {
 		log.Printf("Failed to save voice call: %v", err)
 	}
 
+	// AI伙伴从通话中获得经验、记录用到的记忆并提取新记忆（噪音响应不计）
+	if persona.IsCompanion() && userText != "" && s.conversationService != nil {
+		if _, err := s.conversationService.analyzeUserMessageAndUpdateCompanion(int(session.UserID), int(session.CompanionID), messageID, userText, aiText); err != nil {
+			log.Printf("更新AI伙伴成长数据失败: %v", err)
+		}
+		if messageID > 0 && len(memories) > 0 {
+			s.conversationService.recordMemoryUsage(messageID, memories)
+		}
+		s.conversationService.extractMemories(int(session.UserID), int(session.CompanionID), userText, aiText)
+	}
+
 	// 通过WebSocket将结果发送给前端
 	log.Printf("AI Response: %s", aiText)
 	log.Printf("Audio data length: %d bytes", len(aiAudioData))
@@ -602,6 +774,19 @@ func (s *StreamingVoiceCallService) processAIResponse(session *VoiceCallSession,
 		s.onResponseCallback(session.ID, userText, aiText, aiAudioData)
 	}
 
+	// 角色语音写入录音时间轴
+	session.mu.RLock()
+	recorder := session.Recorder
+	session.mu.RUnlock()
+	if recorder != nil {
+		if err := recorder.AddCharacterAudio(aiAudioData, time.Now()); err != nil {
+			log.Printf("录制角色语音失败: %v", err)
+		}
+	}
+
+	// 记录本轮耗时
+	s.recordTurnLatency(session, timing)
+
 	// 重置文本偏移
 	session.mu.Lock()
 	session.TextOffset = 0
@@ -611,22 +796,31 @@ func (s *StreamingVoiceCallService) processAIResponse(session *VoiceCallSession,
 
 // StopStreamingCall 停止流式语音通话
 func (s *StreamingVoiceCallService) StopStreamingCall(sessionID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	s.mu.RLock()
 	session, exists := s.sessions[sessionID]
+	s.mu.RUnlock()
+
 	if !exists {
 		return fmt.Errorf("session not found")
 	}
 
+	s.deactivateSession(session)
+	s.finishCall(session)
+
+	return nil
+}
+
+// deactivateSession 将会话标记为非活跃并停止计时器
+func (s *StreamingVoiceCallService) deactivateSession(session *VoiceCallSession) {
 	session.mu.Lock()
 	session.IsActive = false
 	if session.SilenceTimer != nil {
 		session.SilenceTimer.Stop()
 	}
+	if session.graceTimer != nil {
+		session.graceTimer.Stop()
+	}
 	session.mu.Unlock()
-
-	return nil
 }
 
 // GetSessionStatus 获取会话状态
@@ -639,38 +833,19 @@ func (s *StreamingVoiceCallService) GetSessionStatus(sessionID string) (*VoiceCa
 }
 
 // 辅助方法
-func (s *StreamingVoiceCallService) getCharacterByID(characterID int64) (*models.PresetCharacter, error) {
-	query := `SELECT id, name, personality_signature, avatar_url FROM preset_characters WHERE id = ?`
-
-	var character models.PresetCharacter
-	err := s.db.QueryRow(query, characterID).Scan(
-		&character.ID,
-		&character.Name,
-		&character.PersonalitySignature,
-		&character.AvatarURL,
-	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("角色不存在")
-		}
-		return nil, fmt.Errorf("获取角色信息失败: %v", err)
-	}
-
-	return &character, nil
-}
 
 // getConversationHistory 获取对话历史
-func (s *StreamingVoiceCallService) getConversationHistory(userID, characterID int64, limit int) ([]models.Conversation, error) {
+func (s *StreamingVoiceCallService) getConversationHistory(userID int64, target models.ChatTarget, limit int) ([]models.Conversation, error) {
+	filter, value := targetFilter("", target)
 	query := `
-		SELECT id, user_id, character_id, user_message, ai_response, message_type, created_at
+		SELECT id, user_id, character_id, companion_id, user_message, ai_response, message_type, created_at
 		FROM conversations 
-		WHERE user_id = ? AND character_id = ?
+		WHERE user_id = ? AND ` + filter + ` AND deleted_at IS NULL
 		ORDER BY created_at DESC 
 		LIMIT ?
 	`
 
-	rows, err := s.db.Query(query, userID, characterID, limit)
+	rows, err := s.db.Query(query, userID, value, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -679,11 +854,12 @@ func (s *StreamingVoiceCallService) getConversationHistory(userID, characterID i
 	var conversations []models.Conversation
 	for rows.Next() {
 		var conv models.Conversation
-		var characterID int
+		var characterID, companionID sql.NullInt64
 		err := rows.Scan(
 			&conv.ID,
 			&conv.UserID,
 			&characterID,
+			&companionID,
 			&conv.UserMessage,
 			&conv.AIResponse,
 			&conv.MessageType,
@@ -692,7 +868,14 @@ func (s *StreamingVoiceCallService) getConversationHistory(userID, characterID i
 		if err != nil {
 			continue
 		}
-		conv.CharacterID = &characterID
+		if characterID.Valid {
+			id := int(characterID.Int64)
+			conv.CharacterID = &id
+		}
+		if companionID.Valid {
+			id := int(companionID.Int64)
+			conv.CompanionID = &id
+		}
 		conversations = append(conversations, conv)
 	}
 
@@ -730,33 +913,87 @@ func (s *StreamingVoiceCallService) buildMessageHistoryWithMemory(conversations
 	return messages
 }
 
-func (s *StreamingVoiceCallService) saveVoiceCall(userID, characterID int64, sessionID, userText, aiText string) error {
-	// 使用 conversations 表保存对话记录
+// saveVoiceCall 保存一轮通话对话，返回对话记录ID
+func (s *StreamingVoiceCallService) saveVoiceCall(userID int64, target models.ChatTarget, sessionID, userText, aiText string) (int, error) {
+	// 使用 conversations 表保存对话记录，AI伙伴记录companion_id，character_id为空
+	characterID, companionID := targetColumns(target)
 	query := `
-		INSERT INTO conversations (user_id, character_id, user_message, ai_response, message_type, session_id, created_at)
-		VALUES (?, ?, ?, ?, 'voice', ?, NOW())
+		INSERT INTO conversations (user_id, character_id, companion_id, user_message, ai_response, message_type, session_id, is_read, created_at)
+		VALUES (?, ?, ?, ?, ?, 'voice', ?, TRUE, NOW())
 	`
 
-	result, err := s.db.Exec(query, userID, characterID, userText, aiText, sessionID)
+	result, err := s.db.Exec(query, userID, characterID, companionID, userText, aiText, sessionID)
 	if err != nil {
-		return fmt.Errorf("保存语音通话记录失败: %v", err)
+		return 0, fmt.Errorf("保存语音通话记录失败: %v", err)
 	}
 
 	// 获取插入的记录ID
 	insertID, _ := result.LastInsertId()
-	fmt.Printf("Successfully saved voice call: ID=%d, UserID=%d, CharacterID=%d\n", insertID, userID, characterID)
+	fmt.Printf("Successfully saved voice call: ID=%d, UserID=%d, Target=%+v\n", insertID, userID, target)
 
 	// 更新好友关系的最后消息时间
-	_, err = s.db.Exec(`
-		UPDATE user_friendships 
-		SET last_message_at = NOW(), updated_at = NOW()
-		WHERE user_id = ? AND character_id = ?
-	`, userID, characterID)
+	if !target.IsCompanion() {
+		_, err = s.db.Exec(`
+			UPDATE user_friendships 
+			SET last_message_at = NOW(), updated_at = NOW()
+			WHERE user_id = ? AND character_id = ?
+		`, userID, target.CharacterID)
+		if err != nil {
+			// 记录错误但不影响语音通话
+			fmt.Printf("Failed to update friendship last_message_at: %v\n", err)
+		}
+	}
+
+	return int(insertID), nil
+}
+
+// GetGreetingText 获取角色打招呼文本
+func GetGreetingText(characterName string) string {
+	switch characterName {
+	case "林黛玉":
+		return "哟，你来了？今日倒是比往日早了些，莫非是有什么心事？"
+	case "孙悟空":
+		return "兄弟，你来了！俺老孙正闲着，有什么话尽管说，别客气！"
+	case "李白":
+		return "人生得意须尽欢，今日得与君通话，当浮一大白！有什么想聊的？"
+	case "赫敏·格兰杰", "赫敏":
+		return "你好，这里是赫敏，找我有什么事吗？"
+	default:
+		return fmt.Sprintf("你好！我是%s，很高兴和你通话！", characterName)
+	}
+}
+
+// PrewarmTTSCache 预先合成所有角色的打招呼语和噪音响应，写入TTS缓存
+func (s *StreamingVoiceCallService) PrewarmTTSCache() error {
+	rows, err := s.db.Query(`SELECT name FROM preset_characters ORDER BY id`)
 	if err != nil {
-		// 记录错误但不影响语音通话
-		fmt.Printf("Failed to update friendship last_message_at: %v\n", err)
+		return fmt.Errorf("查询角色列表失败: %v", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("扫描角色数据失败: %v", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	start := time.Now()
+	warmed := 0
+	for _, name := range names {
+		for _, text := range []string{GetGreetingText(name), s.getNoiseResponseForCharacter(name)} {
+			if _, err := s.aiService.TextToSpeech(text, name); err != nil {
+				log.Printf("预热TTS缓存失败: character=%s, text=%s, err=%v", name, text, err)
+				continue
+			}
+			warmed++
+		}
 	}
 
+	log.Printf("TTS缓存预热完成: %d条音频, 耗时%v", warmed, time.Since(start))
 	return nil
 }
 
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/storage"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// TTSVoiceProfile 语音合成参数，与文本一起组成缓存键
+type TTSVoiceProfile struct {
+	VoiceType  string  // 音色
+	SpeedRatio float64 // 语速
+	Encoding   string  // 编码格式
+}
+
+// TTSCacheStats TTS缓存命中统计
+type TTSCacheStats struct {
+	MemoryHits  int64   `json:"memory_hits"`  // 内存命中次数
+	DiskHits    int64   `json:"disk_hits"`    // 磁盘命中次数
+	Misses      int64   `json:"misses"`       // 未命中次数
+	Entries     int     `json:"entries"`      // 内存中的条目数
+	MemoryBytes int64   `json:"memory_bytes"` // 内存中音频总字节数
+	HitRate     float64 `json:"hit_rate"`     // 总命中率
+}
+
+// ttsCacheEntry LRU链表中的条目
+type ttsCacheEntry struct {
+	key   string
+	audio []byte
+}
+
+// TTSCache 内容寻址的TTS音频缓存：内存LRU + 文件存储两级
+type TTSCache struct {
+	mu          sync.Mutex
+	maxEntries  int
+	items       map[string]*list.Element
+	order       *list.List // 队首为最近使用
+	memoryBytes int64
+	store       storage.FileStore // 磁盘层，可为nil
+
+	memoryHits int64
+	diskHits   int64
+	misses     int64
+}
+
+// NewTTSCache 创建TTS缓存实例
+func NewTTSCache(maxEntries int, store storage.FileStore) *TTSCache {
+	if maxEntries <= 0 {
+		maxEntries = 200
+	}
+	return &TTSCache{
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+		store:      store,
+	}
+}
+
+// TTSCacheKey 根据规范化文本和音色参数计算缓存键
+func TTSCacheKey(text string, profile TTSVoiceProfile) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%.2f\x00%s", normalizeTTSText(text), profile.VoiceType, profile.SpeedRatio, profile.Encoding)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeTTSText 规范化文本：去除首尾空白并合并连续空白
+func normalizeTTSText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Get 查询缓存，先查内存再查磁盘，磁盘命中会回填内存
+func (c *TTSCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		audio := elem.Value.(*ttsCacheEntry).audio
+		c.mu.Unlock()
+		atomic.AddInt64(&c.memoryHits, 1)
+		return audio, true
+	}
+	c.mu.Unlock()
+
+	if c.store != nil {
+		audio, err := c.store.Get(c.storeKey(key))
+		if err == nil && len(audio) > 0 {
+			atomic.AddInt64(&c.diskHits, 1)
+			c.putMemory(key, audio)
+			return audio, true
+		}
+		if err != nil && err != storage.ErrNotFound {
+			log.Printf("读取TTS磁盘缓存失败: %v", err)
+		}
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	return nil, false
+}
+
+// Put 写入缓存（内存和磁盘）
+func (c *TTSCache) Put(key string, audio []byte) {
+	if len(audio) == 0 {
+		return
+	}
+	c.putMemory(key, audio)
+
+	if c.store != nil {
+		if _, err := c.store.Put(c.storeKey(key), audio); err != nil {
+			log.Printf("写入TTS磁盘缓存失败: %v", err)
+		}
+	}
+}
+
+// Stats 返回缓存统计
+func (c *TTSCache) Stats() TTSCacheStats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	memoryBytes := c.memoryBytes
+	c.mu.Unlock()
+
+	stats := TTSCacheStats{
+		MemoryHits:  atomic.LoadInt64(&c.memoryHits),
+		DiskHits:    atomic.LoadInt64(&c.diskHits),
+		Misses:      atomic.LoadInt64(&c.misses),
+		Entries:     entries,
+		MemoryBytes: memoryBytes,
+	}
+	total := stats.MemoryHits + stats.DiskHits + stats.Misses
+	if total > 0 {
+		stats.HitRate = float64(stats.MemoryHits+stats.DiskHits) / float64(total)
+	}
+	return stats
+}
+
+// putMemory 写入内存LRU，超出容量时淘汰最久未使用的条目
+func (c *TTSCache) putMemory(key string, audio []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*ttsCacheEntry)
+		c.memoryBytes += int64(len(audio) - len(entry.audio))
+		entry.audio = audio
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&ttsCacheEntry{key: key, audio: audio})
+	c.memoryBytes += int64(len(audio))
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*ttsCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.memoryBytes -= int64(len(entry.audio))
+	}
+}
+
+// storeKey 磁盘层的文件路径，按前两位分目录避免单目录文件过多
+func (c *TTSCache) storeKey(key string) string {
+	return fmt.Sprintf("tts-cache/%s/%s", key[:2], key)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"seven-ai-backend/internal/models"
 	"strings"
@@ -10,6 +11,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidTimezone 时区名称无法识别
+var ErrInvalidTimezone = errors.New("无效的时区")
+
 type UserService struct {
 	db        *sql.DB
 	aiService *AIService
@@ -298,6 +302,87 @@ func (s *UserService) generateWelcomeMessage(userID int, characterID int) error
 	return nil
 }
 
+// GetPreferences 获取用户偏好设置，不存在时创建默认设置
+func (s *UserService) GetPreferences(userID int) (*models.UserPreferences, error) {
+	var prefs models.UserPreferences
+	err := s.db.QueryRow(`
+		SELECT user_id, voice_enabled, auto_save_memories, notification_enabled,
+		       language_preference, recording_retention_days,
+		       quiet_hours_start, quiet_hours_end, timezone
+		FROM user_preferences WHERE user_id = ?
+	`, userID).Scan(
+		&prefs.UserID, &prefs.VoiceEnabled, &prefs.AutoSaveMemories,
+		&prefs.NotificationEnabled, &prefs.LanguagePreference, &prefs.RecordingRetentionDays,
+		&prefs.QuietHoursStart, &prefs.QuietHoursEnd, &prefs.Timezone,
+	)
+	if err == sql.ErrNoRows {
+		_, err = s.db.Exec(`
+			INSERT INTO user_preferences (user_id, voice_enabled, auto_save_memories, notification_enabled, language_preference)
+			VALUES (?, TRUE, TRUE, TRUE, 'zh-CN')
+		`, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user preferences: %w", err)
+		}
+		return s.GetPreferences(userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user preferences: %w", err)
+	}
+
+	return &prefs, nil
+}
+
+// UpdatePreferences 更新用户偏好设置
+func (s *UserService) UpdatePreferences(userID int, req models.UpdatePreferencesRequest) (*models.UserPreferences, error) {
+	prefs, err := s.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.VoiceEnabled != nil {
+		prefs.VoiceEnabled = *req.VoiceEnabled
+	}
+	if req.AutoSaveMemories != nil {
+		prefs.AutoSaveMemories = *req.AutoSaveMemories
+	}
+	if req.NotificationEnabled != nil {
+		prefs.NotificationEnabled = *req.NotificationEnabled
+	}
+	if req.LanguagePreference != nil {
+		prefs.LanguagePreference = *req.LanguagePreference
+	}
+	if req.RecordingRetentionDays != nil {
+		prefs.RecordingRetentionDays = *req.RecordingRetentionDays
+	}
+	if req.QuietHoursStart != nil {
+		prefs.QuietHoursStart = *req.QuietHoursStart
+	}
+	if req.QuietHoursEnd != nil {
+		prefs.QuietHoursEnd = *req.QuietHoursEnd
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			return nil, ErrInvalidTimezone
+		}
+		prefs.Timezone = *req.Timezone
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE user_preferences
+		SET voice_enabled = ?, auto_save_memories = ?, notification_enabled = ?,
+		    language_preference = ?, recording_retention_days = ?,
+		    quiet_hours_start = ?, quiet_hours_end = ?, timezone = ?, updated_at = NOW()
+		WHERE user_id = ?
+	`, prefs.VoiceEnabled, prefs.AutoSaveMemories, prefs.NotificationEnabled,
+		prefs.LanguagePreference, prefs.RecordingRetentionDays,
+		prefs.QuietHoursStart, prefs.QuietHoursEnd, prefs.Timezone, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
 // generateUniqueUsername 生成唯一的用户名
 func (s *UserService) generateUniqueUsername(email string) string {
 	// 使用邮箱前缀作为基础用户名
@@ -338,9 +423,9 @@ func (s *UserService) createDefaultCompanion(userID int) error {
 		INSERT INTO ai_companions (
 			user_id, name, avatar_url, personality_signature,
 			conversation_fluency, knowledge_breadth, empathy_depth, 
-			creativity_level, humor_sense, growth_mode, gender,
+			creativity_level, humor_sense, growth_mode, gender, is_default,
 			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE, NOW(), NOW())
 	`
 
 	_, err = s.db.Exec(query,
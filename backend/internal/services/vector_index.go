@@ -0,0 +1,422 @@
+package services
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 向量索引中的内容类型
+const (
+	VectorKindConversation = "conversation" // 一轮对话，owner为user_id
+	VectorKindMemory       = "memory"       // 记忆片段，owner为companion_id
+)
+
+const defaultBackfillBatchSize = 32
+
+// vectorKey 索引条目的唯一标识
+type vectorKey struct {
+	kind  string
+	refID int
+}
+
+// ownerKey 按内容类型和所有者划分的索引分区，检索时只扫描一个分区
+type ownerKey struct {
+	kind    string
+	ownerID int
+}
+
+// VectorMatch 向量检索结果
+type VectorMatch struct {
+	RefID      int
+	Similarity float64
+}
+
+// VectorItem 待写入索引的一条内容
+type VectorItem struct {
+	Kind    string
+	RefID   int
+	OwnerID int
+	Text    string
+}
+
+// VectorIndex 进程内向量索引，向量持久化在MySQL的embeddings表中
+// 只加载当前模型生成的向量；更换模型后由后台回填任务重建
+type VectorIndex struct {
+	db       *sql.DB
+	embedder Embedder
+
+	mu     sync.RWMutex
+	owners map[ownerKey]map[int][]float32 // 分区 → ref_id → 向量
+	refs   map[vectorKey]int              // 条目 → owner_id
+}
+
+// NewVectorIndex 创建向量索引
+func NewVectorIndex(db *sql.DB, embedder Embedder) *VectorIndex {
+	return &VectorIndex{
+		db:       db,
+		embedder: embedder,
+		owners:   make(map[ownerKey]map[int][]float32),
+		refs:     make(map[vectorKey]int),
+	}
+}
+
+// put 写入一条向量，所有者变化时从旧分区移除，调用方需持有写锁
+func (idx *VectorIndex) put(kind string, refID, ownerID int, vector []float32) {
+	idx.remove(kind, refID)
+	owner := ownerKey{kind, ownerID}
+	if idx.owners[owner] == nil {
+		idx.owners[owner] = make(map[int][]float32)
+	}
+	idx.owners[owner][refID] = vector
+	idx.refs[vectorKey{kind, refID}] = ownerID
+}
+
+// remove 移除一条向量，调用方需持有写锁
+func (idx *VectorIndex) remove(kind string, refID int) {
+	key := vectorKey{kind, refID}
+	ownerID, ok := idx.refs[key]
+	if !ok {
+		return
+	}
+	delete(idx.refs, key)
+	owner := ownerKey{kind, ownerID}
+	delete(idx.owners[owner], refID)
+	if len(idx.owners[owner]) == 0 {
+		delete(idx.owners, owner)
+	}
+}
+
+// Load 从数据库加载当前模型的全部向量，跳过向量化失败的标记行
+func (idx *VectorIndex) Load() error {
+	rows, err := idx.db.Query(`
+		SELECT kind, ref_id, owner_id, vector FROM embeddings WHERE model = ? AND dims > 0
+	`, idx.embedder.Model())
+	if err != nil {
+		return fmt.Errorf("failed to load embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	loaded := &VectorIndex{owners: make(map[ownerKey]map[int][]float32), refs: make(map[vectorKey]int)}
+	for rows.Next() {
+		var kind string
+		var refID, ownerID int
+		var blob []byte
+		if err := rows.Scan(&kind, &refID, &ownerID, &blob); err != nil {
+			return fmt.Errorf("failed to scan embedding: %w", err)
+		}
+		loaded.put(kind, refID, ownerID, decodeVector(blob))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load embeddings: %w", err)
+	}
+
+	idx.mu.Lock()
+	idx.owners, idx.refs = loaded.owners, loaded.refs
+	idx.mu.Unlock()
+	log.Printf("向量索引已加载: model=%s, count=%d", idx.embedder.Model(), len(loaded.refs))
+	return nil
+}
+
+// EmbedQuery 计算查询文本的向量
+func (idx *VectorIndex) EmbedQuery(text string) ([]float32, error) {
+	vectors, err := idx.embedder.Embed([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+	return vectors[0], nil
+}
+
+// Vector 获取已索引内容的向量
+func (idx *VectorIndex) Vector(kind string, refID int) ([]float32, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ownerID, ok := idx.refs[vectorKey{kind, refID}]
+	if !ok {
+		return nil, false
+	}
+	vector, ok := idx.owners[ownerKey{kind, ownerID}][refID]
+	return vector, ok
+}
+
+// Add 计算向量并写入索引和数据库，已存在的条目会被覆盖
+func (idx *VectorIndex) Add(items []VectorItem) ([][]float32, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = item.Text
+	}
+	vectors, err := idx.embedder.Embed(texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed: %w", err)
+	}
+	if len(vectors) != len(items) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(items))
+	}
+
+	model := idx.embedder.Model()
+	for i, item := range items {
+		_, err := idx.db.Exec(`
+			INSERT INTO embeddings (kind, ref_id, owner_id, model, dims, content_hash, vector, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, NOW())
+			ON DUPLICATE KEY UPDATE owner_id = VALUES(owner_id), model = VALUES(model), dims = VALUES(dims),
+				content_hash = VALUES(content_hash), vector = VALUES(vector), updated_at = NOW()
+		`, item.Kind, item.RefID, item.OwnerID, model, len(vectors[i]), contentHash(item.Text), encodeVector(vectors[i]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save embedding: %w", err)
+		}
+	}
+
+	idx.mu.Lock()
+	for i, item := range items {
+		idx.put(item.Kind, item.RefID, item.OwnerID, vectors[i])
+	}
+	idx.mu.Unlock()
+	return vectors, nil
+}
+
+// markFailed 记录无法向量化的内容（dims为0、向量为空），内容和模型不变时回填任务不再重试
+func (idx *VectorIndex) markFailed(item VectorItem) error {
+	_, err := idx.db.Exec(`
+		INSERT INTO embeddings (kind, ref_id, owner_id, model, dims, content_hash, vector, updated_at)
+		VALUES (?, ?, ?, ?, 0, ?, '', NOW())
+		ON DUPLICATE KEY UPDATE owner_id = VALUES(owner_id), model = VALUES(model), dims = 0,
+			content_hash = VALUES(content_hash), vector = '', updated_at = NOW()
+	`, item.Kind, item.RefID, item.OwnerID, idx.embedder.Model(), contentHash(item.Text))
+	if err != nil {
+		return fmt.Errorf("failed to mark embedding failure: %w", err)
+	}
+	idx.mu.Lock()
+	idx.remove(item.Kind, item.RefID)
+	idx.mu.Unlock()
+	return nil
+}
+
+// addInBackground 后台写入索引，失败只记录日志（回填任务会补上）
+func (idx *VectorIndex) addInBackground(item VectorItem) {
+	if _, err := idx.Add([]VectorItem{item}); err != nil {
+		log.Printf("写入向量索引失败: kind=%s, id=%d, err=%v", item.Kind, item.RefID, err)
+	}
+}
+
+// Remove 从索引和数据库中删除一条内容
+func (idx *VectorIndex) Remove(kind string, refID int) error {
+	idx.mu.Lock()
+	idx.remove(kind, refID)
+	idx.mu.Unlock()
+	if _, err := idx.db.Exec(`DELETE FROM embeddings WHERE kind = ? AND ref_id = ?`, kind, refID); err != nil {
+		return fmt.Errorf("failed to delete embedding: %w", err)
+	}
+	return nil
+}
+
+// Search 在某个owner的内容中查找与查询向量最相似的k条，k<=0时返回全部
+// 相似度相同时按ref_id倒序，保证结果顺序稳定
+func (idx *VectorIndex) Search(kind string, ownerID int, query []float32, k int) []VectorMatch {
+	// 只在锁内复制该分区的向量引用，相似度计算放到锁外
+	idx.mu.RLock()
+	partition := idx.owners[ownerKey{kind, ownerID}]
+	refIDs := make([]int, 0, len(partition))
+	vectors := make([][]float32, 0, len(partition))
+	for refID, vector := range partition {
+		refIDs = append(refIDs, refID)
+		vectors = append(vectors, vector)
+	}
+	idx.mu.RUnlock()
+
+	matches := make([]VectorMatch, len(refIDs))
+	for i, refID := range refIDs {
+		matches[i] = VectorMatch{RefID: refID, Similarity: cosineSimilarity(query, vectors[i])}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		return matches[i].RefID > matches[j].RefID
+	})
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// StartBackfill 定期为尚未索引、内容已变化或由旧模型生成向量的对话和记忆补建向量
+func (idx *VectorIndex) StartBackfill(interval time.Duration, batchSize int) {
+	if batchSize <= 0 {
+		batchSize = defaultBackfillBatchSize
+	}
+	go func() {
+		for {
+			for {
+				indexed, err := idx.backfillOnce(batchSize)
+				if err != nil {
+					log.Printf("向量回填失败: %v", err)
+					break
+				}
+				if indexed == 0 {
+					break
+				}
+				log.Printf("向量回填: %d条", indexed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// backfillOnce 回填一批记忆和对话，并清理已删除内容的向量，返回处理的条数
+func (idx *VectorIndex) backfillOnce(batchSize int) (int, error) {
+	model := idx.embedder.Model()
+	total := 0
+
+	memories, err := idx.pendingItems(VectorKindMemory, `
+		SELECT mf.id, mf.companion_id, mf.content
+		FROM memory_fragments mf
+		LEFT JOIN embeddings e ON e.kind = 'memory' AND e.ref_id = mf.id
+		WHERE e.ref_id IS NULL OR e.model <> ? OR e.content_hash <> MD5(mf.content)
+		ORDER BY mf.id DESC
+		LIMIT ?
+	`, model, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	total += idx.addBatch(memories)
+
+	conversations, err := idx.pendingItems(VectorKindConversation, `
+		SELECT c.id, c.user_id, CONCAT(COALESCE(c.user_message, ''), '\n', COALESCE(c.ai_response, ''))
+		FROM conversations c
+		LEFT JOIN embeddings e ON e.kind = 'conversation' AND e.ref_id = c.id
+		WHERE c.deleted_at IS NULL
+		  AND (e.ref_id IS NULL OR e.model <> ?
+		       OR e.content_hash <> MD5(CONCAT(COALESCE(c.user_message, ''), '\n', COALESCE(c.ai_response, ''))))
+		ORDER BY c.id DESC
+		LIMIT ?
+	`, model, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	total += idx.addBatch(conversations)
+
+	pruned, err := idx.pruneDeleted(batchSize)
+	if err != nil {
+		return total, err
+	}
+	return total + pruned, nil
+}
+
+// addBatch 批量写入索引；整批失败时逐条重试，仍失败的标记为无法向量化，
+// 避免同一批内容卡住回填。返回已写入或已标记的条数
+func (idx *VectorIndex) addBatch(items []VectorItem) int {
+	if len(items) == 0 {
+		return 0
+	}
+	if _, err := idx.Add(items); err == nil {
+		return len(items)
+	}
+	handled := 0
+	for _, item := range items {
+		_, err := idx.Add([]VectorItem{item})
+		if err == nil {
+			handled++
+			continue
+		}
+		log.Printf("向量化失败，跳过该内容: kind=%s, id=%d, err=%v", item.Kind, item.RefID, err)
+		if err := idx.markFailed(item); err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		handled++
+	}
+	return handled
+}
+
+// pruneDeleted 删除已删除（含软删除）的对话和记忆的向量，返回删除的条数
+func (idx *VectorIndex) pruneDeleted(batchSize int) (int, error) {
+	rows, err := idx.db.Query(`
+		SELECT e.kind, e.ref_id FROM embeddings e
+		LEFT JOIN conversations c ON e.kind = 'conversation' AND c.id = e.ref_id
+		LEFT JOIN memory_fragments mf ON e.kind = 'memory' AND mf.id = e.ref_id
+		WHERE (e.kind = 'conversation' AND (c.id IS NULL OR c.deleted_at IS NOT NULL))
+		   OR (e.kind = 'memory' AND mf.id IS NULL)
+		LIMIT ?
+	`, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query deleted embeddings: %w", err)
+	}
+	var stale []vectorKey
+	for rows.Next() {
+		var key vectorKey
+		if err := rows.Scan(&key.kind, &key.refID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan deleted embedding: %w", err)
+		}
+		stale = append(stale, key)
+	}
+	rows.Close()
+
+	for _, key := range stale {
+		if err := idx.Remove(key.kind, key.refID); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// pendingItems 查询需要回填的内容，查询结果为 (ref_id, owner_id, text)
+func (idx *VectorIndex) pendingItems(kind, query string, args ...interface{}) ([]VectorItem, error) {
+	rows, err := idx.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s backfill: %w", kind, err)
+	}
+	defer rows.Close()
+
+	var items []VectorItem
+	for rows.Next() {
+		item := VectorItem{Kind: kind}
+		if err := rows.Scan(&item.RefID, &item.OwnerID, &item.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan %s backfill: %w", kind, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// conversationVectorText 一轮对话用于向量化的文本，需与回填查询中的拼接方式一致
+func conversationVectorText(userMessage, aiResponse string) string {
+	return userMessage + "\n" + aiResponse
+}
+
+// contentHash 内容的MD5，与MySQL的MD5()结果一致，用于发现内容变化
+func contentHash(text string) string {
+	sum := md5.Sum([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeVector 把向量编码为小端float32字节
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(v))
+	}
+	return buf
+}
+
+// decodeVector 解码小端float32字节
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector
+}
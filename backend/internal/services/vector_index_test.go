@@ -0,0 +1,85 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecodeVector(t *testing.T) {
+	tests := []struct {
+		name   string
+		vector []float32
+	}{
+		{"empty", []float32{}},
+		{"single", []float32{1}},
+		{"mixed", []float32{0.5, -0.25, 0, 3.75, -1e-6}},
+		{"extremes", []float32{math.MaxFloat32, -math.MaxFloat32, math.SmallestNonzeroFloat32}},
+	}
+	for _, tt := range tests {
+		buf := encodeVector(tt.vector)
+		if len(buf) != 4*len(tt.vector) {
+			t.Errorf("%s: encoded %d bytes, want %d", tt.name, len(buf), 4*len(tt.vector))
+		}
+		if got := decodeVector(buf); !reflect.DeepEqual(got, tt.vector) {
+			t.Errorf("%s: decodeVector = %v, want %v", tt.name, got, tt.vector)
+		}
+	}
+}
+
+func TestVectorIndexSearch(t *testing.T) {
+	idx := NewVectorIndex(nil, NewHashingEmbedder(8))
+	idx.put(VectorKindConversation, 1, 10, []float32{1, 0})
+	idx.put(VectorKindConversation, 2, 10, []float32{0, 1})
+	idx.put(VectorKindConversation, 3, 10, []float32{1, 1})
+	idx.put(VectorKindConversation, 4, 10, []float32{2, 0}) // 与1同方向，相似度相同
+	idx.put(VectorKindConversation, 5, 20, []float32{1, 0}) // 其他用户
+	idx.put(VectorKindMemory, 6, 10, []float32{1, 0})       // 其他类型
+
+	query := []float32{1, 0}
+	tests := []struct {
+		name    string
+		kind    string
+		ownerID int
+		k       int
+		want    []int
+	}{
+		{"all ordered by similarity then id desc", VectorKindConversation, 10, 0, []int{4, 1, 3, 2}},
+		{"top k", VectorKindConversation, 10, 2, []int{4, 1}},
+		{"k larger than partition", VectorKindConversation, 10, 10, []int{4, 1, 3, 2}},
+		{"other owner", VectorKindConversation, 20, 0, []int{5}},
+		{"other kind", VectorKindMemory, 10, 0, []int{6}},
+		{"unknown owner", VectorKindConversation, 30, 0, []int{}},
+	}
+	for _, tt := range tests {
+		matches := idx.Search(tt.kind, tt.ownerID, query, tt.k)
+		got := make([]int, len(matches))
+		for i, m := range matches {
+			got[i] = m.RefID
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Search = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 所有者变化时从旧分区移除
+	idx.put(VectorKindConversation, 1, 20, []float32{1, 0})
+	if matches := idx.Search(VectorKindConversation, 10, query, 0); len(matches) != 3 {
+		t.Errorf("after owner change: %d matches for old owner, want 3", len(matches))
+	}
+	if owner := idx.refs[vectorKey{VectorKindConversation, 1}]; owner != 20 {
+		t.Errorf("after owner change: owner = %d, want 20", owner)
+	}
+
+	idx.remove(VectorKindConversation, 5)
+	idx.remove(VectorKindConversation, 1)
+	if _, ok := idx.owners[ownerKey{VectorKindConversation, 20}]; ok {
+		t.Error("empty partition should be dropped")
+	}
+	if _, ok := idx.Vector(VectorKindConversation, 1); ok {
+		t.Error("removed vector still found")
+	}
+	if v, ok := idx.Vector(VectorKindConversation, 2); !ok || !reflect.DeepEqual(v, []float32{0, 1}) {
+		t.Errorf("Vector(2) = %v, %v", v, ok)
+	}
+}
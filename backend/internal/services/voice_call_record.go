@@ -0,0 +1,232 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"seven-ai-backend/internal/models"
+	"time"
+)
+
+// voiceTurnTiming 单轮语音对话各阶段耗时
+type voiceTurnTiming struct {
+	start time.Time
+	asr   time.Duration
+	llm   time.Duration
+	tts   time.Duration
+}
+
+// newVoiceTurnTiming 开始计时一轮对话
+func newVoiceTurnTiming() *voiceTurnTiming {
+	return &voiceTurnTiming{start: time.Now()}
+}
+
+// recordCallStarted 写入通话发起记录，返回voice_calls.id
+func (s *StreamingVoiceCallService) recordCallStarted(session *VoiceCallSession) (int64, error) {
+	// AI伙伴通话记录companion_id，character_id只引用预设角色
+	var characterID, companionID interface{}
+	if session.CompanionID != 0 {
+		companionID = session.CompanionID
+	} else {
+		characterID = session.CharacterID
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO voice_calls (user_id, character_id, companion_id, session_id, call_type, status, started_at)
+		VALUES (?, ?, ?, ?, 'voice_chat', ?, ?)
+	`, session.UserID, characterID, companionID, session.ID, models.VoiceCallStatusInitiated, session.StartedAt)
+	if err != nil {
+		return 0, fmt.Errorf("保存通话记录失败: %v", err)
+	}
+	return result.LastInsertId()
+}
+
+// markCallAnswered 用户第一次说话时将通话标记为已接通
+func (s *StreamingVoiceCallService) markCallAnswered(session *VoiceCallSession) {
+	session.mu.Lock()
+	if session.AnsweredAt != nil {
+		session.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	session.AnsweredAt = &now
+	callID := session.CallID
+	session.mu.Unlock()
+
+	if callID == 0 {
+		return
+	}
+	_, err := s.db.Exec(`
+		UPDATE voice_calls SET status = ?, answered_at = ? WHERE id = ?
+	`, models.VoiceCallStatusAnswered, now, callID)
+	if err != nil {
+		log.Printf("更新通话接通状态失败: %v", err)
+	}
+}
+
+// finishCall 结束通话：接通过的记为ended并计算时长，否则记为missed
+func (s *StreamingVoiceCallService) finishCall(session *VoiceCallSession) {
+	session.mu.Lock()
+	if session.EndedAt != nil {
+		session.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	session.EndedAt = &now
+	callID := session.CallID
+	answeredAt := session.AnsweredAt
+	session.mu.Unlock()
+
+	if s.onSessionClosed != nil {
+		s.onSessionClosed(session.ID)
+	}
+
+	// 混音已在通话中写入临时文件，保存录音较慢，放到后台进行（未写入通话记录时只清理临时文件）
+	go s.saveRecording(session)
+
+	if callID == 0 {
+		return
+	}
+
+	status := models.VoiceCallStatusMissed
+	duration := 0
+	if answeredAt != nil {
+		status = models.VoiceCallStatusEnded
+		duration = int(now.Sub(*answeredAt).Seconds())
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE voice_calls SET status = ?, duration_seconds = ?, ended_at = ? WHERE id = ?
+	`, status, duration, now, callID)
+	if err != nil {
+		log.Printf("更新通话结束状态失败: %v", err)
+	}
+}
+
+// recordTurnLatency 记录一轮对话的各阶段耗时
+func (s *StreamingVoiceCallService) recordTurnLatency(session *VoiceCallSession, timing *voiceTurnTiming) {
+	if timing == nil {
+		return
+	}
+	session.mu.RLock()
+	callID := session.CallID
+	session.mu.RUnlock()
+	if callID == 0 {
+		return
+	}
+
+	total := time.Since(timing.start)
+	_, err := s.db.Exec(`
+		INSERT INTO voice_call_turns (voice_call_id, asr_ms, llm_ms, tts_ms, total_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())
+	`, callID, timing.asr.Milliseconds(), timing.llm.Milliseconds(), timing.tts.Milliseconds(), total.Milliseconds())
+	if err != nil {
+		log.Printf("保存通话轮次耗时失败: %v", err)
+	}
+}
+
+// ListVoiceCalls 获取用户的通话历史
+func (s *StreamingVoiceCallService) ListVoiceCalls(userID int, limit, offset int) ([]models.VoiceCall, error) {
+	rows, err := s.db.Query(`
+		SELECT vc.id, vc.user_id, vc.character_id, vc.companion_id, vc.session_id,
+		       vc.call_type, vc.status, vc.duration_seconds, vc.audio_file_url,
+		       vc.started_at, vc.answered_at, vc.ended_at,
+		       COUNT(t.id), COALESCE(AVG(t.total_ms), 0)
+		FROM voice_calls vc
+		LEFT JOIN voice_call_turns t ON t.voice_call_id = vc.id
+		WHERE vc.user_id = ?
+		GROUP BY vc.id
+		ORDER BY vc.started_at DESC, vc.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("查询通话记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	calls := []models.VoiceCall{}
+	for rows.Next() {
+		var call models.VoiceCall
+		var characterID, companionID sql.NullInt64
+		var sessionID, audioFileURL sql.NullString
+		var answeredAt, endedAt sql.NullTime
+		var avgLatency float64
+		err := rows.Scan(
+			&call.ID, &call.UserID, &characterID, &companionID, &sessionID,
+			&call.CallType, &call.Status, &call.DurationSeconds, &audioFileURL,
+			&call.StartedAt, &answeredAt, &endedAt,
+			&call.TurnCount, &avgLatency,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("扫描通话记录失败: %v", err)
+		}
+
+		// 处理NULL值
+		if characterID.Valid {
+			id := int(characterID.Int64)
+			call.CharacterID = &id
+		}
+		if companionID.Valid {
+			id := int(companionID.Int64)
+			call.CompanionID = &id
+		}
+		call.SessionID = sessionID.String
+		call.AudioFileURL = audioFileURL.String
+		if answeredAt.Valid {
+			call.AnsweredAt = &answeredAt.Time
+		}
+		if endedAt.Valid {
+			call.EndedAt = &endedAt.Time
+		}
+		call.AvgTurnLatencyMs = int(avgLatency)
+
+		calls = append(calls, call)
+	}
+
+	return calls, nil
+}
+
+// StartSessionJanitor 启动后台清理任务，定期结束空闲会话并移除已结束的会话
+func (s *StreamingVoiceCallService) StartSessionJanitor(interval, idleTimeout, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.evictDeadSessions(idleTimeout, retention)
+		}
+	}()
+}
+
+// evictDeadSessions 清理内存中的失效会话
+func (s *StreamingVoiceCallService) evictDeadSessions(idleTimeout, retention time.Duration) {
+	now := time.Now()
+	var idle []*VoiceCallSession
+
+	s.mu.Lock()
+	for id, session := range s.sessions {
+		session.mu.RLock()
+		isActive := session.IsActive
+		lastActivity := session.LastActivityAt
+		endedAt := session.EndedAt
+		session.mu.RUnlock()
+
+		switch {
+		case isActive && now.Sub(lastActivity) > idleTimeout:
+			// 长时间没有任何音频的会话视为已断开
+			idle = append(idle, session)
+			delete(s.sessions, id)
+		case !isActive && (endedAt == nil || now.Sub(*endedAt) > retention):
+			delete(s.sessions, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, session := range idle {
+		s.deactivateSession(session)
+		s.finishCall(session)
+	}
+
+	if len(idle) > 0 {
+		log.Printf("清理空闲语音会话: %d个", len(idle))
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrVoiceSessionExists 发起通话的session_id已被占用，断线重连需使用resume_call和重连令牌
+var ErrVoiceSessionExists = errors.New("会话已存在，请使用重连令牌恢复通话")
+
+// defaultResumeGracePeriod 连接断开后会话保留等待重连的默认时长
+const defaultResumeGracePeriod = 60 * time.Second
+
+// SetResumeGracePeriod 设置断线重连的宽限期
+func (s *StreamingVoiceCallService) SetResumeGracePeriod(grace time.Duration) {
+	s.resumeGrace = grace
+}
+
+// SetSessionClosedCallback 设置会话结束回调（用于清理未送达的消息缓冲）
+func (s *StreamingVoiceCallService) SetSessionClosedCallback(callback func(sessionID string)) {
+	s.onSessionClosed = callback
+}
+
+// newResumeToken 生成随机的断线重连令牌
+func newResumeToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成重连令牌失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// DetachSession WebSocket断开时调用：会话保持活跃，宽限期内未重连则结束通话
+func (s *StreamingVoiceCallService) DetachSession(sessionID string) {
+	s.mu.RLock()
+	session, exists := s.sessions[sessionID]
+	s.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	grace := s.resumeGrace
+	if grace <= 0 {
+		grace = defaultResumeGracePeriod
+	}
+
+	session.mu.Lock()
+	if !session.IsActive {
+		session.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	session.DisconnectedAt = &now
+	if session.graceTimer != nil {
+		session.graceTimer.Stop()
+	}
+	session.graceTimer = time.AfterFunc(grace, func() {
+		s.expireDetachedSession(session, now)
+	})
+	session.mu.Unlock()
+
+	log.Printf("语音会话连接断开，等待重连: sessionID=%s, 宽限期=%v", sessionID, grace)
+}
+
+// expireDetachedSession 宽限期结束仍未重连，结束通话
+func (s *StreamingVoiceCallService) expireDetachedSession(session *VoiceCallSession, disconnectedAt time.Time) {
+	session.mu.RLock()
+	// 期间已重连（或再次断开重新计时）则不处理
+	stillDetached := session.DisconnectedAt != nil && session.DisconnectedAt.Equal(disconnectedAt)
+	session.mu.RUnlock()
+	if !stillDetached {
+		return
+	}
+
+	log.Printf("语音会话重连超时，结束通话: sessionID=%s", session.ID)
+	s.deactivateSession(session)
+	s.finishCall(session)
+}
+
+// ResumeSession 使用重连令牌恢复会话
+func (s *StreamingVoiceCallService) ResumeSession(sessionID string, userID int64, resumeToken string) (*StreamingVoiceCallResponse, error) {
+	s.mu.RLock()
+	session, exists := s.sessions[sessionID]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if !session.IsActive {
+		return nil, fmt.Errorf("session already ended")
+	}
+	if session.UserID != userID || subtle.ConstantTimeCompare([]byte(session.ResumeToken), []byte(resumeToken)) != 1 {
+		return nil, fmt.Errorf("invalid resume token")
+	}
+
+	if session.graceTimer != nil {
+		session.graceTimer.Stop()
+		session.graceTimer = nil
+	}
+	session.DisconnectedAt = nil
+	session.LastActivityAt = time.Now()
+
+	return &StreamingVoiceCallResponse{
+		SessionID:   session.ID,
+		ResumeToken: session.ResumeToken,
+		IsComplete:  false,
+		IsRecording: session.Recorder != nil,
+	}, nil
+}
+
+// IsSessionResumable 会话是否仍可接收消息（活跃中，可能处于断线宽限期）
+func (s *StreamingVoiceCallService) IsSessionResumable(sessionID string) bool {
+	s.mu.RLock()
+	session, exists := s.sessions[sessionID]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return session.IsActive
+}
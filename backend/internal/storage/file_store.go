@@ -0,0 +1,158 @@
+// Package storage 提供文件存储抽象，用于保存TTS缓存、通话录音等二进制文件
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound 文件不存在
+var ErrNotFound = errors.New("文件不存在")
+
+// FileStore 文件存储接口
+type FileStore interface {
+	// Put 保存文件，返回可供前端访问的URL
+	Put(key string, data []byte) (string, error)
+	// PutReader 从r流式写入文件，适合通话录音等较大的文件
+	PutReader(key string, r io.Reader) (string, error)
+	// Get 读取文件内容，不存在时返回ErrNotFound
+	Get(key string) ([]byte, error)
+	// Open 打开文件用于流式读取，不存在时返回ErrNotFound
+	Open(key string) (io.ReadCloser, error)
+	// Delete 删除文件，文件不存在时不报错
+	Delete(key string) error
+	// URL 返回文件的访问URL
+	URL(key string) string
+}
+
+// LocalFileStore 基于本地磁盘的文件存储
+type LocalFileStore struct {
+	rootDir string // 存储根目录
+	baseURL string // 对外访问的URL前缀
+}
+
+// NewLocalFileStore 创建本地文件存储实例
+func NewLocalFileStore(rootDir, baseURL string) (*LocalFileStore, error) {
+	if err := os.MkdirAll(rootDir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	return &LocalFileStore{
+		rootDir: rootDir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+// RootDir 返回存储根目录（用于注册静态文件路由）
+func (s *LocalFileStore) RootDir() string {
+	return s.rootDir
+}
+
+// Put 保存文件
+func (s *LocalFileStore) Put(key string, data []byte) (string, error) {
+	return s.PutReader(key, bytes.NewReader(data))
+}
+
+// PutReader 流式保存文件
+func (s *LocalFileStore) PutReader(key string, r io.Reader) (string, error) {
+	path, err := s.resolve(key)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	// 写入同目录下的唯一临时文件再重命名，避免读到写了一半的文件
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0o644); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("保存文件失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("保存文件失败: %w", err)
+	}
+
+	return s.URL(key), nil
+}
+
+// Get 读取文件
+func (s *LocalFileStore) Get(key string) ([]byte, error) {
+	path, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	return data, nil
+}
+
+// Open 打开文件
+func (s *LocalFileStore) Open(key string) (io.ReadCloser, error) {
+	path, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	return file, nil
+}
+
+// Delete 删除文件
+func (s *LocalFileStore) Delete(key string) error {
+	path, err := s.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除文件失败: %w", err)
+	}
+	return nil
+}
+
+// URL 返回文件访问URL
+func (s *LocalFileStore) URL(key string) string {
+	return s.baseURL + "/" + strings.TrimLeft(filepath.ToSlash(key), "/")
+}
+
+// resolve 将key转换为磁盘路径，拒绝跳出根目录的key
+func (s *LocalFileStore) resolve(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("无效的文件key: %q", key)
+	}
+	return filepath.Join(s.rootDir, cleaned), nil
+}
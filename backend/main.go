@@ -4,12 +4,14 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"seven-ai-backend/internal/config"
 	"seven-ai-backend/internal/database"
 	"seven-ai-backend/internal/handlers"
 	"seven-ai-backend/internal/middleware"
 	"seven-ai-backend/internal/services"
+	"seven-ai-backend/internal/storage"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -33,21 +35,105 @@ func main() {
 		cfg.AIModel,
 	)
 
+	// 初始化文件存储和TTS缓存
+	fileStore, err := storage.NewLocalFileStore(cfg.FileStorageDir, cfg.FileBaseURL)
+	if err != nil {
+		log.Fatal("文件存储初始化失败:", err)
+	}
+	aiService.SetTTSCache(services.NewTTSCache(cfg.TTSCacheSize, fileStore))
+	recordingStore, err := storage.NewLocalFileStore(cfg.RecordingDir, "")
+	if err != nil {
+		log.Fatal("录音存储初始化失败:", err)
+	}
+
 	// 初始化业务服务
 	userService := services.NewUserService(db, aiService)
 	characterService := services.NewCharacterService(db)
 	companionService := services.NewCompanionService(db, aiService)
+	companionService.SetSlotLimit(cfg.CompanionSlotLimit)
 	conversationService := services.NewConversationService(db, aiService)
+	conversationService.SetContextTokenBudget(cfg.ContextTokenBudget)
+	memoryService := services.NewMemoryService(db, aiService)
+	memoryService.SetRetrievalLimits(cfg.MemoryTopK, cfg.MemoryTokenBudget)
+	conversationService.SetMemoryService(memoryService)
+
+	// 语义检索：记忆和聊天记录的向量索引
+	var embedder services.Embedder
+	switch cfg.EmbeddingProvider {
+	case "remote":
+		embedder = services.NewRemoteEmbedder(cfg.EmbeddingAPIKey, cfg.EmbeddingBaseURL, cfg.EmbeddingModel)
+	case "hashing":
+		embedder = services.NewHashingEmbedder(cfg.EmbeddingDimensions)
+	case "":
+	default:
+		log.Printf("未知的向量模型类型 %q，语义检索未启用", cfg.EmbeddingProvider)
+	}
+	if embedder != nil {
+		vectorIndex := services.NewVectorIndex(db, embedder)
+		if err := vectorIndex.Load(); err != nil {
+			log.Printf("加载向量索引失败: %v", err)
+		}
+		vectorIndex.StartBackfill(cfg.EmbeddingBackfillInterval, cfg.EmbeddingBackfillBatch)
+		memoryService.SetVectorIndex(vectorIndex)
+		conversationService.SetVectorIndex(vectorIndex)
+	}
 	friendshipService := services.NewFriendshipService(db, aiService)
+
+	// 实时事件推送（新消息、升级、情绪变化、日记、好友）
+	eventHub := services.NewEventHub()
+	eventHub.StartJanitor(time.Minute)
+	conversationService.SetEventHub(eventHub)
+	friendshipService.SetEventHub(eventHub)
+	companionService.SetEventHub(eventHub)
+
+	groupChatService := services.NewGroupChatService(db, aiService, conversationService)
+	groupChatService.SetEventHub(eventHub)
 	streamingVoiceCallService := services.NewStreamingVoiceCallService(aiService, db)
+	streamingVoiceCallService.SetConversationService(conversationService)
+	streamingVoiceCallService.SetRecordingStore(recordingStore)
+	streamingVoiceCallService.SetResumeGracePeriod(cfg.VoiceSessionResumeGrace)
+	streamingVoiceCallService.StartSessionJanitor(time.Minute, cfg.VoiceSessionIdleTimeout, cfg.VoiceSessionRetention)
+	streamingVoiceCallService.StartRecordingRetentionJanitor(time.Hour)
+
+	// 角色主动消息（早安、跟进、久未聊天问候）
+	if cfg.ProactiveMessagesEnabled {
+		proactiveMessageService := services.NewProactiveMessageService(db, aiService, conversationService)
+		proactiveMessageService.SetLimits(services.ProactiveLimits{
+			MaxPerCharacterPerDay: cfg.ProactiveMaxPerCharacterDay,
+			MaxPerUserPerDay:      cfg.ProactiveMaxPerUserDay,
+			InactivityThreshold:   cfg.ProactiveInactivityThreshold,
+		})
+		proactiveMessageService.Start(cfg.ProactiveCheckInterval)
+	}
+
+	// AI伙伴每日日记（手动补写接口不受开关影响）
+	diaryService := services.NewDiaryService(db, aiService, conversationService)
+	diaryService.SetEventHub(eventHub)
+	diaryService.SetBackfillDays(cfg.DiaryBackfillDays)
+	if cfg.DiaryEnabled {
+		diaryService.Start(cfg.DiaryCheckInterval)
+	}
+
+	// 后台预热TTS缓存（打招呼语、噪音响应）
+	if cfg.TTSCachePrewarm {
+		go func() {
+			if err := streamingVoiceCallService.PrewarmTTSCache(); err != nil {
+				log.Printf("TTS缓存预热失败: %v", err)
+			}
+		}()
+	}
 
 	// 初始化请求处理器
 	userHandler := handlers.NewUserHandler(userService)
 	characterHandler := handlers.NewCharacterHandler(characterService)
 	companionHandler := handlers.NewCompanionHandler(companionService)
+	memoryHandler := handlers.NewMemoryHandler(memoryService)
+	diaryHandler := handlers.NewDiaryHandler(diaryService)
 	conversationHandler := handlers.NewConversationHandler(conversationService)
 	friendshipHandler := handlers.NewFriendshipHandler(friendshipService)
 	streamingVoiceCallHandler := handlers.NewStreamingVoiceCallHandler(streamingVoiceCallService)
+	eventHandler := handlers.NewEventHandler(eventHub)
+	groupChatHandler := handlers.NewGroupChatHandler(groupChatService)
 
 	// 设置路由
 	r := gin.Default()
@@ -77,6 +163,8 @@ func main() {
 			users.POST("/reset-password", userHandler.ResetPassword)
 			users.GET("/profile", middleware.AuthRequired(), userHandler.GetProfile)
 			users.PUT("/profile", middleware.AuthRequired(), userHandler.UpdateProfile)
+			users.GET("/preferences", middleware.AuthRequired(), userHandler.GetPreferences)
+			users.PUT("/preferences", middleware.AuthRequired(), userHandler.UpdatePreferences)
 		}
 
 		// 预设角色相关
@@ -93,11 +181,21 @@ func main() {
 		{
 			companions.POST("", companionHandler.CreateCompanion)
 			companions.GET("", companionHandler.GetUserCompanions)
+			companions.GET("/default", companionHandler.GetDefaultCompanion)
 			companions.GET("/:id", companionHandler.GetCompanion)
 			companions.PUT("/:id", companionHandler.UpdateCompanion)
+			companions.PUT("/:id/default", companionHandler.SetDefaultCompanion)
+			companions.POST("/:id/archive", companionHandler.ArchiveCompanion)
+			companions.POST("/:id/restore", companionHandler.RestoreCompanion)
 			companions.GET("/:id/growth", companionHandler.GetGrowthStatus)
+			companions.GET("/:id/growth/events", companionHandler.GetGrowthEvents)
 			companions.GET("/:id/diary", companionHandler.GetDiary)
+			companions.POST("/:id/diary/backfill", diaryHandler.BackfillDiaries)
 			companions.GET("/:id/emotion", companionHandler.GetEmotionState)
+			companions.GET("/:id/emotion/history", companionHandler.GetEmotionHistory)
+			companions.GET("/:id/memories", memoryHandler.ListMemories)
+			companions.PUT("/:id/memories/:memoryId", memoryHandler.UpdateMemory)
+			companions.DELETE("/:id/memories/:memoryId", memoryHandler.DeleteMemory)
 		}
 
 		// 对话相关
@@ -108,7 +206,21 @@ func main() {
 			conversations.POST("/voice-chat", conversationHandler.VoiceChat)
 			conversations.POST("/image-chat", conversationHandler.ImageChat)
 			conversations.GET("/history", conversationHandler.GetHistory)
+			conversations.GET("/search", conversationHandler.SearchConversations)
+			conversations.GET("/export", conversationHandler.ExportConversations)
+			conversations.POST("/read", conversationHandler.MarkAsRead)
+			conversations.GET("/unread", conversationHandler.GetUnreadCounts)
+			conversations.POST("/sessions", conversationHandler.CreateSession)
+			conversations.GET("/sessions", conversationHandler.ListSessions)
 			conversations.GET("/sessions/:sessionId", conversationHandler.GetSessionHistory)
+			conversations.PUT("/sessions/:sessionId", conversationHandler.UpdateSession)
+			conversations.DELETE("/sessions/:sessionId", conversationHandler.DeleteSession)
+			conversations.PUT("/messages/:messageId", conversationHandler.EditMessage)
+			conversations.DELETE("/messages/:messageId", conversationHandler.DeleteMessage)
+			conversations.POST("/messages/:messageId/regenerate", conversationHandler.RegenerateReply)
+			conversations.GET("/messages/:messageId/alternatives", conversationHandler.GetMessageAlternatives)
+			conversations.PUT("/messages/:messageId/alternatives/:replyId", conversationHandler.SelectReply)
+			conversations.GET("/messages/:messageId/memories", conversationHandler.GetMessageMemories)
 		}
 
 		// 好友关系相关
@@ -121,7 +233,18 @@ func main() {
 			friendships.DELETE("/:character_id", friendshipHandler.RemoveFriend)
 		}
 
-		// 流式语音通话相关
+		// 多角色群聊
+		groupChats := api.Group("/group-chats")
+		groupChats.Use(middleware.AuthRequired())
+		{
+			groupChats.POST("", groupChatHandler.CreateGroupChat)
+			groupChats.GET("", groupChatHandler.ListGroupChats)
+			groupChats.GET("/:groupId", groupChatHandler.GetGroupChat)
+			groupChats.DELETE("/:groupId", groupChatHandler.DeleteGroupChat)
+			groupChats.GET("/:groupId/messages", groupChatHandler.GetGroupMessages)
+			groupChats.POST("/:groupId/messages", groupChatHandler.SendGroupMessage)
+		}
+
 		streamingVoiceCalls := api.Group("/streaming-voice-calls")
 		// WebSocket连接不需要认证中间件，通过查询参数传递token
 		{
@@ -129,6 +252,13 @@ func main() {
 			streamingVoiceCalls.GET("/status/:sessionId", middleware.AuthRequired(), streamingVoiceCallHandler.GetSessionStatus)
 			streamingVoiceCalls.POST("/first-call", streamingVoiceCallHandler.HandleFirstCall)
 		}
+
+		// 语音通话记录
+		api.GET("/voice-calls", middleware.AuthRequired(), streamingVoiceCallHandler.GetCallHistory)
+		api.GET("/voice-calls/:callId/recording", middleware.AuthRequired(), streamingVoiceCallHandler.GetCallRecording)
+
+		// 实时事件流，WebSocket连接通过X-User-ID请求头或user_id查询参数认证
+		api.GET("/events/ws", eventHandler.HandleWebSocket)
 	}
 
 	// 健康检查
@@ -136,6 +266,22 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// 内部监控接口单独监听，不暴露在公开端口上
+	if cfg.MetricsAddr != "" {
+		metrics := gin.New()
+		metrics.Use(gin.Recovery())
+		// TTS缓存命中统计
+		metrics.GET("/metrics/tts-cache", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"tts_cache": aiService.TTSCacheStats()})
+		})
+		go func() {
+			log.Printf("监控接口启动在 %s", cfg.MetricsAddr)
+			if err := metrics.Run(cfg.MetricsAddr); err != nil {
+				log.Printf("监控接口启动失败: %v", err)
+			}
+		}()
+	}
+
 	// 启动服务器
 	log.Printf("服务器启动在端口 %s", cfg.Port)
 	if err := r.Run(":" + cfg.Port); err != nil {
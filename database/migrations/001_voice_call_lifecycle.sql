@@ -0,0 +1,19 @@
+-- 语音通话生命周期记录（已有数据库执行此脚本，新库直接使用 schema.sql）
+
+ALTER TABLE voice_calls
+    ADD COLUMN session_id VARCHAR(100) AFTER companion_id,
+    ADD COLUMN answered_at TIMESTAMP NULL AFTER started_at,
+    MODIFY COLUMN ended_at TIMESTAMP NULL,
+    ADD INDEX idx_voice_calls_user (user_id, started_at);
+
+CREATE TABLE voice_call_turns (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    voice_call_id INT NOT NULL,
+    asr_ms INT DEFAULT 0,                -- 语音识别耗时（毫秒）
+    llm_ms INT DEFAULT 0,                -- 大模型回复耗时（毫秒）
+    tts_ms INT DEFAULT 0,                -- 语音合成耗时（毫秒）
+    total_ms INT DEFAULT 0,              -- 整轮耗时（毫秒）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (voice_call_id) REFERENCES voice_calls(id) ON DELETE CASCADE
+);
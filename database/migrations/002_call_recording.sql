@@ -0,0 +1,8 @@
+-- 通话录音：用户可配置的录音保留期限
+
+ALTER TABLE user_preferences
+    ADD COLUMN recording_retention_days INT DEFAULT 30 AFTER language_preference; -- 通话录音保留天数（0表示永久保留）
+
+ALTER TABLE user_files
+    MODIFY COLUMN expires_at TIMESTAMP NULL,
+    ADD INDEX idx_user_files_expires (expires_at);
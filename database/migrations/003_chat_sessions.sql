@@ -0,0 +1,34 @@
+-- 聊天会话：服务端管理的会话实体
+
+CREATE TABLE chat_sessions (
+    id VARCHAR(100) PRIMARY KEY,         -- 会话ID，与conversations.session_id对应
+    user_id INT NOT NULL,
+    character_id INT NOT NULL,           -- 角色ID（AI伙伴为5）
+    companion_id INT,                    -- AI伙伴ID
+    title VARCHAR(100) DEFAULT '',       -- 会话标题（第一轮对话后自动生成）
+    is_archived BOOLEAN DEFAULT FALSE,   -- 是否已归档
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_active_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_chat_sessions_user (user_id, character_id, last_active_at)
+);
+
+ALTER TABLE conversations
+    ADD INDEX idx_conversations_session (user_id, session_id, created_at);
+
+-- 没有session_id的历史消息按用户和角色归入一个历史会话
+UPDATE conversations
+SET session_id = CONCAT('legacy_', user_id, '_', character_id)
+WHERE session_id = '' AND character_id IS NOT NULL;
+
+-- 为已有的session_id建档（同一ID被多个用户使用时只归属最早的用户）
+INSERT IGNORE INTO chat_sessions (id, user_id, character_id, companion_id, title, created_at, last_active_at)
+SELECT c.session_id, c.user_id, MIN(c.character_id), MAX(c.companion_id),
+       LEFT(SUBSTRING_INDEX(MIN(CONCAT(c.created_at, '\t', c.user_message)), '\t', -1), 20),
+       MIN(c.created_at), MAX(c.created_at)
+FROM conversations c
+WHERE c.session_id <> '' AND c.character_id IS NOT NULL
+GROUP BY c.session_id, c.user_id
+ORDER BY MIN(c.created_at);
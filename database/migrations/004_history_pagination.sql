@@ -0,0 +1,6 @@
+-- 聊天记录游标分页：按(created_at, id)排序的复合索引
+
+ALTER TABLE conversations
+    ADD INDEX idx_conversations_character (user_id, character_id, created_at, id),
+    DROP INDEX idx_conversations_session,
+    ADD INDEX idx_conversations_session (user_id, session_id, created_at, id);
@@ -0,0 +1,4 @@
+-- 聊天记录全文搜索：使用ngram分词支持中文（需要MySQL 5.7.6+，默认ngram_token_size=2）
+
+ALTER TABLE conversations
+    ADD FULLTEXT INDEX ft_conversations_content (user_message, ai_response) WITH PARSER ngram;
@@ -0,0 +1,16 @@
+-- 消息重新生成、编辑和软删除
+
+ALTER TABLE conversations
+    ADD COLUMN selected_reply_id INT AFTER is_read,   -- 当前选中的AI回复候选（conversation_replies.id）
+    ADD COLUMN edited_at TIMESTAMP NULL AFTER selected_reply_id,  -- 用户消息编辑时间
+    ADD COLUMN deleted_at TIMESTAMP NULL AFTER edited_at;         -- 软删除时间
+
+CREATE TABLE conversation_replies (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    conversation_id INT NOT NULL,
+    ai_response TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    INDEX idx_conversation_replies (conversation_id, id)
+);
@@ -0,0 +1,13 @@
+-- 上下文token预算与滚动摘要
+
+CREATE TABLE conversation_summaries (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    character_id INT NOT NULL,
+    summary TEXT NOT NULL,               -- 被挤出上下文的早期对话摘要
+    summarized_until_id INT NOT NULL DEFAULT 0,  -- 摘要覆盖到的最后一条conversations.id
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_conversation_summaries (user_id, character_id)
+);
@@ -0,0 +1,22 @@
+-- 角色主动消息：免打扰时段、时区和发送记录
+
+ALTER TABLE user_preferences
+    ADD COLUMN quiet_hours_start TINYINT DEFAULT 22 AFTER recording_retention_days,  -- 免打扰开始时间（小时）
+    ADD COLUMN quiet_hours_end TINYINT DEFAULT 8 AFTER quiet_hours_start,           -- 免打扰结束时间（小时），与开始相同表示不启用
+    ADD COLUMN timezone VARCHAR(50) DEFAULT 'Asia/Shanghai' AFTER quiet_hours_end;  -- 用户所在时区
+
+CREATE TABLE proactive_messages (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    character_id INT NOT NULL,
+    conversation_id INT NOT NULL,        -- 生成的消息（conversations.id）
+    kind VARCHAR(20) NOT NULL,           -- morning_greeting/follow_up/check_in
+    source_conversation_id INT,          -- 跟进的用户消息
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    INDEX idx_proactive_user (user_id, created_at),
+    INDEX idx_proactive_character (user_id, character_id, created_at),
+    INDEX idx_proactive_source (source_conversation_id)
+);
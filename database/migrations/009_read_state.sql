@@ -0,0 +1,7 @@
+-- 消息已读状态与未读计数
+
+-- 用户主动发起的对话回复随请求返回，视为已读；只有AI主动发来的消息保持未读
+UPDATE conversations SET is_read = TRUE WHERE is_ai_initiated = FALSE;
+
+ALTER TABLE conversations
+    ADD INDEX idx_conversations_unread (user_id, is_read, character_id);
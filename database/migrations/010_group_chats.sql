@@ -0,0 +1,33 @@
+-- 多角色群聊
+
+CREATE TABLE group_chats (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    title VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_active_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_group_chats_user (user_id, last_active_at)
+);
+
+CREATE TABLE group_chat_members (
+    group_id INT NOT NULL,
+    character_id INT NOT NULL,           -- 预设角色ID（AI伙伴为5）
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    PRIMARY KEY (group_id, character_id),
+    FOREIGN KEY (group_id) REFERENCES group_chats(id) ON DELETE CASCADE
+);
+
+CREATE TABLE group_messages (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    group_id INT NOT NULL,
+    speaker_type ENUM('user', 'character') NOT NULL,
+    character_id INT,                    -- 发言角色ID，用户发言时为空
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (group_id) REFERENCES group_chats(id) ON DELETE CASCADE,
+    INDEX idx_group_messages_group (group_id, id)
+);
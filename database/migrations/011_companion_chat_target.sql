@@ -0,0 +1,78 @@
+-- AI伙伴作为独立的聊天对象：以companion_id标识，不再占用character_id = 5
+-- 迁移时每个用户最多只有一个AI伙伴，按user_id即可找到对应的companion_id
+
+-- 对话记录
+UPDATE conversations c
+JOIN ai_companions ac ON ac.user_id = c.user_id
+SET c.companion_id = ac.id
+WHERE c.character_id = 5 AND c.companion_id IS NULL;
+
+UPDATE conversations SET character_id = NULL
+WHERE character_id = 5 AND companion_id IS NOT NULL;
+
+ALTER TABLE conversations
+    ADD INDEX idx_conversations_companion (user_id, companion_id, created_at, id);
+
+-- 聊天会话
+ALTER TABLE chat_sessions
+    MODIFY character_id INT NULL;
+
+UPDATE chat_sessions cs
+JOIN ai_companions ac ON ac.user_id = cs.user_id
+SET cs.companion_id = ac.id
+WHERE cs.character_id = 5 AND cs.companion_id IS NULL;
+
+UPDATE chat_sessions SET character_id = NULL
+WHERE character_id = 5 AND companion_id IS NOT NULL;
+
+ALTER TABLE chat_sessions
+    ADD INDEX idx_chat_sessions_companion (user_id, companion_id, last_active_at);
+
+-- 滚动摘要：未使用的一列记为0，以便参与唯一键
+ALTER TABLE conversation_summaries
+    MODIFY character_id INT NOT NULL DEFAULT 0,
+    ADD COLUMN companion_id INT NOT NULL DEFAULT 0 AFTER character_id;
+
+UPDATE conversation_summaries s
+JOIN ai_companions ac ON ac.user_id = s.user_id
+SET s.companion_id = ac.id, s.character_id = 0
+WHERE s.character_id = 5;
+
+ALTER TABLE conversation_summaries
+    DROP INDEX uk_conversation_summaries,
+    ADD UNIQUE KEY uk_conversation_summaries (user_id, character_id, companion_id);
+
+-- 主动消息记录
+ALTER TABLE proactive_messages
+    MODIFY character_id INT NULL,
+    ADD COLUMN companion_id INT NULL AFTER character_id,
+    ADD INDEX idx_proactive_companion (user_id, companion_id, created_at);
+
+UPDATE proactive_messages pm
+JOIN ai_companions ac ON ac.user_id = pm.user_id
+SET pm.companion_id = ac.id, pm.character_id = NULL
+WHERE pm.character_id = 5;
+
+-- 群聊成员：改用自增主键，成员为预设角色或AI伙伴之一
+ALTER TABLE group_chat_members
+    DROP PRIMARY KEY,
+    ADD COLUMN id INT PRIMARY KEY AUTO_INCREMENT FIRST,
+    MODIFY character_id INT NULL,
+    ADD COLUMN companion_id INT NULL AFTER character_id,
+    ADD UNIQUE KEY uk_group_chat_members (group_id, character_id, companion_id);
+
+UPDATE group_chat_members m
+JOIN group_chats g ON g.id = m.group_id
+JOIN ai_companions ac ON ac.user_id = g.user_id
+SET m.companion_id = ac.id, m.character_id = NULL
+WHERE m.character_id = 5;
+
+-- 群聊消息
+ALTER TABLE group_messages
+    ADD COLUMN companion_id INT NULL AFTER character_id;
+
+UPDATE group_messages gm
+JOIN group_chats g ON g.id = gm.group_id
+JOIN ai_companions ac ON ac.user_id = g.user_id
+SET gm.companion_id = ac.id, gm.character_id = NULL
+WHERE gm.character_id = 5;
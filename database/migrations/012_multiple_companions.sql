@@ -0,0 +1,8 @@
+-- 每个用户可拥有多个AI伙伴：默认伙伴与归档
+ALTER TABLE ai_companions
+    ADD COLUMN is_default BOOLEAN DEFAULT FALSE AFTER is_growth_completed,
+    ADD COLUMN archived_at TIMESTAMP NULL AFTER is_default,
+    ADD INDEX idx_ai_companions_user (user_id, archived_at, is_default);
+
+-- 迁移前每个用户最多一个AI伙伴，直接设为默认伙伴
+UPDATE ai_companions SET is_default = TRUE;
@@ -0,0 +1,8 @@
+-- 结构化长期记忆：对话后自动提取、去重合并，用户可修正和删除
+ALTER TABLE memory_fragments
+    ADD COLUMN mention_count INT DEFAULT 1 AFTER tags,
+    ADD COLUMN is_user_edited BOOLEAN DEFAULT FALSE AFTER mention_count,
+    ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP AFTER created_at,
+    ADD INDEX idx_memory_fragments_companion (companion_id, importance_score, updated_at);
+
+UPDATE memory_fragments SET updated_at = created_at;
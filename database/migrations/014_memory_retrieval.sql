@@ -0,0 +1,17 @@
+-- 记录每条AI伙伴回复使用了哪些记忆，用于调试检索效果
+-- 保存检索时的记忆内容快照，记忆之后被修改或删除也能看到当时的依据
+CREATE TABLE conversation_memories (
+    conversation_id INT NOT NULL,
+    memory_id INT NOT NULL,
+    memory_rank INT NOT NULL,            -- 在提示词中的顺序
+    memory_type VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    relevance DECIMAL(6,4) DEFAULT 0,    -- 与用户消息的相关度
+    importance DECIMAL(6,4) DEFAULT 0,
+    recency DECIMAL(6,4) DEFAULT 0,
+    score DECIMAL(6,4) DEFAULT 0,        -- 综合得分
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    PRIMARY KEY (conversation_id, memory_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+);
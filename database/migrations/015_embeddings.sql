@@ -0,0 +1,15 @@
+-- 记忆片段和聊天记录的向量，服务启动时加载到内存索引
+-- model记录生成向量的模型，content_hash用于发现内容变化，两者不一致时由后台任务重建
+CREATE TABLE embeddings (
+    kind VARCHAR(20) NOT NULL,           -- conversation 或 memory
+    ref_id INT NOT NULL,                 -- conversations.id 或 memory_fragments.id
+    owner_id INT NOT NULL,               -- 对话为user_id，记忆为companion_id
+    model VARCHAR(100) NOT NULL,
+    dims INT NOT NULL,
+    content_hash CHAR(32) NOT NULL,      -- 向量化文本的MD5
+    vector MEDIUMBLOB NOT NULL,          -- 小端float32数组
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    
+    PRIMARY KEY (kind, ref_id),
+    INDEX idx_embeddings_owner (kind, owner_id)
+);
@@ -0,0 +1,4 @@
+-- 技能随使用次数升级
+ALTER TABLE companion_skills
+    ADD COLUMN use_count INT NOT NULL DEFAULT 0 AFTER skill_level,
+    ADD COLUMN last_used_at TIMESTAMP NULL AFTER use_count;
@@ -0,0 +1,26 @@
+-- AI伙伴的情绪状态（效价-唤醒度模型），读取时按时间向平静回落
+CREATE TABLE companion_emotion_states (
+    companion_id INT PRIMARY KEY,
+    emotion VARCHAR(20) NOT NULL,        -- 情绪类型
+    intensity DECIMAL(5,3) NOT NULL,     -- 强度 (0-1)
+    valence DECIMAL(5,3) NOT NULL,       -- 效价 (-1 ~ 1)
+    arousal DECIMAL(5,3) NOT NULL,       -- 唤醒度 (0 ~ 1)
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE
+);
+
+-- AI伙伴情绪变化记录，用于绘制情绪曲线
+CREATE TABLE companion_emotion_history (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    companion_id INT NOT NULL,
+    emotion VARCHAR(20) NOT NULL,        -- 更新后的情绪类型
+    stimulus VARCHAR(20) NOT NULL,       -- 引起变化的消息情绪
+    intensity DECIMAL(5,3) NOT NULL,
+    valence DECIMAL(5,3) NOT NULL,
+    arousal DECIMAL(5,3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_emotion_history_companion (companion_id, created_at)
+);
@@ -0,0 +1,17 @@
+-- 统一成长引擎：按成长模式的经验曲线重新计算已有AI伙伴的等级、成长进度和完成状态
+-- 曲线与 internal/growth/curve.go 保持一致
+-- growth_percentage 改为整体成长进度（之前部分数据为当前等级内的进度）
+-- 旧规则下已完成成长（1000经验即完成）的AI伙伴保持完成状态：经验补足到新曲线的完成经验，
+-- 等级和进度随之为满级和100，之后成长引擎按经验重新计算时也不会回退
+-- MySQL按书写顺序执行SET，后面的赋值使用前面已更新的值
+UPDATE ai_companions
+SET is_growth_completed = is_growth_completed OR total_experience >= CASE growth_mode WHEN 'short' THEN 1650 ELSE 5500 END,
+    total_experience = CASE
+        WHEN is_growth_completed THEN GREATEST(total_experience, CASE growth_mode WHEN 'short' THEN 1650 ELSE 5500 END)
+        ELSE total_experience
+    END,
+    current_level = CASE growth_mode
+        WHEN 'short' THEN 1 + (total_experience >= 30) + (total_experience >= 90) + (total_experience >= 180) + (total_experience >= 300) + (total_experience >= 450) + (total_experience >= 630) + (total_experience >= 840) + (total_experience >= 1080) + (total_experience >= 1350) + (total_experience >= 1650)
+        ELSE 1 + (total_experience >= 100) + (total_experience >= 300) + (total_experience >= 600) + (total_experience >= 1000) + (total_experience >= 1500) + (total_experience >= 2100) + (total_experience >= 2800) + (total_experience >= 3600) + (total_experience >= 4500) + (total_experience >= 5500)
+    END,
+    growth_percentage = LEAST(100, GREATEST(total_experience, 0) * 100.0 / CASE growth_mode WHEN 'short' THEN 1650 ELSE 5500 END);
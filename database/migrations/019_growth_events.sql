@@ -0,0 +1,17 @@
+-- AI伙伴成长事件日志：记录每轮对话的经验结算和能力变化，以及质量分、重复检测、
+-- 每日递减和能力冷却带来的调整，同时作为每日递减和冷却的统计依据
+CREATE TABLE companion_growth_events (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    companion_id INT NOT NULL,
+    event_type VARCHAR(20) NOT NULL,                  -- experience 或 ability
+    ability VARCHAR(30) NULL,                         -- 能力事件对应的能力
+    base_value INT NOT NULL DEFAULT 0,                -- 调整前的增量
+    final_value INT NOT NULL DEFAULT 0,               -- 实际生效的增量
+    quality_score DECIMAL(4,3) NOT NULL DEFAULT 0,    -- 对话质量分 (0-1)
+    daily_multiplier DECIMAL(4,3) NOT NULL DEFAULT 0, -- 每日边际递减系数，能力事件为0
+    reasons TEXT,                                     -- 调整原因（JSON数组）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_growth_events_companion (companion_id, event_type, created_at)
+);
@@ -45,7 +45,7 @@ CREATE TABLE ai_companions (
     -- 成长相关
     total_experience INT DEFAULT 0,      -- 总经验值
     current_level INT DEFAULT 1,         -- 当前等级
-    growth_percentage DECIMAL(5,2) DEFAULT 0.00, -- 成长进度百分比
+    growth_percentage DECIMAL(5,2) DEFAULT 0.00, -- 整体成长进度百分比（按成长模式的经验曲线计算）
     growth_mode ENUM('short', 'long') DEFAULT 'short', -- 成长模式
     
     -- 个性化设置
@@ -57,11 +57,14 @@ CREATE TABLE ai_companions (
     
     -- 状态
     is_growth_completed BOOLEAN DEFAULT FALSE, -- 是否完成成长
+    is_default BOOLEAN DEFAULT FALSE,    -- 是否为默认AI伙伴
+    archived_at TIMESTAMP NULL,          -- 归档时间，归档后不占名额
     last_active_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     
+    INDEX idx_ai_companions_user (user_id, archived_at, is_default),
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
@@ -83,11 +86,94 @@ CREATE TABLE conversations (
     experience_gained INT DEFAULT 0,    -- 本次对话获得的经验
     is_ai_initiated BOOLEAN DEFAULT FALSE, -- 是否为AI主动发起的消息
     is_read BOOLEAN DEFAULT FALSE,      -- 消息是否已读
+    selected_reply_id INT,              -- 当前选中的AI回复候选（conversation_replies.id）
+    edited_at TIMESTAMP NULL,           -- 用户消息编辑时间
+    deleted_at TIMESTAMP NULL,          -- 软删除时间
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (character_id) REFERENCES preset_characters(id) ON DELETE CASCADE,
-    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_conversations_character (user_id, character_id, created_at, id),
+    INDEX idx_conversations_companion (user_id, companion_id, created_at, id),
+    INDEX idx_conversations_session (user_id, session_id, created_at, id),
+    INDEX idx_conversations_unread (user_id, is_read, character_id),
+    FULLTEXT INDEX ft_conversations_content (user_message, ai_response) WITH PARSER ngram
+);
+
+-- AI回复候选表（重新生成时保留之前的回复）
+CREATE TABLE conversation_replies (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    conversation_id INT NOT NULL,
+    ai_response TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    INDEX idx_conversation_replies (conversation_id, id)
+);
+
+-- AI伙伴回复使用的记忆（检索时的内容快照，用于调试检索效果）
+CREATE TABLE conversation_memories (
+    conversation_id INT NOT NULL,
+    memory_id INT NOT NULL,
+    memory_rank INT NOT NULL,            -- 在提示词中的顺序
+    memory_type VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    relevance DECIMAL(6,4) DEFAULT 0,    -- 与用户消息的相关度
+    importance DECIMAL(6,4) DEFAULT 0,
+    recency DECIMAL(6,4) DEFAULT 0,
+    score DECIMAL(6,4) DEFAULT 0,        -- 综合得分
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    PRIMARY KEY (conversation_id, memory_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+);
+
+-- 记忆片段和聊天记录的向量，服务启动时加载到内存索引
+-- model记录生成向量的模型，content_hash用于发现内容变化，两者不一致时由后台任务重建
+CREATE TABLE embeddings (
+    kind VARCHAR(20) NOT NULL,           -- conversation 或 memory
+    ref_id INT NOT NULL,                 -- conversations.id 或 memory_fragments.id
+    owner_id INT NOT NULL,               -- 对话为user_id，记忆为companion_id
+    model VARCHAR(100) NOT NULL,
+    dims INT NOT NULL,
+    content_hash CHAR(32) NOT NULL,      -- 向量化文本的MD5
+    vector MEDIUMBLOB NOT NULL,          -- 小端float32数组
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    
+    PRIMARY KEY (kind, ref_id),
+    INDEX idx_embeddings_owner (kind, owner_id)
+);
+
+-- 对话滚动摘要表（超出上下文预算的早期对话）
+CREATE TABLE conversation_summaries (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    character_id INT NOT NULL DEFAULT 0, -- 预设角色ID，AI伙伴的摘要为0
+    companion_id INT NOT NULL DEFAULT 0, -- AI伙伴ID，预设角色的摘要为0
+    summary TEXT NOT NULL,               -- 被挤出上下文的早期对话摘要
+    summarized_until_id INT NOT NULL DEFAULT 0,  -- 摘要覆盖到的最后一条conversations.id
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_conversation_summaries (user_id, character_id, companion_id)
+);
+
+-- 聊天会话表
+CREATE TABLE chat_sessions (
+    id VARCHAR(100) PRIMARY KEY,         -- 会话ID，与conversations.session_id对应
+    user_id INT NOT NULL,
+    character_id INT,                    -- 预设角色ID
+    companion_id INT,                    -- AI伙伴ID
+    title VARCHAR(100) DEFAULT '',       -- 会话标题（第一轮对话后自动生成）
+    is_archived BOOLEAN DEFAULT FALSE,   -- 是否已归档
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_active_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_chat_sessions_user (user_id, character_id, last_active_at),
+    INDEX idx_chat_sessions_companion (user_id, companion_id, last_active_at)
 );
 
 -- 记忆片段表
@@ -98,8 +184,12 @@ CREATE TABLE memory_fragments (
     content TEXT NOT NULL,
     importance_score INT DEFAULT 5,     -- 重要性评分 (1-10)
     tags JSON,                          -- 标签
+    mention_count INT DEFAULT 1,        -- 被对话提及（合并）的次数
+    is_user_edited BOOLEAN DEFAULT FALSE, -- 用户修正过，自动提取不再改写内容
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     
+    INDEX idx_memory_fragments_companion (companion_id, importance_score, updated_at),
     FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE
 );
 
@@ -109,12 +199,58 @@ CREATE TABLE companion_skills (
     companion_id INT NOT NULL,
     skill_name VARCHAR(100) NOT NULL,
     skill_level INT DEFAULT 1,          -- 技能等级 (1-10)
+    use_count INT NOT NULL DEFAULT 0,   -- 使用次数，每5次升一级
+    last_used_at TIMESTAMP NULL,
     unlocked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     
     FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
     UNIQUE KEY unique_skill (companion_id, skill_name)
 );
 
+-- AI伙伴的情绪状态（效价-唤醒度模型），读取时按时间向平静回落
+CREATE TABLE companion_emotion_states (
+    companion_id INT PRIMARY KEY,
+    emotion VARCHAR(20) NOT NULL,        -- 情绪类型
+    intensity DECIMAL(5,3) NOT NULL,     -- 强度 (0-1)
+    valence DECIMAL(5,3) NOT NULL,       -- 效价 (-1 ~ 1)
+    arousal DECIMAL(5,3) NOT NULL,       -- 唤醒度 (0 ~ 1)
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE
+);
+
+-- AI伙伴情绪变化记录，用于绘制情绪曲线
+CREATE TABLE companion_emotion_history (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    companion_id INT NOT NULL,
+    emotion VARCHAR(20) NOT NULL,        -- 更新后的情绪类型
+    stimulus VARCHAR(20) NOT NULL,       -- 引起变化的消息情绪
+    intensity DECIMAL(5,3) NOT NULL,
+    valence DECIMAL(5,3) NOT NULL,
+    arousal DECIMAL(5,3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_emotion_history_companion (companion_id, created_at)
+);
+
+-- AI伙伴成长事件日志（经验结算和能力变化及其防刷调整）
+CREATE TABLE companion_growth_events (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    companion_id INT NOT NULL,
+    event_type VARCHAR(20) NOT NULL,                  -- experience 或 ability
+    ability VARCHAR(30) NULL,                         -- 能力事件对应的能力
+    base_value INT NOT NULL DEFAULT 0,                -- 调整前的增量
+    final_value INT NOT NULL DEFAULT 0,               -- 实际生效的增量
+    quality_score DECIMAL(4,3) NOT NULL DEFAULT 0,    -- 对话质量分 (0-1)
+    daily_multiplier DECIMAL(4,3) NOT NULL DEFAULT 0, -- 每日边际递减系数，能力事件为0
+    reasons TEXT,                                     -- 调整原因（JSON数组）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_growth_events_companion (companion_id, event_type, created_at)
+);
+
 -- 日记表
 CREATE TABLE companion_diaries (
     id INT PRIMARY KEY AUTO_INCREMENT,
@@ -138,6 +274,10 @@ CREATE TABLE user_preferences (
     auto_save_memories BOOLEAN DEFAULT TRUE,
     notification_enabled BOOLEAN DEFAULT TRUE,
     language_preference VARCHAR(10) DEFAULT 'zh-CN',
+    recording_retention_days INT DEFAULT 30, -- 通话录音保留天数（0表示永久保留）
+    quiet_hours_start TINYINT DEFAULT 22,    -- 免打扰开始时间（小时）
+    quiet_hours_end TINYINT DEFAULT 8,       -- 免打扰结束时间（小时），与开始相同表示不启用
+    timezone VARCHAR(50) DEFAULT 'Asia/Shanghai', -- 用户所在时区
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     
@@ -159,22 +299,95 @@ CREATE TABLE user_friendships (
     UNIQUE KEY unique_friendship (user_id, character_id)
 );
 
+-- 角色主动消息记录表（用于频率限制和避免重复跟进）
+CREATE TABLE proactive_messages (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    character_id INT,                    -- 预设角色ID
+    companion_id INT,                    -- AI伙伴ID
+    conversation_id INT NOT NULL,        -- 生成的消息（conversations.id）
+    kind VARCHAR(20) NOT NULL,           -- morning_greeting/follow_up/check_in
+    source_conversation_id INT,          -- 跟进的用户消息
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    INDEX idx_proactive_user (user_id, created_at),
+    INDEX idx_proactive_character (user_id, character_id, created_at),
+    INDEX idx_proactive_companion (user_id, companion_id, created_at),
+    INDEX idx_proactive_source (source_conversation_id)
+);
+
+-- 群聊表（用户与多个角色的群聊）
+CREATE TABLE group_chats (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    title VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_active_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_group_chats_user (user_id, last_active_at)
+);
+
+-- 群聊成员表
+CREATE TABLE group_chat_members (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    group_id INT NOT NULL,
+    character_id INT,                    -- 预设角色ID
+    companion_id INT,                    -- AI伙伴ID
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    UNIQUE KEY uk_group_chat_members (group_id, character_id, companion_id),
+    FOREIGN KEY (group_id) REFERENCES group_chats(id) ON DELETE CASCADE
+);
+
+-- 群聊消息表
+CREATE TABLE group_messages (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    group_id INT NOT NULL,
+    speaker_type ENUM('user', 'character') NOT NULL,
+    character_id INT,                    -- 发言角色ID，用户发言时为空
+    companion_id INT,                    -- 发言的AI伙伴ID
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (group_id) REFERENCES group_chats(id) ON DELETE CASCADE,
+    INDEX idx_group_messages_group (group_id, id)
+);
+
 -- 语音通话记录表
 CREATE TABLE voice_calls (
     id INT PRIMARY KEY AUTO_INCREMENT,
     user_id INT NOT NULL,
     character_id INT,                    -- 预设角色ID
     companion_id INT,                    -- AI伙伴ID
+    session_id VARCHAR(100),             -- 语音通话会话ID
     call_type ENUM('voice_chat', 'video_call') DEFAULT 'voice_chat',
     status ENUM('initiated', 'ringing', 'answered', 'ended', 'missed') DEFAULT 'initiated',
     duration_seconds INT DEFAULT 0,      -- 通话时长（秒）
     audio_file_url VARCHAR(255),         -- 通话录音文件URL
     started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    ended_at TIMESTAMP,
+    answered_at TIMESTAMP NULL,          -- 接通时间
+    ended_at TIMESTAMP NULL,
     
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (character_id) REFERENCES preset_characters(id) ON DELETE CASCADE,
-    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE
+    FOREIGN KEY (companion_id) REFERENCES ai_companions(id) ON DELETE CASCADE,
+    INDEX idx_voice_calls_user (user_id, started_at)
+);
+
+-- 语音通话轮次耗时表
+CREATE TABLE voice_call_turns (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    voice_call_id INT NOT NULL,
+    asr_ms INT DEFAULT 0,                -- 语音识别耗时（毫秒）
+    llm_ms INT DEFAULT 0,                -- 大模型回复耗时（毫秒）
+    tts_ms INT DEFAULT 0,                -- 语音合成耗时（毫秒）
+    total_ms INT DEFAULT 0,              -- 整轮耗时（毫秒）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    
+    FOREIGN KEY (voice_call_id) REFERENCES voice_calls(id) ON DELETE CASCADE
 );
 
 -- 文件管理表（存储用户上传的图片、音频等文件）
@@ -187,10 +400,11 @@ CREATE TABLE user_files (
     file_url VARCHAR(500) NOT NULL,      -- 文件访问URL
     mime_type VARCHAR(100),              -- MIME类型
     is_temporary BOOLEAN DEFAULT TRUE,  -- 是否为临时文件
-    expires_at TIMESTAMP,                -- 临时文件过期时间
+    expires_at TIMESTAMP NULL,           -- 临时文件过期时间
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_files_expires (expires_at)
 );
 
 -- 表情包表（用户自定义表情）
@@ -268,8 +482,8 @@ INSERT INTO preset_characters (
 -- (1, TRUE, TRUE, TRUE, 'zh-CN');
 
 -- 插入默认好友关系（新用户默认拥有赫敏作为好友）
--- INSERT INTO user_friendships (user_id, character_id, is_active, last_message_at, unread_count) VALUES
--- (1, 4, TRUE, NOW(), 1);
+-- INSERT INTO user_friendships (user_id, character_id, is_active, last_message_at) VALUES
+-- (1, 4, TRUE, NOW());
 
 -- 插入默认表情包（系统通用表情）
 INSERT INTO user_emojis (user_id, emoji_name, emoji_code, usage_count) VALUES
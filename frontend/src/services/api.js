@@ -184,11 +184,13 @@ export const conversationAPI = {
     return response.json();
   },
 
-  // 获取对话历史
-  getHistory: async (token, characterId, limit = 50) => {
+  // 获取对话历史，target为角色ID或 { character_id } / { companion_id }
+  getHistory: async (token, target, limit = 50) => {
     const userId = getUserIdFromToken(token);
+    const params = new URLSearchParams(typeof target === 'object' ? target : { character_id: target });
+    params.set('limit', limit);
     
-    const response = await fetch(`${API_BASE_URL}/conversations/history?character_id=${characterId}&limit=${limit}`, {
+    const response = await fetch(`${API_BASE_URL}/conversations/history?${params}`, {
       headers: {
         'Authorization': `Bearer ${token}`,
         'X-User-ID': userId,
@@ -260,8 +262,9 @@ export const companionAPI = {
   },
 
   // 获取用户的AI伙伴列表
-  getUserCompanions: async (token) => {
-    const response = await fetch(`${API_BASE_URL}/companions`, {
+  getUserCompanions: async (token, includeArchived = false) => {
+    const query = includeArchived ? '?include_archived=true' : '';
+    const response = await fetch(`${API_BASE_URL}/companions${query}`, {
       headers: {
         'Authorization': `Bearer ${token}`,
         'X-User-ID': getUserIdFromToken(token),
@@ -317,6 +320,42 @@ export const companionAPI = {
     return response.json();
   },
 
+  // 获取AI伙伴成长事件日志（type: experience | ability，为空返回全部）
+  getGrowthEvents: async (token, companionId, type = '', limit = 50) => {
+    const params = new URLSearchParams({ limit });
+    if (type) params.set('type', type);
+    const response = await fetch(`${API_BASE_URL}/companions/${companionId}/growth/events?${params}`, {
+      headers: {
+        'Authorization': `Bearer ${token}`,
+        'X-User-ID': getUserIdFromToken(token),
+      },
+    });
+    return response.json();
+  },
+
+  // 获取AI伙伴情绪历史
+  getEmotionHistory: async (token, companionId, days = 7) => {
+    const response = await fetch(`${API_BASE_URL}/companions/${companionId}/emotion/history?days=${days}`, {
+      headers: {
+        'Authorization': `Bearer ${token}`,
+        'X-User-ID': getUserIdFromToken(token),
+      },
+    });
+    return response.json();
+  },
+
+  // 补写最近几天漏掉的日记
+  backfillDiary: async (token, companionId, days = 7) => {
+    const response = await fetch(`${API_BASE_URL}/companions/${companionId}/diary/backfill?days=${days}`, {
+      method: 'POST',
+      headers: {
+        'Authorization': `Bearer ${token}`,
+        'X-User-ID': getUserIdFromToken(token),
+      },
+    });
+    return response.json();
+  },
+
   // 获取AI伙伴情绪状态
   getEmotionState: async (token, companionId) => {
     const response = await fetch(`${API_BASE_URL}/companions/${companionId}/emotion`, {
@@ -327,6 +366,42 @@ export const companionAPI = {
     });
     return response.json();
   },
+
+  // 设为默认AI伙伴
+  setDefaultCompanion: async (token, companionId) => {
+    const response = await fetch(`${API_BASE_URL}/companions/${companionId}/default`, {
+      method: 'PUT',
+      headers: {
+        'Authorization': `Bearer ${token}`,
+        'X-User-ID': getUserIdFromToken(token),
+      },
+    });
+    return response.json();
+  },
+
+  // 归档AI伙伴
+  archiveCompanion: async (token, companionId) => {
+    const response = await fetch(`${API_BASE_URL}/companions/${companionId}/archive`, {
+      method: 'POST',
+      headers: {
+        'Authorization': `Bearer ${token}`,
+        'X-User-ID': getUserIdFromToken(token),
+      },
+    });
+    return response.json();
+  },
+
+  // 恢复已归档的AI伙伴
+  restoreCompanion: async (token, companionId) => {
+    const response = await fetch(`${API_BASE_URL}/companions/${companionId}/restore`, {
+      method: 'POST',
+      headers: {
+        'Authorization': `Bearer ${token}`,
+        'X-User-ID': getUserIdFromToken(token),
+      },
+    });
+    return response.json();
+  },
 };
 
 // 默认导出所有API
@@ -179,50 +179,20 @@ class ChatService {
     }
   }
 
+  // 好友对应的聊天对象：AI伙伴使用companion_id，预设角色使用character_id
+  chatTargetOf(friend) {
+    if (friend.type === 'companion') {
+      return { companion_id: friend.companion_id };
+    }
+    return { character_id: friend.character_id };
+  }
+
   // 加载聊天记录
-  async loadMessages(characterId) {
+  async loadMessages(target) {
     try {
       const token = localStorage.getItem('token');
-      
-          // 如果是AI伙伴（character_id = 5），需要特殊处理
-          if (characterId === 5) {
-        console.log('加载AI伙伴消息，characterId:', characterId);
-        // 使用现有的conversation API，后端需要支持character_id = 5
-        const response = await api.conversation.getHistory(token, 5);
-        const rawMessages = response.data || [];
-        
-        // 处理消息格式
-        const messages = [];
-        rawMessages.forEach(record => {
-          if (record.user_message && record.user_message.trim()) {
-            const userMessage = {
-              id: record.id + '_user',
-              user_message: record.user_message,
-              ai_response: '',
-              message_type: 'user',
-              created_at: record.created_at
-            };
-            messages.push(userMessage);
-          }
-          
-          if (record.ai_response && record.ai_response.trim()) {
-            const aiMessage = {
-              id: record.id + '_ai',
-              user_message: '',
-              ai_response: record.ai_response,
-              message_type: record.message_type || 'text',
-              created_at: record.created_at
-            };
-            messages.push(aiMessage);
-          }
-        });
-        
-        this.messages.splice(0, this.messages.length, ...messages);
-        return this.messages;
-      }
-      
-      // 普通角色的处理逻辑
-      const response = await api.conversation.getHistory(token, characterId);
+
+      const response = await api.conversation.getHistory(token, target);
       // 直接使用response.data，不依赖success字段
       const rawMessages = response.data || [];
       
@@ -263,13 +233,13 @@ class ChatService {
   }
 
   // 发送消息
-  async sendMessage(message, characterId) {
+  async sendMessage(message, target) {
     try {
-      console.log('发送消息:', { message, characterId });
+      console.log('发送消息:', { message, target });
       const token = localStorage.getItem('token');
       console.log('Token:', token);
       const response = await api.conversation.sendMessage(token, {
-        character_id: characterId,
+        ...(typeof target === 'object' ? target : { character_id: target }),
         message: message
       });
       console.log('API响应:', response);
@@ -298,7 +268,7 @@ class ChatService {
   // 切换聊天
   async switchChat(friend) {
     this.currentChat = friend;
-    await this.loadMessages(friend.character_id);
+    await this.loadMessages(this.chatTargetOf(friend));
   }
 
   // 工具函数